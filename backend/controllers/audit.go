@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"log"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestID gives every request an ID, taken from X-Request-ID when the caller sends one, and notes when it started
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := c.GetHeader("X-Request-ID")
+		if requestId == "" {
+			requestId = uuid.New().String()
+		}
+		c.Set("requestId", requestId)
+		c.Set("requestStart", time.Now())
+		c.Header("X-Request-ID", requestId)
+		c.Next()
+	}
+}
+
+// audit records an event of the current request, filling in the request ID, actor, client, path, response status, duration and outcome.
+// The response has usually been written already, so a failure to record is logged rather than returned.
+func (s *Server) audit(c *gin.Context, event models.AuditEvent) {
+	event.RequestId = c.GetString("requestId")
+	// only the API token names the actor, so a caller cannot record an event under someone else's name
+	event.Actor = authenticatedActor(c)
+	if event.Actor == "" {
+		event.Actor = services.AnonymousActor
+	}
+	event.ClientIP = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+	event.Method = c.Request.Method
+	event.Path = c.Request.URL.Path
+	if event.StatusCode == 0 {
+		event.StatusCode = c.Writer.Status()
+	}
+	if start, ok := c.Get("requestStart"); ok {
+		event.DurationMs = time.Since(start.(time.Time)).Milliseconds()
+	}
+
+	if event.Outcome == "" {
+		event.Outcome = services.AuditSuccess
+		if event.ErrorCode != "" {
+			event.Outcome = services.AuditFailed
+		}
+	}
+
+	if err := s.Audit.Record(event); err != nil {
+		log.Println("Error recording audit event:", err)
+	}
+}
+
+// auditFailure records a failed event with its error code and message
+func (s *Server) auditFailure(c *gin.Context, event models.AuditEvent, code string, message string) {
+	event.ErrorCode = code
+	event.Message = message
+	s.audit(c, event)
+}
+
+// failGeneration answers a failed generation request and records it in the audit log and the failed generations list
+func (s *Server) failGeneration(c *gin.Context, event models.AuditEvent, request GenerateRequest, status int, code string, message string) {
+	c.JSON(status, gin.H{"message": message})
+	s.auditFailure(c, event, code, message)
+	s.recordFailedGeneration(models.FailedGenerations{
+		ID:           event.TargetId,
+		DocumentName: event.TargetId,
+		Description:  request.Description,
+		TemplateId:   event.TemplateId,
+		Method:       "POST",
+		JsonPayload:  event.JsonPayload,
+		RefNumber:    request.RefNumber,
+	})
+}
+
+// recordFailedGeneration adds a failed generation request to the failed generations list
+func (s *Server) recordFailedGeneration(generation models.FailedGenerations) {
+	generation.Status = services.AuditFailed
+	generation.CreatedAt = time.Now()
+	if err := s.Failures.Record(generation); err != nil {
+		log.Println("Error recording failed generation:", err)
+	}
+}
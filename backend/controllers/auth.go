@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIToken is a bearer token and the name of the person or system it identifies
+type APIToken struct {
+	Name  string
+	Token string
+}
+
+// ParseAPITokens reads the comma-separated name:token pairs of API_TOKENS
+func ParseAPITokens(value string) ([]APIToken, error) {
+	var tokens []APIToken
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, token, found := strings.Cut(pair, ":")
+		name, token = strings.TrimSpace(name), strings.TrimSpace(token)
+		if !found || name == "" || token == "" {
+			return nil, fmt.Errorf("API token %q is not name:token", name)
+		}
+		tokens = append(tokens, APIToken{Name: name, Token: token})
+	}
+	return tokens, nil
+}
+
+// Authenticate sets the actor of a request from its bearer token.
+// Requests without an Authorization header go on anonymously; an unknown token is refused.
+func Authenticate(tokens []APIToken) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			c.Next()
+			return
+		}
+
+		token, found := strings.CutPrefix(header, "Bearer ")
+		name := ""
+		// every token is compared, so the response time does not tell how much of a token matched
+		for _, known := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(known.Token)) == 1 {
+				name = known.Name
+			}
+		}
+		if !found || name == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid API token"})
+			return
+		}
+
+		c.Set("actor", name)
+		c.Next()
+	}
+}
+
+// RequireActor refuses requests that did not authenticate with an API token
+func RequireActor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authenticatedActor(c) == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "An API token is required, send it as Authorization: Bearer <token>"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// authenticatedActor is the name of the API token the request authenticated with, empty for anonymous requests
+func authenticatedActor(c *gin.Context) string {
+	return c.GetString("actor")
+}
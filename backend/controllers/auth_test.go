@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAPITokens(t *testing.T) {
+	tokens, err := ParseAPITokens(" jane:s3cret, ci:t0ken ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 2 || tokens[0] != (APIToken{Name: "jane", Token: "s3cret"}) || tokens[1] != (APIToken{Name: "ci", Token: "t0ken"}) {
+		t.Errorf("unexpected tokens %+v", tokens)
+	}
+
+	for _, value := range []string{"jane", "jane:", ":s3cret"} {
+		if _, err := ParseAPITokens(value); err == nil {
+			t.Errorf("%q accepted", value)
+		}
+	}
+}
+
+func TestRequireActor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Authenticate([]APIToken{{Name: "jane", Token: "s3cret"}, {Name: "ci", Token: "t0ken"}}))
+	router.POST("/step", RequireActor(), func(c *gin.Context) {
+		c.String(http.StatusOK, authenticatedActor(c))
+	})
+	router.GET("/open", func(c *gin.Context) {
+		c.String(http.StatusOK, authenticatedActor(c))
+	})
+
+	tests := []struct {
+		method, path, authorization string
+		status                      int
+		actor                       string
+	}{
+		{http.MethodPost, "/step", "Bearer t0ken", http.StatusOK, "ci"},
+		{http.MethodPost, "/step", "", http.StatusUnauthorized, ""},
+		{http.MethodPost, "/step", "Bearer wrong", http.StatusUnauthorized, ""},
+		{http.MethodPost, "/step", "t0ken", http.StatusUnauthorized, ""},
+		{http.MethodGet, "/open", "", http.StatusOK, ""},
+		{http.MethodGet, "/open", "Bearer wrong", http.StatusUnauthorized, ""},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.path, nil)
+		if test.authorization != "" {
+			request.Header.Set("Authorization", test.authorization)
+		}
+		// the actor a caller claims does not count
+		request.Header.Set("X-Actor", "mallory")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		if response.Code != test.status {
+			t.Errorf("%s %s with %q: status %d, want %d", test.method, test.path, test.authorization, response.Code, test.status)
+		}
+		if test.status == http.StatusOK && response.Body.String() != test.actor {
+			t.Errorf("%s %s with %q: actor %q, want %q", test.method, test.path, test.authorization, response.Body.String(), test.actor)
+		}
+	}
+}
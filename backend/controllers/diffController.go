@@ -0,0 +1,100 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RevisionDiffRequest struct {
+	From            int             `json:"from"`
+	To              int             `json:"to"`
+	Data            json.RawMessage `json:"data"`
+	Locale          string          `json:"locale"`
+	FallbackLocales []string        `json:"fallbackLocales"`
+}
+
+// DiffDocuments compares two stored documents, given as ?from=<refNumber>&to=<refNumber>
+func (s *Server) DiffDocuments(c *gin.Context) {
+	var documents [2]models.Document
+	var pdfs [2][]byte
+	for i, refNumber := range []string{c.Query("from"), c.Query("to")} {
+		document, err := s.Documents.ByRefNumber(refNumber)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Document " + refNumber + " not found"})
+			return
+		}
+		documents[i] = document
+		pdf, err := services.DownloadFile("pdfs", documents[i].ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching PDF: " + err.Error()})
+			return
+		}
+		pdfs[i] = pdf
+	}
+
+	report, err := services.ComparePDFs(pdfs[0], pdfs[1])
+	if errors.Is(err, services.ErrNoPDFText) {
+		c.JSON(http.StatusNotImplemented, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error comparing documents: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"from": documents[0].RefNumber, "to": documents[1].RefNumber, "diff": report}, "timestamp": time.Now()})
+}
+
+// DiffRevisions renders two revisions of a template with the same payload and compares the results
+func (s *Server) DiffRevisions(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	var request RevisionDiffRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	var revisions [2]models.TemplateRevision
+	for i, number := range []int{request.From, request.To} {
+		if revisions[i], err = s.Templates.Revision(template.ID, number); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Revision not found"})
+			return
+		}
+	}
+
+	locales, err := services.LocaleChain(request.Locale, request.FallbackLocales, template.DefaultLocale)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	data, keyOrder, err := services.DecodeOrderedJSON(string(request.Data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON data: " + err.Error()})
+		return
+	}
+
+	report, err := services.CompareRevisions(s.DB, template, revisions[0], revisions[1], data, keyOrder, locales)
+	if errors.Is(err, services.ErrNoPDFText) {
+		c.JSON(http.StatusNotImplemented, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error comparing revisions: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"from": request.From, "to": request.To, "diff": report}, "timestamp": time.Now()})
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GenerateDocx fills a Word template and returns the DOCX base64 encoded, without converting it to PDF
+func (s *Server) GenerateDocx(c *gin.Context) {
+	var request GenerateRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	template, err := s.Templates.ByRefNumber(request.RefNumber)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found for refNumber: " + request.RefNumber})
+		return
+	}
+
+	if template.Format != services.FormatDocx {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Template " + template.RefNumber + " is not a DOCX template"})
+		return
+	}
+
+	if err := services.GenerationAllowed(template); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+
+	templateBytes, renderOptions, err := services.LoadTemplate(s.DB, template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching template: " + err.Error()})
+		return
+	}
+
+	jsonString, err := json.Marshal(request.Data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to convert data to JSON string: " + err.Error()})
+		return
+	}
+
+	data, keyOrder, err := services.DecodeOrderedJSON(string(jsonString))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON data: " + err.Error()})
+		return
+	}
+	renderOptions.KeyOrder = keyOrder
+
+	renderOptions.Locales, err = services.LocaleChain(request.Locale, request.FallbackLocales, template.DefaultLocale)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	docxBytes, err := services.FillDocx(templateBytes, data, renderOptions)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Error filling template: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"refNumber": template.RefNumber, "contentType": services.DocxContentType, "document": base64.StdEncoding.EncodeToString(docxBytes)}, "timestamp": time.Now()})
+	s.audit(c, models.AuditEvent{
+		EventType:   services.EventDocxGenerated,
+		TargetType:  "template",
+		TargetId:    template.ID,
+		TemplateId:  template.ID,
+		RefNumber:   template.RefNumber,
+		Description: request.Description,
+		JsonPayload: models.JSONPayload(jsonString),
+	})
+}
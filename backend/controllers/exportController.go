@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CloneRequest struct {
+	Name string `json:"templateName"`
+}
+
+// ExportTemplates downloads a ZIP archive of the templates named by repeated refNumber, or of every template matching the list filters
+func (s *Server) ExportTemplates(c *gin.Context) {
+	var templates []models.Template
+	if refNumbers := c.QueryArray("refNumber"); len(refNumbers) > 0 {
+		var err error
+		if templates, err = s.Templates.ByRefNumbers(refNumbers); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching templates: " + err.Error()})
+			return
+		}
+		if len(templates) != len(refNumbers) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Not every template was found"})
+			return
+		}
+	} else {
+		var err error
+		if templates, _, err = services.ListTemplates(s.DB, templateFilter(c), repository.ListQuery{}); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching templates: " + err.Error()})
+			return
+		}
+	}
+
+	archive, err := services.ExportTemplates(s.DB, templates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error exporting templates: " + err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=templates-"+time.Now().Format("20060102-150405")+".zip")
+	c.Data(http.StatusOK, "application/zip", archive)
+}
+
+// ImportTemplates recreates the templates of an export archive, form fields conflict=fail|skip|update and dryRun=true
+func (s *Server) ImportTemplates(c *gin.Context) {
+	file, _, err := c.Request.FormFile("archive")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to retrieve file: " + err.Error()})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading file: " + err.Error()})
+		return
+	}
+
+	conflict := c.DefaultPostForm("conflict", services.ConflictFail)
+	dryRun, _ := strconv.ParseBool(c.PostForm("dryRun"))
+
+	report, err := services.ImportTemplates(s.DB, data, conflict, dryRun, authenticatedActor(c))
+	if errors.Is(err, services.ErrImportRejected) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error(), "report": report})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Error importing templates: " + err.Error(), "report": report})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": report, "timestamp": time.Now()})
+}
+
+// CloneTemplate copies a template into a new draft template with its own refNumber
+func (s *Server) CloneTemplate(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	var request CloneRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	clone, err := services.CloneTemplate(s.DB, template, request.Name, authenticatedActor(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error cloning template: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": clone, "timestamp": clone.CreatedAt})
+}
@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"net/http"
+	"time"
+
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TemplateFields lists the fields of a fillable PDF form template, the keys its request data can set
+func (s *Server) TemplateFields(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	if template.Format != services.FormatPDFForm {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Template " + template.RefNumber + " is not a PDF form template"})
+		return
+	}
+
+	templateBytes, err := services.DownloadFile("templates", template.FileName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching template: " + err.Error()})
+		return
+	}
+
+	fields, err := services.FormFields(templateBytes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading form fields: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": fields, "timestamp": time.Now()})
+}
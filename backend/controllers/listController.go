@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"example/pdfgenerator/repository"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listQuery reads the paging, sorting and filter parameters of a list endpoint:
+// limit, offset, sort (a leading - sorts descending), from, to, q, the resource's filters and data.<path> payload filters
+func listQuery(c *gin.Context, resource repository.ListResource) (repository.ListQuery, error) {
+	list := repository.ListQuery{Limit: services.DefaultPageSize, Filters: map[string]string{}, Search: c.Query("q")}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return list, fmt.Errorf("invalid limit %q", value)
+		}
+		list.Limit = min(limit, services.MaxPageSize)
+	}
+	if value := c.Query("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return list, fmt.Errorf("invalid offset %q", value)
+		}
+		list.Offset = offset
+	}
+
+	list.Sort, list.Desc = resource.DefaultSort, true
+	if value := c.Query("sort"); value != "" {
+		list.Sort, list.Desc = strings.TrimPrefix(value, "-"), strings.HasPrefix(value, "-")
+	}
+	if _, ok := resource.Sorts[list.Sort]; !ok {
+		return list, fmt.Errorf("cannot sort by %s", list.Sort)
+	}
+
+	var err error
+	if list.From, err = services.ParseListTime(c.Query("from"), false); err != nil {
+		return list, err
+	}
+	if list.To, err = services.ParseListTime(c.Query("to"), true); err != nil {
+		return list, err
+	}
+
+	for name := range resource.Filters {
+		if value := c.Query(name); value != "" {
+			list.Filters[name] = value
+		}
+	}
+	if resource.Payload != "" {
+		list.Data = map[string]string{}
+		for name, values := range c.Request.URL.Query() {
+			if path, ok := strings.CutPrefix(name, "data."); ok && len(values) > 0 {
+				list.Data[path] = values[0]
+			}
+		}
+	}
+	return list, nil
+}
+
+// listPage describes the returned page with links to the pages around it
+func listPage(c *gin.Context, list repository.ListQuery, total int64) services.Page {
+	page := services.Page{Total: total, Limit: list.Limit, Offset: list.Offset, Sort: list.Sort}
+	if list.Desc {
+		page.Sort = "-" + list.Sort
+	}
+	if int64(list.Offset+list.Limit) < total {
+		page.Next = pageLink(c, list.Offset+list.Limit)
+	}
+	if list.Offset > 0 {
+		page.Previous = pageLink(c, max(list.Offset-list.Limit, 0))
+	}
+	return page
+}
+
+// pageLink returns the request's path and query with another offset
+func pageLink(c *gin.Context, offset int) string {
+	url := *c.Request.URL
+	query := url.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	url.RawQuery = query.Encode()
+	return url.RequestURI()
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PatchTemplate updates the description, category, tags, owner, status and custom metadata of a template
+func (s *Server) PatchTemplate(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	var patch services.TemplatePatch
+	if err := c.BindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid template metadata: " + err.Error()})
+		return
+	}
+
+	template, err = services.UpdateTemplateMetadata(s.DB, template, patch)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": template, "timestamp": time.Now()})
+}
+
+// templateFilter reads the template list filters: category, owner, status, repeated tag and metadata.<key>=<value>
+func templateFilter(c *gin.Context) services.TemplateFilter {
+	filter := services.TemplateFilter{
+		Category: c.Query("category"),
+		Owner:    c.Query("owner"),
+		Status:   c.Query("status"),
+		Tags:     c.QueryArray("tag"),
+		Metadata: map[string]string{},
+	}
+	for name, values := range c.Request.URL.Query() {
+		if key, ok := strings.CutPrefix(name, "metadata."); ok && key != "" && len(values) > 0 {
+			filter.Metadata[key] = values[0]
+		}
+	}
+	return filter
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadPartial stores a new version of a named partial or base layout
+func (s *Server) UploadPartial(c *gin.Context) {
+	name := c.PostForm("name")
+	kind := c.DefaultPostForm("kind", "partial")
+
+	if err := services.ValidatePartialName(name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if kind != "partial" && kind != "layout" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "kind must be partial or layout"})
+		return
+	}
+
+	file, _, err := c.Request.FormFile("partial")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to retrieve file: " + err.Error()})
+		return
+	}
+	defer file.Close()
+
+	partialBytes, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading file: " + err.Error()})
+		return
+	}
+
+	if _, err := services.ParseTemplateTrees(name, string(partialBytes)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid partial: " + err.Error()})
+		return
+	}
+
+	partial, err := services.SavePartial(s.DB, name, kind, partialBytes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving partial: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": partial, "timestamp": partial.CreatedAt})
+	s.audit(c, models.AuditEvent{
+		EventType:   services.EventPartialUploaded,
+		TargetType:  "partial",
+		TargetId:    partial.ID,
+		Description: "Partial " + partial.Name + " version " + strconv.Itoa(partial.Version) + " uploaded",
+	})
+}
+
+// respondPartialError answers a failed partial lookup, 400 when the template uses a partial that does not exist
+func respondPartialError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrUnknownPartial) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid template: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching partials: " + err.Error()})
+}
+
+// Partials lists the latest version of every partial and layout
+func (s *Server) Partials(c *gin.Context) {
+	latest, err := s.PartialStore.Latest()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching partials"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": latest, "timestamp": time.Now()})
+}
+
+// PartialVersions lists every stored version of a partial, newest first
+func (s *Server) PartialVersions(c *gin.Context) {
+	partials, err := s.PartialStore.Versions(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching partial versions"})
+		return
+	}
+	if len(partials) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Partial not found"})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": partials, "timestamp": time.Now()})
+}
+
+// PreviewPartial returns the content of the latest version of a partial, or of ?version=N
+func (s *Server) PreviewPartial(c *gin.Context) {
+	reference := c.Param("name")
+	if version := c.Query("version"); version != "" {
+		reference += "@" + version
+	}
+
+	partial, err := services.FindPartial(s.DB, reference)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Partial not found"})
+		return
+	}
+
+	partialBytes, err := services.DownloadFile("templates", partial.FileName)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching partial: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": partialBytes, "partial": partial, "timestamp": partial.CreatedAt})
+}
+
+// PartialDependents lists the templates and partials affected by a change to a partial
+func (s *Server) PartialDependents(c *gin.Context) {
+	templates, partials, err := services.PartialDependents(s.DB, c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching dependents: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"templates": templates, "partials": partials}, "timestamp": time.Now()})
+}
+
+// DeletePartial removes all versions of a partial that no template uses anymore
+func (s *Server) DeletePartial(c *gin.Context) {
+	name := c.Param("name")
+
+	templates, partials, err := services.PartialDependents(s.DB, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching dependents: " + err.Error()})
+		return
+	}
+	if len(templates) > 0 || len(partials) > 0 {
+		c.JSON(http.StatusConflict, gin.H{"message": "Partial is still in use", "data": gin.H{"templates": templates, "partials": partials}})
+		return
+	}
+
+	err = s.PartialStore.Delete(name)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Partial not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting partial: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "Partial deleted successfully", "timestamp": time.Now()})
+	s.audit(c, models.AuditEvent{
+		EventType:   services.EventPartialDeleted,
+		TargetType:  "partial",
+		Description: "Partial " + name + " deleted",
+	})
+}
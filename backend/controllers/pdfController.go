@@ -4,15 +4,18 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
-	"example/pdfgenerator/initializers"
 	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
 	"example/pdfgenerator/services"
 
 	"github.com/gin-gonic/gin"
@@ -40,6 +43,8 @@ type PDFResponse struct {
 type PDFGenerationResponse struct {
 	RefNumber string    `json:"refNumber"`
 	CreatedAt time.Time `json:"createdAt"`
+	// VerificationToken is only returned here, to the caller that generated the document
+	VerificationToken string `json:"verificationToken"`
 }
 
 type TemplateUploadResponse struct {
@@ -51,9 +56,12 @@ type TemplateUploadResponse struct {
 }
 
 type GenerateRequest struct {
-	RefNumber   string                 `json:"refNumber"`
-	Description string                 `json:"description"`
-	Data        map[string]interface{} `json:"data"`
+	RefNumber       string          `json:"refNumber"`
+	Description     string          `json:"description"`
+	Data            json.RawMessage `json:"data"`
+	Locale          string          `json:"locale"`
+	FallbackLocales []string        `json:"fallbackLocales"`
+	Flatten         bool            `json:"flatten"`
 }
 
 type DeleteResponse struct {
@@ -63,16 +71,11 @@ type DeleteResponse struct {
 	Timestamp time.Time `json:"currentTimestamp"`
 }
 
-type DocumentHistory struct {
-	Date  string `json:"date"`
-	Count int    `json:"count"`
-}
-
 // UploadTemplate handles uploading an HTML template to MinIO
-func UploadTemplate(c *gin.Context) {
+func (s *Server) UploadTemplate(c *gin.Context) {
 	refNumber := services.GenerateReferenceNumber()
 
-	file, _, err := c.Request.FormFile("template")
+	file, header, err := c.Request.FormFile("template")
 	templateName := c.PostForm("name")
 
 	if err != nil {
@@ -81,21 +84,79 @@ func UploadTemplate(c *gin.Context) {
 	}
 	defer file.Close()
 
+	// html by default, markdown or text from the format field or a .md/.txt file name
+	format, err := services.DetectTemplateFormat(c.PostForm("format"), header.Filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	defaultLocale := c.PostForm("defaultLocale")
+	if defaultLocale != "" {
+		if defaultLocale, err = services.NormalizeLocale(defaultLocale); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+
 	templateBytes, err := io.ReadAll(file)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading file: " + err.Error()})
 		return
 	}
 
+	// a ZIP upload is a bundle of index.html plus the images, CSS and fonts it references
+	var bundle services.TemplateBundle
+	if format != services.FormatDocx && services.IsZipArchive(templateBytes) {
+		bundle, err = services.ReadTemplateBundle(templateBytes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid template bundle: " + err.Error()})
+			return
+		}
+		templateBytes = bundle.Index
+	}
+
+	// syntax errors are rejected, warnings only when the upload is not forced
+	lint := services.LintTemplate(format, templateBytes, bundle.Assets)
+	if lint.Errors > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid template", "lint": lint})
+		return
+	}
+	if force, _ := strconv.ParseBool(c.PostForm("force")); lint.Warnings > 0 && !force {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Template has lint warnings, upload again with force=true to store it anyway", "lint": lint})
+		return
+	}
+
+	// partials and layouts the template includes, so the impact of changing them can be listed
+	var references []string
+	if format != services.FormatDocx && format != services.FormatPDFForm {
+		if references, err = services.TemplateReferences(string(templateBytes)); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid template: " + err.Error()})
+			return
+		}
+	}
+	if err := services.CheckPartialReferences(s.DB, format, templateBytes); err != nil {
+		respondPartialError(c, err)
+		return
+	}
+
 	id := uuid.New().String()
 	objectName := id
 
 	template := models.Template{
-		ID:        id,
-		Name:      templateName,
-		RefNumber: refNumber,
-		FileName:  objectName,
-		CreatedAt: time.Now(),
+		ID:            id,
+		Name:          templateName,
+		RefNumber:     refNumber,
+		FileName:      objectName,
+		DefaultLocale: defaultLocale,
+		Format:        format,
+		Description:   c.PostForm("description"),
+		Category:      strings.TrimSpace(c.PostForm("category")),
+		Owner:         strings.TrimSpace(c.PostForm("owner")),
+		Status:        services.TemplateDraft,
+		Tags:          services.NormalizeTags(strings.Split(c.PostForm("tags"), ",")),
+		Metadata:      map[string]string{},
+		CreatedAt:     time.Now(),
 	}
 
 	templateReader := bytes.NewReader(templateBytes)
@@ -104,545 +165,273 @@ func UploadTemplate(c *gin.Context) {
 		return
 	}
 
-	if err := services.SaveTemplate(&template); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving template metadata: " + err.Error()})
+	// the stored file and assets are removed again when the template cannot be saved
+	if err := services.SaveTemplateAssets(s.DB, id, bundle.Assets); err != nil {
+		services.DiscardTemplateUpload(s.DB, id, objectName)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error uploading template assets: " + err.Error()})
 		return
 	}
 
-	//inserting post request into logs table
-	if err := initializers.DB.Create(&models.Logs{
-		ID:                  id,
-		DocumentName:        id,
-		JsonPayload:         "",
-		Status:              "SUCCESS",
-		Method:              "POST",
-		DocumentDescription: "--",
-		TemplateId:          id,
-		RefNumber:           refNumber,
-		CreatedAt:           time.Now(),
-	}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
+	// new templates are drafts until their first revision is reviewed and published;
+	// the row, tags, references and revision are saved together or not at all
+	if err := services.SaveTemplate(s.DB, &template, references, authenticatedActor(c)); err != nil {
+		services.DiscardTemplateUpload(s.DB, id, objectName)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving template metadata: " + err.Error()})
 		return
 	}
 
 	// c.IndentedJSON(http.StatusOK, template)
-	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": template, "time": template.CreatedAt})
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": template, "lint": lint, "time": template.CreatedAt})
+
+	s.audit(c, models.AuditEvent{
+		EventType:   services.EventTemplateUploaded,
+		TargetType:  "template",
+		TargetId:    id,
+		TemplateId:  id,
+		RefNumber:   refNumber,
+		Description: template.Description,
+	})
 }
 
 // CreateDocument generates a PDF using a stored template and JSON data
-func CreateDocument(c *gin.Context) {
+func (s *Server) CreateDocument(c *gin.Context) {
 	id := uuid.New().String()
 	// refNumber := c.PostForm("refNumber")
 	// jsonData := c.PostForm("data")
 
-	currentTime := time.Now()
-
 	var request GenerateRequest
+	event := models.AuditEvent{EventType: services.EventDocumentGenerated, TargetType: "document", TargetId: id}
 
 	// Bind the JSON request to the struct
 	if err := c.BindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
-		//inserting get request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:             uuid.New().String(),
-			DocumentName:   "",
-			JsonPayload:    "",
-			Status:         "FAILED",
-			Method:         "POST",
-			LogDescription: "Invalid Request",
-			TemplateId:     "",
-			RefNumber:      "",
-			CreatedAt:      currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
-
-		//insert into failed generations table
-		if err := initializers.DB.Create(&models.FailedGenerations{
-			ID:           id,
-			DocumentName: id,
-			Description:  request.Description,
-			TemplateId:   "",
-			Status:       "FAILED",
-			Method:       "POST",
-			JsonPayload:  "",
-			RefNumber:    request.RefNumber,
-			CreatedAt:    currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		}
+		s.failGeneration(c, event, request, http.StatusBadRequest, services.ErrorInvalidRequest, "Invalid request")
 		return
 	}
+	event.Description = request.Description
+	event.RefNumber = request.RefNumber
 
-	var template models.Template
-	if err := initializers.DB.First(&template, "ref_number = ?", request.RefNumber).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found for refNumber: " + request.RefNumber})
-		//inserting post request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:                  id,
-			DocumentName:        id,
-			JsonPayload:         "",
-			Status:              "FAILED",
-			Method:              "POST",
-			DocumentDescription: "--",
-			TemplateId:          "",
-			RefNumber:           request.RefNumber,
-			CreatedAt:           time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
+	template, err := s.Templates.ByRefNumber(request.RefNumber)
+	if err != nil {
+		s.failGeneration(c, event, request, http.StatusNotFound, services.ErrorTemplateNotFound, "Template not found for refNumber: "+request.RefNumber)
+		return
+	}
+	event.TemplateId = template.ID
 
-		//insert into failed generations table
-		if err := initializers.DB.Create(&models.FailedGenerations{
-			ID:           id,
-			DocumentName: id,
-			Description:  request.Description,
-			TemplateId:   "",
-			Status:       "FAILED",
-			Method:       "POST",
-			JsonPayload:  "",
-			RefNumber:    request.RefNumber,
-			CreatedAt:    currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		}
+	if template.Format == services.FormatText {
+		s.failGeneration(c, event, request, http.StatusBadRequest, services.ErrorInvalidRequest, "Template "+template.RefNumber+" is a plain-text template, use /generate-text")
+		return
+	}
+	// drafts and archived templates can be previewed but not used for production documents
+	if err := services.GenerationAllowed(template); err != nil {
+		s.failGeneration(c, event, request, http.StatusConflict, services.ErrorNotPublished, err.Error())
 		return
 	}
 
-	templateId := template.FileName
-	templateKey := templateId
-	templateBytes, err := services.DownloadFile("templates", templateKey)
+	templateBytes, renderOptions, err := services.LoadTemplate(s.DB, template)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching template: " + err.Error()})
-		//inserting post request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:                  id,
-			DocumentName:        id,
-			JsonPayload:         "",
-			Status:              "FAILED",
-			Method:              "POST",
-			DocumentDescription: "Error fetching template: " + err.Error(),
-			TemplateId:          "",
-			RefNumber:           request.RefNumber,
-			CreatedAt:           time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
-
-		//insert into failed generations table
-		if err := initializers.DB.Create(&models.FailedGenerations{
-			ID:           id,
-			DocumentName: id,
-			Description:  request.Description,
-			TemplateId:   templateId,
-			Status:       "FAILED",
-			Method:       "POST",
-			JsonPayload:  "",
-			RefNumber:    request.RefNumber,
-			CreatedAt:    currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		}
+		s.failGeneration(c, event, request, http.StatusInternalServerError, services.ErrorTemplateFetch, "Error fetching template: "+err.Error())
 		return
 	}
 
-	// Convert the map to a JSON string
+	// Compact the raw data to a JSON string
 	jsonString, err := json.Marshal(request.Data)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to convert data to JSON string: " + err.Error()})
+		s.failGeneration(c, event, request, http.StatusInternalServerError, services.ErrorInvalidRequest, "Failed to convert data to JSON string: "+err.Error())
 		return
 	}
+	event.JsonPayload = models.JSONPayload(jsonString)
 
-	data, err := services.DecodeJSON(string(jsonString))
+	data, keyOrder, err := services.DecodeOrderedJSON(string(jsonString))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON data: " + err.Error()})
+		s.failGeneration(c, event, request, http.StatusBadRequest, services.ErrorInvalidRequest, "Invalid JSON data: "+err.Error())
 		return
 	}
+	renderOptions.KeyOrder = keyOrder
 
-	pdfBytes, err := services.GeneratePDF(templateBytes, data)
+	renderOptions.Locales, err = services.LocaleChain(request.Locale, request.FallbackLocales, template.DefaultLocale)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error generating PDF: " + err.Error()})
-		//inserting post request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:                  id,
-			DocumentName:        id,
-			JsonPayload:         string(jsonString),
-			Status:              "FAILED",
-			Method:              "POST",
-			DocumentDescription: request.Description,
-			TemplateId:          templateId,
-			RefNumber:           request.RefNumber,
-			CreatedAt:           time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
-
-		//insert into failed generations table
-		if err := initializers.DB.Create(&models.FailedGenerations{
-			ID:           id,
-			DocumentName: id,
-			Description:  request.Description,
-			TemplateId:   templateId,
-			Status:       "FAILED",
-			Method:       "POST",
-			JsonPayload:  string(jsonString),
-			RefNumber:    request.RefNumber,
-			CreatedAt:    currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		}
+		s.failGeneration(c, event, request, http.StatusBadRequest, services.ErrorInvalidRequest, err.Error())
 		return
 	}
 
-	objectName := id
-	fileReader := bytes.NewReader(pdfBytes)
-
-	if err := services.UploadFile("pdfs", objectName, fileReader); err != nil {
-
-		//inserting post request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:                  id,
-			DocumentName:        id,
-			JsonPayload:         string(jsonString),
-			Status:              "FAILED",
-			Method:              "POST",
-			DocumentDescription: request.Description,
-			TemplateId:          templateId,
-			RefNumber:           request.RefNumber,
-			CreatedAt:           time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
-
-		//insert into failed generations table
-		if err := initializers.DB.Create(&models.FailedGenerations{
-			ID:           id,
-			DocumentName: id,
-			Description:  request.Description,
-			TemplateId:   templateId,
-			Status:       "FAILED",
-			Method:       "POST",
-			JsonPayload:  string(jsonString),
-			RefNumber:    request.RefNumber,
-			CreatedAt:    currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		}
+	verificationToken, err := services.GenerateVerificationToken()
+	if err != nil {
+		s.failGeneration(c, event, request, http.StatusInternalServerError, services.ErrorRenderFailed, "Error generating verification token: "+err.Error())
+		return
+	}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error uploading PDF: " + err.Error()})
+	renderOptions.VerificationToken = verificationToken
+	renderOptions.Flatten = request.Flatten
+	pdfBytes, err := services.GeneratePDF(templateBytes, data, renderOptions)
+	if err != nil {
+		s.failGeneration(c, event, request, http.StatusInternalServerError, services.ErrorRenderFailed, "Error generating PDF: "+err.Error())
 		return
 	}
 
 	storageKey := services.GenerateReferenceNumber()
 	document := models.Document{
-		ID:           id,
-		DocumentName: id,
-		JsonPayload:  string(jsonString),
-		Description:  request.Description,
-		TemplateId:   templateId,
-		RefNumber:    storageKey,
-		CreatedAt:    time.Now(),
-	}
-
-	if err := initializers.DB.Create(&document).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		//inserting post request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:                  id,
-			DocumentName:        id,
-			JsonPayload:         string(jsonString),
-			Status:              "FAILED",
-			Method:              "POST",
-			DocumentDescription: request.Description,
-			TemplateId:          templateId,
-			RefNumber:           request.RefNumber,
-			CreatedAt:           time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
-
-		//insert into failed generations table
-		if err := initializers.DB.Create(&models.FailedGenerations{
-			ID:           id,
-			DocumentName: id,
-			Description:  request.Description,
-			TemplateId:   templateId,
-			Status:       "FAILED",
-			Method:       "POST",
-			JsonPayload:  string(jsonString),
-			RefNumber:    request.RefNumber,
-			CreatedAt:    currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
+		ID:                id,
+		DocumentName:      id,
+		JsonPayload:       models.JSONPayload(jsonString),
+		Description:       request.Description,
+		TemplateId:        template.ID,
+		RefNumber:         storageKey,
+		Sha256:            services.HashPDF(pdfBytes),
+		VerificationToken: verificationToken,
+		CreatedAt:         time.Now(),
+	}
+
+	// the PDF is removed again if its row cannot be saved
+	if err := services.StoreDocument(s.DB, document, pdfBytes); err != nil {
+		if errors.Is(err, services.ErrStorage) {
+			s.failGeneration(c, event, request, http.StatusInternalServerError, services.ErrorStorageFailed, "Error uploading PDF: "+err.Error())
+		} else {
+			s.failGeneration(c, event, request, http.StatusInternalServerError, services.ErrorDatabaseFailed, "Error saving document metadata in database: "+err.Error())
 		}
 		return
 	}
 
-	//inserting post request into logs table
-	if err := initializers.DB.Create(&models.Logs{
-		ID:                  id,
-		DocumentName:        id,
-		JsonPayload:         string(jsonString),
-		Status:              "SUCCESS",
-		Method:              "POST",
-		DocumentDescription: request.Description,
-		TemplateId:          templateId,
-		RefNumber:           storageKey,
-		CreatedAt:           time.Now(),
-	}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		return
+	// a document missing from search can be reindexed, so indexing does not fail the generation
+	if err := services.IndexDocument(s.DB, document); err != nil {
+		log.Println("Error indexing document for search:", err)
 	}
 
 	pdfGenerationResponse := PDFGenerationResponse{
-		RefNumber: document.RefNumber,
-		CreatedAt: document.CreatedAt,
+		RefNumber:         document.RefNumber,
+		CreatedAt:         document.CreatedAt,
+		VerificationToken: document.VerificationToken,
 	}
 
 	// c.IndentedJSON(http.StatusOK, pdfGenerationResponse)
 	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": pdfGenerationResponse, "timestamp": pdfGenerationResponse.CreatedAt})
+
+	event.RefNumber = storageKey
+	s.audit(c, event)
 }
 
 // GetDocuments retrieves all documents
-func GetDocuments(c *gin.Context) {
-	var documents []models.Document
-	if err := initializers.DB.Find(&documents).Error; err != nil {
+func (s *Server) GetDocuments(c *gin.Context) {
+	list, err := listQuery(c, repository.DocumentList)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	documents, total, err := s.Documents.List(list)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching documents"})
 		return
 	}
 	currentTime := time.Now()
-	// c.IndentedJSON(http.StatusOK, documents)
-
-	//inserting get request into logs table
-	// if err := initializers.DB.Create(&models.Logs{
-	// 	ID:             uuid.New().String(),
-	// 	DocumentName:   "",
-	// 	JsonPayload:    "",
-	// 	Status:         "SUCCESS",
-	// 	Method:         "GET",
-	// 	LogDescription: "Get all documents",
-	// 	TemplateId:     "",
-	// 	RefNumber:      "",
-	// 	CreatedAt:      currentTime,
-	// }).Error; err != nil {
-	// 	c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-	// 	return
-	// }
-
-	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": documents, "timestamp": currentTime})
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": documents, "pagination": listPage(c, list, total), "timestamp": currentTime})
 }
 
 // PreviewDocument returns the PDF for a given document refNumber
-func PreviewDocument(c *gin.Context) {
+func (s *Server) PreviewDocument(c *gin.Context) {
 	refNo := c.Param("refNumber")
 
-	var document models.Document
-	if err := initializers.DB.Where("ref_number = ?", refNo).First(&document).Error; err != nil {
-
-		//inserting get request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:             uuid.New().String(),
-			DocumentName:   "",
-			JsonPayload:    "",
-			Status:         "FAILED",
-			Method:         "GET",
-			LogDescription: "Document not found",
-			TemplateId:     "",
-			RefNumber:      refNo,
-			CreatedAt:      time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
+	event := models.AuditEvent{EventType: services.EventDocumentViewed, TargetType: "document", RefNumber: refNo}
+
+	document, err := s.Documents.ByRefNumber(refNo)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Document not found"})
+		s.auditFailure(c, event, services.ErrorDocumentNotFound, "Document not found")
 		return
 	}
+	event.TargetId = document.ID
+	event.TemplateId = document.TemplateId
+	event.Description = document.Description
 
 	objectName := document.ID
 
 	pdfBytes, err := services.DownloadFile("pdfs", objectName)
 	if err != nil {
-		//inserting get request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:             uuid.New().String(),
-			DocumentName:   "",
-			JsonPayload:    "",
-			Status:         "FAILED",
-			Method:         "GET",
-			LogDescription: "Error fetching PDF: " + err.Error(),
-			TemplateId:     "",
-			RefNumber:      refNo,
-			CreatedAt:      time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching PDF: " + err.Error()})
+		s.auditFailure(c, event, services.ErrorDocumentFetch, "Error fetching PDF: "+err.Error())
 		return
 	}
 
 	// Encode the PDF bytes to base64
 	pdfBase64 := base64.StdEncoding.EncodeToString(pdfBytes)
 
-	//insert into logs table
-	if err := initializers.DB.Create(&models.Logs{
-		ID:                  document.ID,
-		DocumentName:        document.ID,
-		JsonPayload:         "",
-		Status:              "SUCCESS",
-		Method:              "GET",
-		DocumentDescription: document.Description,
-		TemplateId:          document.TemplateId,
-		RefNumber:           refNo,
-		CreatedAt:           time.Now(),
-	}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		return
-	}
-
 	// c.JSON(http.StatusOK, pdfBase64)
 	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": pdfBase64, "timestamp": document.CreatedAt})
+	s.audit(c, event)
 }
 
 // PreviewTemplate returns the template file content
-func PreviewTemplate(c *gin.Context) {
+func (s *Server) PreviewTemplate(c *gin.Context) {
 	refNo := c.Param("refNumber")
 
-	var template models.Template
-	if err := initializers.DB.Where("ref_number = ?", refNo).First(&template).Error; err != nil {
-		//inserting get request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:             uuid.New().String(),
-			DocumentName:   "",
-			JsonPayload:    "",
-			Status:         "FAILED",
-			Method:         "GET",
-			LogDescription: "Template not found",
-			TemplateId:     "",
-			RefNumber:      refNo,
-			CreatedAt:      time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
+	event := models.AuditEvent{EventType: services.EventTemplateViewed, TargetType: "template", RefNumber: refNo}
+
+	template, err := s.Templates.ByRefNumber(refNo)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		s.auditFailure(c, event, services.ErrorTemplateNotFound, "Template not found")
 		return
 	}
+	event.TargetId = template.ID
+	event.TemplateId = template.ID
 
-	objectName := template.ID
-	templateBytes, err := services.DownloadFile("templates", objectName)
-	if err != nil {
-		//inserting get request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:             uuid.New().String(),
-			DocumentName:   "",
-			JsonPayload:    "",
-			Status:         "FAILED",
-			Method:         "GET",
-			LogDescription: "Error fetching template",
-			TemplateId:     "",
-			RefNumber:      refNo,
-			CreatedAt:      time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
+	// ?revision=N previews a draft or older revision instead of the published content
+	revision := models.TemplateRevision{TemplateId: template.ID, FileName: template.FileName}
+	if value := c.Query("revision"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid revision number"})
+			return
+		}
+		if revision, err = s.Templates.Revision(template.ID, number); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Revision not found"})
 			return
 		}
+	}
+	templateBytes, err := services.DownloadFile("templates", revision.FileName)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching template: " + err.Error()})
+		s.auditFailure(c, event, services.ErrorTemplateFetch, "Error fetching template: "+err.Error())
 		return
 	}
 
-	// c.Data(http.StatusOK, "text/html", templateBytes)
-	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": templateBytes, "timestamp": template.CreatedAt})
+	// a draft imported with its own assets is previewed with those
+	assets, err := services.RevisionAssets(s.DB, template, revision)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching template assets: " + err.Error()})
+		return
+	}
 
+	// c.Data(http.StatusOK, "text/html", templateBytes)
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": templateBytes, "assets": assets, "timestamp": template.CreatedAt})
+	s.audit(c, event)
 }
 
 // DeleteDocument deletes a document by refNumber
-func DeleteDocument(c *gin.Context) {
+func (s *Server) DeleteDocument(c *gin.Context) {
 	refNumber := c.Param("refNumber")
+	event := models.AuditEvent{EventType: services.EventDocumentDeleted, TargetType: "document", RefNumber: refNumber}
 
 	currentTime := time.Now()
 
 	//find this document in the database
-	var document models.Document
-	if err := initializers.DB.Where("ref_number = ?", refNumber).First(&document).Error; err != nil {
-		if err := initializers.DB.Create(&models.Logs{
-			// ID: uuid.New().String(),
-			ID:                  document.ID,
-			DocumentName:        document.ID,
-			DocumentDescription: document.Description,
-			TemplateId:          document.TemplateId,
-			JsonPayload:         "",
-			Status:              "FAILED",
-			Method:              "DELETE",
-			LogDescription:      "Document not found",
-			RefNumber:           refNumber,
-			CreatedAt:           currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
-
-		//insert into failed generations table
-		if err := initializers.DB.Create(&models.FailedGenerations{
-			ID:           document.ID,
-			DocumentName: document.ID,
-			Description:  document.Description,
-			TemplateId:   document.TemplateId,
-			Status:       "FAILED",
-			Method:       "DELETE",
-			JsonPayload:  "",
-			RefNumber:    refNumber,
-			CreatedAt:    currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		}
+	document, err := s.Documents.ByRefNumber(refNumber)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Document not found"})
+		s.auditFailure(c, event, services.ErrorDocumentNotFound, "Document not found")
 		return
 	}
+	event.TargetId = document.ID
+	event.TemplateId = document.TemplateId
+	event.Description = document.Description
 
-	//inserting delete request into logs table
-	if err := initializers.DB.Create(&models.Logs{
-		// ID: uuid.New().String(),
-		ID:                  document.ID,
-		DocumentName:        document.ID,
-		DocumentDescription: document.Description,
-		TemplateId:          document.TemplateId,
-		JsonPayload:         "",
-		Status:              "SUCCESS",
-		Method:              "DELETE",
-		LogDescription:      "Document deleted successfully",
-		RefNumber:           refNumber,
-		CreatedAt:           currentTime,
-	}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
+	err = services.DeleteDocumentByRefNumber(s.DB, refNumber)
+	if errors.Is(err, services.ErrLegalHold) {
+		c.JSON(http.StatusConflict, gin.H{"message": "Document " + refNumber + " is under legal hold and cannot be deleted"})
+		s.auditFailure(c, event, services.ErrorLegalHold, err.Error())
 		return
 	}
-
-	err := services.DeleteDocumentByRefNumber(refNumber)
 	if err != nil {
-		if err := initializers.DB.Create(&models.Logs{
-			// ID: uuid.New().String(),
-			ID:                  document.ID,
-			DocumentName:        document.ID,
-			DocumentDescription: document.Description,
-			TemplateId:          document.TemplateId,
-			JsonPayload:         "",
-			Status:              "FAILED",
-			Method:              "DELETE",
-			LogDescription:      "Failed to delete document",
-			RefNumber:           refNumber,
-			CreatedAt:           currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
 		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		s.auditFailure(c, event, services.ErrorDeleteFailed, "Failed to delete document: "+err.Error())
 		return
 	}
 
@@ -653,93 +442,65 @@ func DeleteDocument(c *gin.Context) {
 		Timestamp: currentTime,
 	}
 	c.IndentedJSON(http.StatusOK, response)
+	s.audit(c, event)
 }
 
 // DeleteTemplate deletes a template by refNumber
-func DeleteTemplate(c *gin.Context) {
+func (s *Server) DeleteTemplate(c *gin.Context) {
 	refNumber := c.Param("refNumber")
 
 	//find this template in the database
-	var template models.Template
-	if err := initializers.DB.Where("ref_number = ?", refNumber).First(&template).Error; err != nil {
+	template, err := s.Templates.ByRefNumber(refNumber)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
 		return
 	}
+	event := models.AuditEvent{EventType: services.EventTemplateDeleted, TargetType: "template", TargetId: template.ID, TemplateId: template.ID, RefNumber: refNumber, Description: template.Description}
 
-	//inserting delete request into logs table
-	if err := initializers.DB.Create(&models.Logs{
-		// ID: uuid.New().String(),
-		ID:             uuid.New().String(),
-		DocumentName:   "",
-		JsonPayload:    "",
-		Status:         "SUCCESS",
-		Method:         "DELETE",
-		LogDescription: "Template deleted successfully",
-		TemplateId:     template.ID,
-		RefNumber:      refNumber,
-		CreatedAt:      time.Now(),
-	}).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		return
-	}
-
-	err := services.DeleteTemplateByRefNumber(refNumber)
+	err = services.DeleteTemplateByRefNumber(s.DB, refNumber)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		s.auditFailure(c, event, services.ErrorDeleteFailed, "Failed to delete template: "+err.Error())
 		return
 	}
 
 	currentTime := time.Now()
 	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "Template deleted successfully", "timestamp": currentTime})
+	s.audit(c, event)
 }
 
-// Templates retrieves all templates
-func Templates(c *gin.Context) {
-	var templates []models.Template
-	if err := initializers.DB.Find(&templates).Error; err != nil {
+// GetTemplates retrieves all templates
+func (s *Server) GetTemplates(c *gin.Context) {
+	list, err := listQuery(c, services.TemplateList)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	templates, total, err := services.ListTemplates(s.DB, templateFilter(c), list)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching templates"})
 		return
 	}
 	currentTime := time.Now()
 	// c.IndentedJSON(http.StatusOK, templates)
 
-	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": templates, "timestamp": currentTime})
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": templates, "pagination": listPage(c, list, total), "timestamp": currentTime})
 }
 
-func GetDocumentHistory(c *gin.Context) {
-	var history []DocumentHistory
-
+func (s *Server) GetDocumentHistory(c *gin.Context) {
 	// Calculate the start of the current week (most recent Sunday)
 	now := time.Now()
 	weekday := int(now.Weekday())
 	startOfWeek := now.AddDate(0, 0, -weekday)
 
 	// Group by creation date and count documents within the current week
-	err := initializers.DB.Table("documents").
-		Select("TO_CHAR(created_at AT TIME ZONE 'UTC', 'FMDay') as date, COUNT(*) as count").
-		Where("created_at >= ?", startOfWeek).
-		Group("TO_CHAR(created_at AT TIME ZONE 'UTC', 'FMDay')").
-		Scan(&history).Error
+	history, err := s.Documents.PerWeekday(startOfWeek)
 
 	if err != nil {
 		log.Println("Error fetching document history:", err)
 
-		//inserting get request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:             uuid.New().String(),
-			DocumentName:   "",
-			JsonPayload:    "",
-			Status:         "FAILED",
-			Method:         "GET",
-			LogDescription: "Error fetching document history",
-			TemplateId:     "",
-			RefNumber:      "",
-			CreatedAt:      now,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching document history"})
+		s.auditFailure(c, models.AuditEvent{EventType: services.EventMetricsViewed}, services.ErrorDatabaseFailed, "Error fetching document history")
 		return
 	}
 
@@ -755,8 +516,8 @@ func GetDocumentHistory(c *gin.Context) {
 	}
 
 	// Populate counts from the database results
-	for _, record := range history {
-		dayCounts[record.Date] = record.Count
+	for weekday, count := range history {
+		dayCounts[time.Weekday(weekday).String()] = count
 	}
 
 	// Get the current day of the week
@@ -782,123 +543,58 @@ func GetDocumentHistory(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": response})
 }
 
-func AutodocsLogs(c *gin.Context) {
-	var logs []models.Logs
-	if err := initializers.DB.Find(&logs).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching logs"})
+// AutodocsLogs lists the audit log, newest first
+func (s *Server) AutodocsLogs(c *gin.Context) {
+	list, err := listQuery(c, repository.LogList)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
-	currentTime := time.Now()
-	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": logs, "timestamp": currentTime})
-}
-
-func DeleteAllLogs(c *gin.Context) {
-	err := initializers.DB.Exec("DELETE FROM logs").Error
+	events, total, err := s.Audit.List(list)
 	if err != nil {
-
-		//inserting delete request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:             uuid.New().String(),
-			DocumentName:   "",
-			JsonPayload:    "",
-			Status:         "FAILED",
-			Method:         "DELETE",
-			LogDescription: "Error deleting logs",
-			TemplateId:     "",
-			RefNumber:      "",
-			CreatedAt:      time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting logs"})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching logs"})
 		return
 	}
 	currentTime := time.Now()
-	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "Logs deleted successfully", "timestamp": currentTime})
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": events, "pagination": listPage(c, list, total), "timestamp": currentTime})
 }
 
 // GetMetrics retrieves metrics based on the provided date range
-func GetRangeMetrics(c *gin.Context) {
+func (s *Server) GetRangeMetrics(c *gin.Context) {
 	startDate := c.Query("startDate")
 	endDate := c.Query("endDate")
 
-	var totalTemplates int64
-	var totalDocuments int64
-	var failedGenerations int64
-
 	// Parse the start and end dates
 	start, err := time.Parse("2006-01-02", startDate)
 	if err != nil {
-
-		//inserting get request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:             uuid.New().String(),
-			DocumentName:   "",
-			JsonPayload:    "",
-			Status:         "FAILED",
-			Method:         "GET",
-			LogDescription: "Invalid start date",
-			TemplateId:     "",
-			RefNumber:      "",
-			CreatedAt:      time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid start date"})
+		s.auditFailure(c, models.AuditEvent{EventType: services.EventMetricsViewed}, services.ErrorInvalidDate, "Invalid start date")
 		return
 	}
 	end, err := time.Parse("2006-01-02", endDate)
 	if err != nil {
-
-		//inserting get request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:             uuid.New().String(),
-			DocumentName:   "",
-			JsonPayload:    "",
-			Status:         "FAILED",
-			Method:         "GET",
-			LogDescription: "Invalid end date",
-			TemplateId:     "",
-			RefNumber:      "",
-			CreatedAt:      time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid end date"})
+		s.auditFailure(c, models.AuditEvent{EventType: services.EventMetricsViewed}, services.ErrorInvalidDate, "Invalid end date")
 		return
 	}
 
 	// Count total templates within the date range
-	if err := initializers.DB.Model(&models.Template{}).
-		Where("created_at BETWEEN ? AND ?", start, end).
-		Count(&totalTemplates).Error; err != nil {
+	totalTemplates, err := s.Templates.CountCreatedBetween(start, end)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching templates count"})
 		return
 	}
 
 	// Count total documents within the date range
-	if err := initializers.DB.Model(&models.Document{}).
-		Where("created_at BETWEEN ? AND ?", start, end).
-		Count(&totalDocuments).Error; err != nil {
+	totalDocuments, err := s.Documents.CountCreatedBetween(start, end)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching documents count"})
 		return
 	}
 
-	// Count failed generations within the date range
-	// if err := initializers.DB.Model(&models.Logs{}).
-	// 	Where("created_at BETWEEN ? AND ? AND status = ?", start, end, "FAILED").
-	// 	Count(&failedGenerations).Error; err != nil {
-	// 	c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching failed generations count"})
-	// 	return
-	// }
-
 	//Count failed generations from failed generations table
-	if err := initializers.DB.Model(&models.FailedGenerations{}).
-		Where("created_at BETWEEN ? AND ?", start, end).
-		Count(&failedGenerations).Error; err != nil {
+	failedGenerations, err := s.Failures.CountCreatedBetween(start, end)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching failed generations count"})
 		return
 	}
@@ -930,166 +626,85 @@ func GetRangeMetrics(c *gin.Context) {
 }
 
 // failed Generations
-func GetFailedGenerations(c *gin.Context) {
-	var failedGenerations []models.FailedGenerations
-	if err := initializers.DB.Find(&failedGenerations).Error; err != nil {
+func (s *Server) GetFailedGenerations(c *gin.Context) {
+	list, err := listQuery(c, repository.FailedGenerationList)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	failedGenerations, total, err := s.Failures.List(list)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching failed generations"})
 		return
 	}
 	currentTime := time.Now()
-	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": failedGenerations, "timestamp": currentTime})
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": failedGenerations, "pagination": listPage(c, list, total), "timestamp": currentTime})
 }
 
-func HtmlBeforePDF(c *gin.Context) {
+func (s *Server) HtmlBeforePDF(c *gin.Context) {
 	id := uuid.New().String()
 	// refNumber := c.PostForm("refNumber")
 	// jsonData := c.PostForm("data")
 
-	currentTime := time.Now()
-
 	var request GenerateRequest
+	event := models.AuditEvent{EventType: services.EventHTMLRendered, TargetType: "document", TargetId: id}
 
 	// Bind the JSON request to the struct
 	if err := c.BindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
-		//inserting get request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:             uuid.New().String(),
-			DocumentName:   "",
-			JsonPayload:    "",
-			Status:         "FAILED",
-			Method:         "POST",
-			LogDescription: "Invalid Request",
-			TemplateId:     "",
-			RefNumber:      "",
-			CreatedAt:      currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
-
-		//insert into failed generations table
-		if err := initializers.DB.Create(&models.FailedGenerations{
-			ID:           id,
-			DocumentName: id,
-			Description:  request.Description,
-			TemplateId:   "",
-			Status:       "FAILED",
-			Method:       "POST",
-			JsonPayload:  "",
-			RefNumber:    request.RefNumber,
-			CreatedAt:    currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		}
+		s.failGeneration(c, event, request, http.StatusBadRequest, services.ErrorInvalidRequest, "Invalid request")
 		return
 	}
+	event.Description = request.Description
+	event.RefNumber = request.RefNumber
 
-	var template models.Template
-	if err := initializers.DB.First(&template, "ref_number = ?", request.RefNumber).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found for refNumber: " + request.RefNumber})
-		//inserting post request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:                  id,
-			DocumentName:        id,
-			JsonPayload:         "",
-			Status:              "FAILED",
-			Method:              "POST",
-			DocumentDescription: "--",
-			TemplateId:          "",
-			RefNumber:           request.RefNumber,
-			CreatedAt:           time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
+	template, err := s.Templates.ByRefNumber(request.RefNumber)
+	if err != nil {
+		s.failGeneration(c, event, request, http.StatusNotFound, services.ErrorTemplateNotFound, "Template not found for refNumber: "+request.RefNumber)
+		return
+	}
+	event.TemplateId = template.ID
 
-		//insert into failed generations table
-		if err := initializers.DB.Create(&models.FailedGenerations{
-			ID:           id,
-			DocumentName: id,
-			Description:  request.Description,
-			TemplateId:   "",
-			Status:       "FAILED",
-			Method:       "POST",
-			JsonPayload:  "",
-			RefNumber:    request.RefNumber,
-			CreatedAt:    currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		}
+	// only HTML and Markdown templates are rendered to HTML before the PDF
+	switch template.Format {
+	case services.FormatText:
+		s.failGeneration(c, event, request, http.StatusBadRequest, services.ErrorInvalidRequest, "Template "+template.RefNumber+" is a plain-text template, use /generate-text")
+		return
+	case services.FormatDocx, services.FormatPDFForm:
+		s.failGeneration(c, event, request, http.StatusBadRequest, services.ErrorInvalidRequest, "Template "+template.RefNumber+" is a "+template.Format+" template and has no HTML preview")
 		return
 	}
 
-	templateId := template.FileName
-	templateKey := templateId
-	templateBytes, err := services.DownloadFile("templates", templateKey)
+	templateBytes, renderOptions, err := services.LoadTemplate(s.DB, template)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching template: " + err.Error()})
-		//inserting post request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:                  id,
-			DocumentName:        id,
-			JsonPayload:         "",
-			Status:              "FAILED",
-			Method:              "POST",
-			DocumentDescription: "Error fetching template: " + err.Error(),
-			TemplateId:          "",
-			RefNumber:           request.RefNumber,
-			CreatedAt:           time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
-
-		//insert into failed generations table
-		if err := initializers.DB.Create(&models.FailedGenerations{
-			ID:           id,
-			DocumentName: id,
-			Description:  request.Description,
-			TemplateId:   templateId,
-			Status:       "FAILED",
-			Method:       "POST",
-			JsonPayload:  "",
-			RefNumber:    request.RefNumber,
-			CreatedAt:    currentTime,
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-		}
+		s.failGeneration(c, event, request, http.StatusInternalServerError, services.ErrorTemplateFetch, "Error fetching template: "+err.Error())
 		return
 	}
 
-	// Convert the map to a JSON string
+	// Compact the raw data to a JSON string
 	jsonString, err := json.Marshal(request.Data)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to convert data to JSON string: " + err.Error()})
+		s.failGeneration(c, event, request, http.StatusInternalServerError, services.ErrorInvalidRequest, "Failed to convert data to JSON string: "+err.Error())
 		return
 	}
+	event.JsonPayload = models.JSONPayload(jsonString)
 
-	data, err := services.DecodeJSON(string(jsonString))
+	data, keyOrder, err := services.DecodeOrderedJSON(string(jsonString))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON data: " + err.Error()})
+		s.failGeneration(c, event, request, http.StatusBadRequest, services.ErrorInvalidRequest, "Invalid JSON data: "+err.Error())
 		return
 	}
+	renderOptions.KeyOrder = keyOrder
 
-	htmlBeforePDF, err := services.GeneratePDF2(templateBytes, data)
+	renderOptions.Locales, err = services.LocaleChain(request.Locale, request.FallbackLocales, template.DefaultLocale)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error generating PDF: " + err.Error()})
-		//inserting post request into logs table
-		if err := initializers.DB.Create(&models.Logs{
-			ID:                  id,
-			DocumentName:        id,
-			JsonPayload:         string(jsonString),
-			Status:              "FAILED",
-			Method:              "POST",
-			DocumentDescription: request.Description,
-			TemplateId:          templateId,
-			RefNumber:           request.RefNumber,
-			CreatedAt:           time.Now(),
-		}).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving document metadata in database: " + err.Error()})
-			return
-		}
+		s.failGeneration(c, event, request, http.StatusBadRequest, services.ErrorInvalidRequest, err.Error())
+		return
+	}
+
+	htmlBeforePDF, err := services.GeneratePDF2(templateBytes, data, renderOptions)
+	if err != nil {
+		s.failGeneration(c, event, request, http.StatusInternalServerError, services.ErrorRenderFailed, "Error generating PDF: "+err.Error())
+		return
 	}
 
 	fmt.Printf("---------------------------------------------")
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type RetentionPolicyRequest struct {
+	Entity            string `json:"entity"`
+	TemplateRefNumber string `json:"templateRefNumber"`
+	RetainDays        int    `json:"retainDays"`
+}
+
+type LegalHoldRequest struct {
+	Hold   bool   `json:"hold"`
+	Reason string `json:"reason"`
+}
+
+// RetentionPolicies lists the retention policies
+func (s *Server) RetentionPolicies(c *gin.Context) {
+	policies, err := services.RetentionPolicies(s.DB)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching retention policies: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": policies, "timestamp": time.Now()})
+}
+
+// SaveRetentionPolicy creates or replaces the retention policy of an entity, or of one template's documents
+func (s *Server) SaveRetentionPolicy(c *gin.Context) {
+	var request RetentionPolicyRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid retention policy: " + err.Error()})
+		return
+	}
+
+	policy := models.RetentionPolicy{Entity: request.Entity, RetainDays: request.RetainDays}
+	if request.TemplateRefNumber != "" {
+		template, err := s.Templates.ByRefNumber(request.TemplateRefNumber)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+			return
+		}
+		policy.TemplateId = template.ID
+	}
+	if err := services.ValidateRetentionPolicy(policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	policy, err := services.SaveRetentionPolicy(s.DB, policy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving retention policy: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": policy, "timestamp": policy.UpdatedAt})
+	s.audit(c, models.AuditEvent{
+		EventType:   services.EventRetentionChanged,
+		TargetType:  "retention_policy",
+		TargetId:    policy.ID,
+		TemplateId:  policy.TemplateId,
+		Description: policy.Entity + " kept for " + strconv.Itoa(policy.RetainDays) + " days",
+	})
+}
+
+// DeleteRetentionPolicy removes a retention policy, so its rows are kept from then on
+func (s *Server) DeleteRetentionPolicy(c *gin.Context) {
+	err := services.DeleteRetentionPolicy(s.DB, c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Retention policy not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting retention policy: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "Retention policy deleted successfully", "timestamp": time.Now()})
+	s.audit(c, models.AuditEvent{EventType: services.EventRetentionChanged, TargetType: "retention_policy", TargetId: c.Param("id"), Description: "policy deleted"})
+}
+
+// RunRetention applies the retention policies now; dryRun=true reports what would be removed
+func (s *Server) RunRetention(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dryRun"))
+	report, err := services.RunRetention(s.DB, "manual", dryRun)
+	if errors.Is(err, services.ErrLeaseHeld) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		s.auditFailure(c, models.AuditEvent{EventType: services.EventRetentionPurged, TargetType: "purge_run"}, services.ErrorRunInProgress, err.Error())
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error applying retention policies: " + err.Error(), "report": report})
+		s.auditFailure(c, models.AuditEvent{EventType: services.EventRetentionPurged, TargetType: "purge_run", TargetId: report.ID}, services.ErrorDatabaseFailed, err.Error())
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": report, "timestamp": time.Now()})
+	if !dryRun {
+		s.audit(c, models.AuditEvent{EventType: services.EventRetentionPurged, TargetType: "purge_run", TargetId: report.ID})
+	}
+}
+
+// PurgeRuns lists the latest retention runs
+func (s *Server) PurgeRuns(c *gin.Context) {
+	runs, err := services.PurgeRuns(s.DB, services.DefaultPageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching retention runs: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": runs, "timestamp": time.Now()})
+}
+
+// PurgeRunReport returns the report of a retention run
+func (s *Server) PurgeRunReport(c *gin.Context) {
+	report, err := services.PurgeRunReport(s.DB, c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Retention run not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching retention run: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": report, "timestamp": time.Now()})
+}
+
+// SetLegalHold places a document under legal hold, exempting it from retention and deletion, or releases it
+func (s *Server) SetLegalHold(c *gin.Context) {
+	document, err := s.Documents.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Document not found"})
+		return
+	}
+
+	var request LegalHoldRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid legal hold: " + err.Error()})
+		return
+	}
+
+	document, err = services.SetLegalHold(s.DB, document, request.Hold, request.Reason)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving legal hold: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": document, "timestamp": time.Now()})
+	description := "legal hold released"
+	if request.Hold {
+		description = "legal hold placed: " + request.Reason
+	}
+	s.audit(c, models.AuditEvent{
+		EventType:   services.EventLegalHoldChanged,
+		TargetType:  "document",
+		TargetId:    document.ID,
+		TemplateId:  document.TemplateId,
+		RefNumber:   document.RefNumber,
+		Description: description,
+	})
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadRevision stores new content for a template as a draft revision and compares its sample renders with the goldens.
+// Generation keeps using the published revision until the new one is reviewed and published.
+func (s *Server) UploadRevision(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("template")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to retrieve file: " + err.Error()})
+		return
+	}
+	defer file.Close()
+
+	format, err := services.DetectTemplateFormat(c.PostForm("format"), header.Filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	templateFormat := template.Format
+	if templateFormat == "" {
+		templateFormat = services.FormatHTML
+	}
+	if format != templateFormat {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Revision is " + format + " but template " + template.RefNumber + " is " + templateFormat})
+		return
+	}
+
+	templateBytes, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading file: " + err.Error()})
+		return
+	}
+	// bundle assets belong to the template, a revision only replaces its content
+	if format != services.FormatDocx && services.IsZipArchive(templateBytes) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Revisions replace the template content only, upload index.html without the bundle"})
+		return
+	}
+
+	lint := services.LintTemplate(format, templateBytes, nil)
+	if lint.Errors > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid template", "lint": lint})
+		return
+	}
+	if force, _ := strconv.ParseBool(c.PostForm("force")); lint.Warnings > 0 && !force {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Template has lint warnings, upload again with force=true to store it anyway", "lint": lint})
+		return
+	}
+
+	if err := services.CheckPartialReferences(s.DB, format, templateBytes); err != nil {
+		respondPartialError(c, err)
+		return
+	}
+
+	revision, report, err := services.CreateRevision(s.DB, template, templateBytes, authenticatedActor(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving revision: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": revision, "report": report, "lint": lint, "timestamp": revision.CreatedAt})
+}
+
+// TemplateRevisions lists the revisions of a template, newest first
+func (s *Server) TemplateRevisions(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	revisions, err := services.TemplateRevisions(s.DB, template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching revisions: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": revisions, "timestamp": time.Now()})
+}
+
+// PublishRevision makes an approved revision the one used for generation.
+// A revision whose renders differ from the goldens beyond the threshold is refused unless acceptChanges=true.
+func (s *Server) PublishRevision(c *gin.Context) {
+	template, revision, ok := s.findRevision(c)
+	if !ok {
+		return
+	}
+
+	var request WorkflowRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	acceptChanges, _ := strconv.ParseBool(c.Query("acceptChanges"))
+	template, err := services.PublishRevision(s.DB, template, revision, acceptChanges, authenticatedActor(c), request.Comment)
+	if errors.Is(err, services.ErrRevisionBlocked) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error() + ", publish with acceptChanges=true to approve the changes", "report": revision.Report})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error publishing revision: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": template, "revision": revision.Revision, "timestamp": time.Now()})
+}
+
+// findRevision loads the template and revision named in the path, answering 404 when either is missing
+func (s *Server) findRevision(c *gin.Context) (models.Template, models.TemplateRevision, bool) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return template, models.TemplateRevision{}, false
+	}
+
+	number, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid revision number"})
+		return template, models.TemplateRevision{}, false
+	}
+
+	revision, err := s.Templates.Revision(template.ID, number)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Revision not found"})
+		return template, revision, false
+	}
+	return template, revision, true
+}
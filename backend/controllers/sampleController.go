@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SampleRequest struct {
+	Data   json.RawMessage `json:"data"`
+	Locale string          `json:"locale"`
+}
+
+type SampleRender struct {
+	Name     string `json:"name"`
+	Locale   string `json:"locale"`
+	Document string `json:"document,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// SaveSample creates or replaces a named sample payload of a template
+func (s *Server) SaveSample(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	var request SampleRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid sample: " + err.Error()})
+		return
+	}
+	if len(request.Data) == 0 || string(request.Data) == "null" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Sample data is required"})
+		return
+	}
+
+	locale := ""
+	if request.Locale != "" {
+		var err error
+		if locale, err = services.NormalizeLocale(request.Locale); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+
+	sample, err := services.SaveSample(s.DB, template.ID, c.Param("name"), request.Data, locale)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving sample: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": sample, "timestamp": sample.UpdatedAt})
+}
+
+// TemplateSamples lists the sample payloads of a template
+func (s *Server) TemplateSamples(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	samples, err := services.TemplateSamples(s.DB, template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching samples: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": samples, "timestamp": time.Now()})
+}
+
+// DeleteSample removes a sample payload and its golden render
+func (s *Server) DeleteSample(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	sample, err := s.Templates.Sample(template.ID, c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Sample not found"})
+		return
+	}
+
+	if err := services.DeleteSample(s.DB, sample); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting sample: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "Sample deleted successfully", "timestamp": time.Now()})
+}
+
+// RenderSamples renders every sample of a template with its active revision and diffs the results against the goldens
+func (s *Server) RenderSamples(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	samples, err := services.TemplateSamples(s.DB, template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching samples: " + err.Error()})
+		return
+	}
+
+	templateBytes, opts, err := services.LoadTemplate(s.DB, template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching template: " + err.Error()})
+		return
+	}
+
+	renders := make([]SampleRender, 0, len(samples))
+	for _, sample := range samples {
+		render := SampleRender{Name: sample.Name, Locale: sample.Locale}
+
+		data, keyOrder, err := services.DecodeOrderedJSON(sample.Data)
+		opts.KeyOrder = keyOrder
+		if err == nil {
+			opts.Locales, err = services.LocaleChain(sample.Locale, nil, template.DefaultLocale)
+		}
+		if err == nil {
+			if template.Format == services.FormatText {
+				render.Text, err = services.GenerateText(templateBytes, data, opts)
+			} else {
+				var document []byte
+				if document, err = services.GeneratePDF(templateBytes, data, opts); err == nil {
+					render.Document = base64.StdEncoding.EncodeToString(document)
+				}
+			}
+		}
+		if err != nil {
+			render.Error = err.Error()
+		}
+		renders = append(renders, render)
+	}
+
+	report, err := services.CompareSamples(s.DB, template, templateBytes, opts)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error comparing samples: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"samples": renders, "report": report}, "timestamp": time.Now()})
+}
+
+// RecordGoldens stores the current renders of a template's samples as the goldens new revisions are compared against
+func (s *Server) RecordGoldens(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	samples, err := services.TemplateSamples(s.DB, template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching samples: " + err.Error()})
+		return
+	}
+	if len(samples) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Template " + template.RefNumber + " has no samples"})
+		return
+	}
+
+	samples, err = services.RecordGoldens(s.DB, template, samples)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error recording goldens: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": samples, "timestamp": time.Now()})
+}
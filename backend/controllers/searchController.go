@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SearchPathsRequest struct {
+	Paths []string `json:"paths"`
+}
+
+// SearchDocuments finds documents by description, payload values and template name, best matches first
+func (s *Server) SearchDocuments(c *gin.Context) {
+	search := strings.TrimSpace(c.Query("q"))
+	if search == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Search query q is required"})
+		return
+	}
+	list, err := listQuery(c, services.DocumentSearchList)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	matches, total, err := services.SearchDocuments(s.DB, search, list)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error searching documents: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": matches, "pagination": listPage(c, list, total), "timestamp": time.Now()})
+}
+
+// ReindexDocuments rebuilds the search index of every document, or of one template's documents with templateId
+func (s *Server) ReindexDocuments(c *gin.Context) {
+	indexed, err := services.ReindexDocuments(s.DB, c.Query("templateId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error indexing documents: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"indexed": indexed}, "timestamp": time.Now()})
+}
+
+// TemplateSearchPaths lists the payload paths searched in a template's documents
+func (s *Server) TemplateSearchPaths(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	paths, err := services.SearchPaths(s.DB, template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching search paths: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": paths, "timestamp": time.Now()})
+}
+
+// SaveSearchPaths replaces the payload paths searched in a template's documents and reindexes them
+func (s *Server) SaveSearchPaths(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	var request SearchPathsRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid search paths: " + err.Error()})
+		return
+	}
+	for _, path := range request.Paths {
+		if _, err := services.ValidateSearchPath(path); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+
+	indexed, err := services.SaveSearchPaths(s.DB, template.ID, request.Paths)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving search paths: " + err.Error()})
+		return
+	}
+	paths, err := services.SearchPaths(s.DB, template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching search paths: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": paths, "indexed": indexed, "timestamp": time.Now()})
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"example/pdfgenerator/repository"
+
+	"gorm.io/gorm"
+)
+
+// Server holds the repositories the handlers read and write through, so tests can run them on in-memory fakes,
+// and the database the services it calls work on
+type Server struct {
+	DB           *gorm.DB
+	Templates    repository.TemplateRepository
+	Documents    repository.DocumentRepository
+	Audit        repository.AuditRepository
+	Failures     repository.FailureRepository
+	PartialStore repository.PartialRepository
+}
+
+// NewServer returns a server whose repositories use a database
+func NewServer(db *gorm.DB) *Server {
+	return &Server{
+		DB:           db,
+		Templates:    repository.NewTemplateRepository(db),
+		Documents:    repository.NewDocumentRepository(db),
+		Audit:        repository.NewAuditRepository(db),
+		Failures:     repository.NewFailureRepository(db),
+		PartialStore: repository.NewPartialRepository(db),
+	}
+}
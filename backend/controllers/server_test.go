@@ -0,0 +1,464 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository/memory"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// testServer runs the handlers on in-memory repositories
+type testServer struct {
+	templates *memory.Templates
+	documents *memory.Documents
+	auditLog  *memory.Audit
+	failures  *memory.Failures
+	partials  *memory.Partials
+	router    *gin.Engine
+}
+
+func newTestServer() *testServer {
+	gin.SetMode(gin.TestMode)
+	ts := &testServer{templates: &memory.Templates{}, documents: &memory.Documents{}, auditLog: &memory.Audit{}, failures: &memory.Failures{}, partials: &memory.Partials{}}
+	server := &Server{Templates: ts.templates, Documents: ts.documents, Audit: ts.auditLog, Failures: ts.failures, PartialStore: ts.partials}
+
+	ts.router = gin.New()
+	ts.router.Use(RequestID(), Authenticate([]APIToken{{Name: "tester", Token: "test-token"}}))
+	ts.router.POST("/generate", server.CreateDocument)
+	ts.router.POST("/htmlbeforepdf", server.HtmlBeforePDF)
+	ts.router.GET("/documents", server.GetDocuments)
+	ts.router.GET("/documents/preview/:refNumber", server.PreviewDocument)
+	ts.router.GET("/document-history", server.GetDocumentHistory)
+	ts.router.GET("/logs", server.AutodocsLogs)
+	ts.router.GET("/daterange-metrics", server.GetRangeMetrics)
+	ts.router.GET("/failed-generations", server.GetFailedGenerations)
+	ts.router.DELETE("/templates/:refNumber", server.DeleteTemplate)
+	ts.router.GET("/verify/:token", server.VerifyDocument)
+	ts.router.GET("/templates/:refNumber/preview", server.PreviewTemplate)
+	// findRevision answers the lookups of the workflow steps, which go on to write to the database
+	ts.router.GET("/templates/:refNumber/revisions/:revision", func(c *gin.Context) {
+		if _, revision, ok := server.findRevision(c); ok {
+			c.JSON(http.StatusOK, revision)
+		}
+	})
+	ts.router.DELETE("/templates/:refNumber/translations/:locale", server.DeleteTranslations)
+	ts.router.GET("/partials", server.Partials)
+	ts.router.GET("/partials/:name/versions", server.PartialVersions)
+	return ts
+}
+
+// do sends a request and decodes the JSON response into out, when given
+func (ts *testServer) do(t *testing.T, method, path, body string, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer test-token")
+	response := httptest.NewRecorder()
+	ts.router.ServeHTTP(response, request)
+	if out != nil {
+		if err := json.Unmarshal(response.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, response.Body.String(), err)
+		}
+	}
+	return response
+}
+
+// lastEvent returns the latest audit event, failing the test when there is none
+func (ts *testServer) lastEvent(t *testing.T) models.AuditEvent {
+	t.Helper()
+	if len(ts.auditLog.Events) == 0 {
+		t.Fatal("no audit event recorded")
+	}
+	return ts.auditLog.Events[len(ts.auditLog.Events)-1]
+}
+
+func TestGetDocumentsPages(t *testing.T) {
+	ts := newTestServer()
+	now := time.Now()
+	for i, refNumber := range []string{"DOC-1", "DOC-2", "DOC-3"} {
+		ts.documents.Rows = append(ts.documents.Rows, models.Document{ID: refNumber, RefNumber: refNumber, VerificationToken: "secret-" + refNumber, CreatedAt: now.Add(time.Duration(i) * time.Minute)})
+	}
+
+	var body struct {
+		Data       []models.Document `json:"data"`
+		Pagination services.Page     `json:"pagination"`
+	}
+	response := ts.do(t, http.MethodGet, "/documents?limit=2&templateId=T-1&data.customer.id=7", "", &body)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", response.Code, response.Body)
+	}
+	if len(body.Data) != 2 || body.Data[0].RefNumber != "DOC-3" {
+		t.Errorf("got %d documents starting with %q, want 2 newest first", len(body.Data), body.Data[0].RefNumber)
+	}
+	if body.Pagination.Total != 3 || body.Pagination.Sort != "-createdAt" || body.Pagination.Next == "" {
+		t.Errorf("unexpected pagination %+v", body.Pagination)
+	}
+	if list := ts.documents.LastList; list.Filters["templateId"] != "T-1" || list.Data["customer.id"] != "7" {
+		t.Errorf("filters not passed to the repository: %+v", list)
+	}
+	if strings.Contains(response.Body.String(), "secret-") {
+		t.Error("the document list exposes verification tokens")
+	}
+}
+
+func TestGetDocumentsRejectsInvalidLimit(t *testing.T) {
+	ts := newTestServer()
+	if response := ts.do(t, http.MethodGet, "/documents?limit=0", "", nil); response.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", response.Code)
+	}
+}
+
+func TestGetDocumentsRepositoryError(t *testing.T) {
+	ts := newTestServer()
+	ts.documents.Err = errors.New("connection refused")
+	if response := ts.do(t, http.MethodGet, "/documents", "", nil); response.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", response.Code)
+	}
+}
+
+func TestPreviewDocumentNotFound(t *testing.T) {
+	ts := newTestServer()
+	ts.documents.Rows = []models.Document{{ID: "1", RefNumber: "DOC-1", DeletedAt: gormDeleted()}}
+
+	if response := ts.do(t, http.MethodGet, "/documents/preview/DOC-1", "", nil); response.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404 for a deleted document", response.Code)
+	}
+	event := ts.lastEvent(t)
+	if event.EventType != services.EventDocumentViewed || event.ErrorCode != services.ErrorDocumentNotFound || event.Outcome != services.AuditFailed {
+		t.Errorf("unexpected audit event %+v", event)
+	}
+	if event.Actor != "tester" || event.RequestId == "" || event.StatusCode != http.StatusNotFound {
+		t.Errorf("request details missing from audit event %+v", event)
+	}
+}
+
+func TestAuditIgnoresClaimedActor(t *testing.T) {
+	ts := newTestServer()
+	request := httptest.NewRequest(http.MethodGet, "/documents/preview/DOC-1", nil)
+	request.Header.Set("X-Actor", "mallory")
+	ts.router.ServeHTTP(httptest.NewRecorder(), request)
+
+	if event := ts.lastEvent(t); event.Actor != services.AnonymousActor {
+		t.Errorf("anonymous request recorded as %q", event.Actor)
+	}
+}
+
+func TestCreateDocumentUnknownTemplate(t *testing.T) {
+	ts := newTestServer()
+
+	response := ts.do(t, http.MethodPost, "/generate", `{"refNumber": "TPL-404", "description": "invoice", "data": {"total": 12}}`, nil)
+	if response.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", response.Code)
+	}
+	if len(ts.failures.Rows) != 1 {
+		t.Fatalf("got %d failed generations, want 1", len(ts.failures.Rows))
+	}
+	if failure := ts.failures.Rows[0]; failure.RefNumber != "TPL-404" || failure.Description != "invoice" || failure.Status != services.AuditFailed {
+		t.Errorf("unexpected failed generation %+v", failure)
+	}
+	if event := ts.lastEvent(t); event.ErrorCode != services.ErrorTemplateNotFound || event.RefNumber != "TPL-404" {
+		t.Errorf("unexpected audit event %+v", event)
+	}
+}
+
+func TestCreateDocumentRefusedTemplates(t *testing.T) {
+	ts := newTestServer()
+	ts.templates.Rows = []models.Template{
+		{ID: "1", RefNumber: "TPL-TXT", Format: services.FormatText, Status: services.TemplateActive},
+		{ID: "2", RefNumber: "TPL-DRAFT", Format: services.FormatHTML, Status: services.TemplateDraft},
+	}
+
+	tests := []struct {
+		refNumber string
+		status    int
+		code      string
+	}{
+		{"TPL-TXT", http.StatusBadRequest, services.ErrorInvalidRequest},
+		{"TPL-DRAFT", http.StatusConflict, services.ErrorNotPublished},
+	}
+	for i, test := range tests {
+		response := ts.do(t, http.MethodPost, "/generate", `{"refNumber": "`+test.refNumber+`", "data": {}}`, nil)
+		if response.Code != test.status {
+			t.Errorf("%s: status %d, want %d", test.refNumber, response.Code, test.status)
+		}
+		if event := ts.lastEvent(t); event.ErrorCode != test.code || event.TemplateId != ts.templates.Rows[i].ID {
+			t.Errorf("%s: unexpected audit event %+v", test.refNumber, event)
+		}
+	}
+	if len(ts.failures.Rows) != 2 {
+		t.Errorf("got %d failed generations, want 2", len(ts.failures.Rows))
+	}
+}
+
+func TestHtmlBeforePDFRejectsTextTemplates(t *testing.T) {
+	ts := newTestServer()
+	ts.templates.Rows = []models.Template{
+		{ID: "1", RefNumber: "TPL-TXT", Format: services.FormatText},
+		{ID: "2", RefNumber: "TPL-DOCX", Format: services.FormatDocx},
+	}
+
+	for _, refNumber := range []string{"TPL-TXT", "TPL-DOCX"} {
+		response := ts.do(t, http.MethodPost, "/htmlbeforepdf", `{"refNumber": "`+refNumber+`", "data": {}}`, nil)
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", refNumber, response.Code)
+		}
+	}
+	if len(ts.failures.Rows) != 2 {
+		t.Errorf("got %d failed generations, want 2", len(ts.failures.Rows))
+	}
+}
+
+func TestCreateDocumentInvalidRequest(t *testing.T) {
+	ts := newTestServer()
+
+	if response := ts.do(t, http.MethodPost, "/generate", `not json`, nil); response.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", response.Code)
+	}
+	if len(ts.failures.Rows) != 1 {
+		t.Errorf("got %d failed generations, want 1", len(ts.failures.Rows))
+	}
+	if event := ts.lastEvent(t); event.ErrorCode != services.ErrorInvalidRequest {
+		t.Errorf("unexpected audit event %+v", event)
+	}
+}
+
+func TestDeleteTemplateNotFound(t *testing.T) {
+	ts := newTestServer()
+	ts.templates.Rows = []models.Template{{ID: "1", RefNumber: "TPL-1"}}
+
+	if response := ts.do(t, http.MethodDelete, "/templates/TPL-2", "", nil); response.Code != http.StatusNotFound {
+		t.Errorf("status %d, want 404", response.Code)
+	}
+}
+
+func TestVerifyDocumentUnknownToken(t *testing.T) {
+	ts := newTestServer()
+	ts.documents.Rows = []models.Document{{ID: "1", RefNumber: "DOC-1", VerificationToken: "known"}}
+
+	if response := ts.do(t, http.MethodGet, "/verify/unknown", "", nil); response.Code != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", response.Code)
+	}
+	if event := ts.lastEvent(t); event.ErrorCode != services.ErrorVerificationToken {
+		t.Errorf("unexpected audit event %+v", event)
+	}
+}
+
+func TestGetRangeMetrics(t *testing.T) {
+	ts := newTestServer()
+	inRange := time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC)
+	outOfRange := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+	ts.templates.Rows = []models.Template{{ID: "1", CreatedAt: inRange}, {ID: "2", CreatedAt: outOfRange}}
+	for i := 0; i < 4; i++ {
+		ts.documents.Rows = append(ts.documents.Rows, models.Document{ID: string(rune('a' + i)), CreatedAt: inRange})
+	}
+	ts.documents.Rows = append(ts.documents.Rows, models.Document{ID: "e", CreatedAt: outOfRange})
+	ts.failures.Rows = []models.FailedGenerations{{ID: "1", CreatedAt: inRange}}
+
+	var body struct {
+		Data struct {
+			TotalTemplates    int64   `json:"totalTemplates"`
+			TotalDocuments    int64   `json:"totalDocuments"`
+			FailedGenerations int64   `json:"failedGenerations"`
+			GenerationRate    float64 `json:"generationRate"`
+			FailureRate       float64 `json:"failureRate"`
+		} `json:"data"`
+	}
+	response := ts.do(t, http.MethodGet, "/daterange-metrics?startDate=2024-03-01&endDate=2024-03-05", "", &body)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", response.Code, response.Body)
+	}
+	metrics := body.Data
+	if metrics.TotalTemplates != 1 || metrics.TotalDocuments != 4 || metrics.FailedGenerations != 1 {
+		t.Errorf("unexpected counts %+v", metrics)
+	}
+	if metrics.GenerationRate != 1 || metrics.FailureRate != 25 {
+		t.Errorf("unexpected rates %+v", metrics)
+	}
+}
+
+func TestGetRangeMetricsInvalidDate(t *testing.T) {
+	ts := newTestServer()
+
+	if response := ts.do(t, http.MethodGet, "/daterange-metrics?startDate=yesterday&endDate=2024-03-05", "", nil); response.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400", response.Code)
+	}
+	if event := ts.lastEvent(t); event.EventType != services.EventMetricsViewed || event.ErrorCode != services.ErrorInvalidDate {
+		t.Errorf("unexpected audit event %+v", event)
+	}
+}
+
+func TestGetDocumentHistory(t *testing.T) {
+	ts := newTestServer()
+	now := time.Now()
+	ts.documents.Rows = []models.Document{{ID: "1", CreatedAt: now}, {ID: "2", CreatedAt: now}}
+
+	var body struct {
+		Data []struct {
+			Date  string `json:"date"`
+			Count int    `json:"count"`
+		} `json:"data"`
+	}
+	response := ts.do(t, http.MethodGet, "/document-history", "", &body)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", response.Code, response.Body)
+	}
+	if len(body.Data) != 7 {
+		t.Fatalf("got %d days, want 7", len(body.Data))
+	}
+	total := 0
+	for _, day := range body.Data {
+		total += day.Count
+	}
+	if today := body.Data[6]; today.Date != now.Weekday().String() || total != 2 {
+		t.Errorf("got today %+v and %d documents, want %s last and 2 documents", today, total, now.Weekday())
+	}
+}
+
+func TestAutodocsLogsPassesFilters(t *testing.T) {
+	ts := newTestServer()
+	ts.auditLog.Events = []models.AuditEvent{{ID: "1", EventType: services.EventDocumentGenerated, CreatedAt: time.Now()}}
+
+	var body struct {
+		Data []models.AuditEvent `json:"data"`
+	}
+	response := ts.do(t, http.MethodGet, "/logs?status=FAILED&eventType=document.generated&sort=createdAt", "", &body)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", response.Code, response.Body)
+	}
+	list := ts.auditLog.LastList
+	if list.Filters["status"] != "FAILED" || list.Filters["eventType"] != services.EventDocumentGenerated || list.Desc {
+		t.Errorf("unexpected list query %+v", list)
+	}
+	if len(body.Data) != 1 {
+		t.Errorf("got %d events, want 1", len(body.Data))
+	}
+}
+
+func TestGetFailedGenerationsRejectsUnknownSort(t *testing.T) {
+	ts := newTestServer()
+	if response := ts.do(t, http.MethodGet, "/failed-generations?sort=size", "", nil); response.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", response.Code)
+	}
+}
+
+// gormDeleted marks a row soft-deleted
+func gormDeleted() gorm.DeletedAt {
+	return gorm.DeletedAt{Time: time.Now(), Valid: true}
+}
+
+func TestPreviewTemplateRevision(t *testing.T) {
+	ts := newTestServer()
+	objects := &memory.Objects{}
+	previous := services.Objects
+	services.Objects = objects
+	t.Cleanup(func() { services.Objects = previous })
+
+	ts.templates.Rows = []models.Template{{ID: "T-1", RefNumber: "TPL-1", FileName: "T-1"}}
+	ts.templates.Revisions = []models.TemplateRevision{{
+		TemplateId: "T-1", Revision: 2, FileName: "revisions/R-2", Status: services.RevisionDraft,
+		Changes: &models.RevisionChanges{Assets: []models.TemplateAsset{{Path: "logo.png"}}},
+	}}
+	if err := objects.Put("templates", "revisions/R-2", strings.NewReader("<p>draft</p>"), "text/html"); err != nil {
+		t.Fatal(err)
+	}
+
+	var body struct {
+		Data   []byte                 `json:"data"`
+		Assets []models.TemplateAsset `json:"assets"`
+	}
+	response := ts.do(t, http.MethodGet, "/templates/TPL-1/preview?revision=2", "", &body)
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", response.Code, response.Body)
+	}
+	if string(body.Data) != "<p>draft</p>" || len(body.Assets) != 1 || body.Assets[0].Path != "logo.png" {
+		t.Errorf("previewed %q with %+v, want the draft and its assets", body.Data, body.Assets)
+	}
+
+	for path, status := range map[string]int{
+		"/templates/TPL-1/preview?revision=3":   http.StatusNotFound,
+		"/templates/TPL-1/preview?revision=two": http.StatusBadRequest,
+	} {
+		if response := ts.do(t, http.MethodGet, path, "", nil); response.Code != status {
+			t.Errorf("%s: status %d, want %d", path, response.Code, status)
+		}
+	}
+}
+
+func TestFindRevision(t *testing.T) {
+	ts := newTestServer()
+	ts.templates.Rows = []models.Template{{ID: "T-1", RefNumber: "TPL-1"}}
+	ts.templates.Revisions = []models.TemplateRevision{{ID: "R-1", TemplateId: "T-1", Revision: 1, Status: services.RevisionPublished}}
+
+	var revision models.TemplateRevision
+	if response := ts.do(t, http.MethodGet, "/templates/TPL-1/revisions/1", "", &revision); response.Code != http.StatusOK || revision.ID != "R-1" {
+		t.Fatalf("status %d, revision %+v", response.Code, revision)
+	}
+	for path, status := range map[string]int{
+		"/templates/TPL-1/revisions/2":   http.StatusNotFound,
+		"/templates/TPL-1/revisions/one": http.StatusBadRequest,
+		"/templates/TPL-2/revisions/1":   http.StatusNotFound,
+	} {
+		if response := ts.do(t, http.MethodGet, path, "", nil); response.Code != status {
+			t.Errorf("%s: status %d, want %d: %s", path, response.Code, status, response.Body)
+		}
+	}
+}
+
+func TestDeleteTranslations(t *testing.T) {
+	ts := newTestServer()
+	ts.templates.Rows = []models.Template{{ID: "T-1", RefNumber: "TPL-1"}}
+	ts.templates.Translations = []models.TranslationCatalog{{TemplateId: "T-1", Locale: "en"}, {TemplateId: "T-1", Locale: "de"}}
+
+	if response := ts.do(t, http.MethodDelete, "/templates/TPL-1/translations/de", "", nil); response.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", response.Code, response.Body)
+	}
+	if len(ts.templates.Translations) != 1 || ts.templates.Translations[0].Locale != "en" {
+		t.Errorf("translations left: %+v", ts.templates.Translations)
+	}
+	if response := ts.do(t, http.MethodDelete, "/templates/TPL-1/translations/de", "", nil); response.Code != http.StatusNotFound {
+		t.Errorf("second delete: status %d, want 404", response.Code)
+	}
+}
+
+func TestPartials(t *testing.T) {
+	ts := newTestServer()
+	ts.partials.Rows = []models.Partial{
+		{ID: "1", Name: "header", Version: 1},
+		{ID: "2", Name: "header", Version: 2},
+		{ID: "3", Name: "footer", Version: 1},
+		{ID: "4", Name: "legacy", Version: 1, DeletedAt: gormDeleted()},
+	}
+
+	var latest struct {
+		Data []models.Partial `json:"data"`
+	}
+	if response := ts.do(t, http.MethodGet, "/partials", "", &latest); response.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", response.Code, response.Body)
+	}
+	if len(latest.Data) != 2 || latest.Data[0].Name != "footer" || latest.Data[1].ID != "2" {
+		t.Errorf("latest partials %+v, want footer and header version 2", latest.Data)
+	}
+
+	var versions struct {
+		Data []models.Partial `json:"data"`
+	}
+	if response := ts.do(t, http.MethodGet, "/partials/header/versions", "", &versions); response.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", response.Code, response.Body)
+	}
+	if len(versions.Data) != 2 || versions.Data[0].Version != 2 {
+		t.Errorf("header versions %+v, want 2 newest first", versions.Data)
+	}
+	if response := ts.do(t, http.MethodGet, "/partials/legacy/versions", "", nil); response.Code != http.StatusNotFound {
+		t.Errorf("deleted partial: status %d, want 404", response.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// StorageOperations lists the storage operations waiting in the outbox
+func (s *Server) StorageOperations(c *gin.Context) {
+	operations, err := services.StorageOperations(s.DB, services.MaxPageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching the storage outbox: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": operations, "timestamp": time.Now()})
+}
+
+// Reconcile compares the database with object storage and reports what does not match; confirm=true fixes it too
+func (s *Server) Reconcile(c *gin.Context) {
+	confirm, _ := strconv.ParseBool(c.Query("confirm"))
+	dryRun := !confirm
+	report, err := services.Reconcile(s.DB, "manual", dryRun)
+	if errors.Is(err, services.ErrLeaseHeld) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		s.auditFailure(c, models.AuditEvent{EventType: services.EventStorageReconciled, TargetType: "reconcile_run"}, services.ErrorRunInProgress, err.Error())
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reconciling storage: " + err.Error(), "report": report})
+		s.auditFailure(c, models.AuditEvent{EventType: services.EventStorageReconciled, TargetType: "reconcile_run", TargetId: report.ID}, services.ErrorStorageFailed, err.Error())
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": report, "timestamp": time.Now()})
+	if !dryRun {
+		s.audit(c, models.AuditEvent{EventType: services.EventStorageReconciled, TargetType: "reconcile_run", TargetId: report.ID})
+	}
+}
+
+// ReconcileRuns lists the latest reconcile runs
+func (s *Server) ReconcileRuns(c *gin.Context) {
+	runs, err := services.ReconcileRuns(s.DB, services.DefaultPageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching reconcile runs: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": runs, "timestamp": time.Now()})
+}
+
+// ReconcileRunReport returns the report of a reconcile run
+func (s *Server) ReconcileRunReport(c *gin.Context) {
+	report, err := services.ReconcileRunReport(s.DB, c.Param("id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Reconcile run not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching reconcile run: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": report, "timestamp": time.Now()})
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GenerateText fills a plain-text or Markdown template and returns the text, e.g. for SMS and email bodies
+func (s *Server) GenerateText(c *gin.Context) {
+	var request GenerateRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	template, err := s.Templates.ByRefNumber(request.RefNumber)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found for refNumber: " + request.RefNumber})
+		return
+	}
+
+	if template.Format != services.FormatText && template.Format != services.FormatMarkdown {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Template " + template.RefNumber + " is not a text or Markdown template"})
+		return
+	}
+
+	if err := services.GenerationAllowed(template); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+
+	templateBytes, renderOptions, err := services.LoadTemplate(s.DB, template)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching template: " + err.Error()})
+		return
+	}
+
+	jsonString, err := json.Marshal(request.Data)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to convert data to JSON string: " + err.Error()})
+		return
+	}
+
+	data, keyOrder, err := services.DecodeOrderedJSON(string(jsonString))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON data: " + err.Error()})
+		return
+	}
+	renderOptions.KeyOrder = keyOrder
+
+	renderOptions.Locales, err = services.LocaleChain(request.Locale, request.FallbackLocales, template.DefaultLocale)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	text, err := services.GenerateText(templateBytes, data, renderOptions)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Error filling template: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"refNumber": template.RefNumber, "format": template.Format, "text": text}, "timestamp": time.Now()})
+	s.audit(c, models.AuditEvent{
+		EventType:   services.EventTextGenerated,
+		TargetType:  "template",
+		TargetId:    template.ID,
+		TemplateId:  template.ID,
+		RefNumber:   template.RefNumber,
+		Description: request.Description,
+		JsonPayload: models.JSONPayload(jsonString),
+	})
+}
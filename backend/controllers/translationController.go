@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"example/pdfgenerator/repository"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SaveTranslations creates or replaces a template's catalog for one locale from a JSON object of key to string
+func (s *Server) SaveTranslations(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	locale, err := services.NormalizeLocale(c.Param("locale"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	var entries map[string]string
+	if err := c.BindJSON(&entries); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Translations must be a JSON object of key to string"})
+		return
+	}
+
+	catalog, err := services.SaveTranslations(s.DB, template.ID, locale, entries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error saving translations: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": gin.H{"locale": catalog.Locale, "entries": entries}, "timestamp": catalog.UpdatedAt})
+}
+
+// TemplateTranslations returns every catalog of a template keyed by locale
+func (s *Server) TemplateTranslations(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	translations, err := services.TemplateTranslations(s.DB, template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching translations: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": translations, "defaultLocale": template.DefaultLocale, "timestamp": time.Now()})
+}
+
+// DeleteTranslations removes a template's catalog for one locale
+func (s *Server) DeleteTranslations(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	locale, err := services.NormalizeLocale(c.Param("locale"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	err = s.Templates.DeleteTranslations(template.ID, locale)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "No translations for locale " + locale})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting translations: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "Translations deleted successfully", "timestamp": time.Now()})
+}
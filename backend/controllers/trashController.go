@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrashItems lists the deleted templates and documents with the date each is purged
+func (s *Server) TrashItems(c *gin.Context) {
+	list, err := listQuery(c, services.TrashList)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	items, total, err := services.TrashItems(s.DB, list)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching the trash: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": items, "pagination": listPage(c, list, total), "timestamp": time.Now()})
+}
+
+// RestoreFromTrash brings a deleted template or document back by refNumber
+func (s *Server) RestoreFromTrash(c *gin.Context) {
+	refNumber := c.Param("refNumber")
+	event := models.AuditEvent{EventType: services.EventTrashRestored, RefNumber: refNumber}
+
+	item, err := services.RestoreFromTrash(s.DB, refNumber)
+	event.TargetType, event.TargetId, event.TemplateId, event.Description = item.Type, item.ID, item.TemplateId, item.Name
+	if errors.Is(err, services.ErrNotInTrash) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Nothing with refNumber " + refNumber + " in the trash"})
+		return
+	}
+	if errors.Is(err, services.ErrNotRestorable) {
+		c.JSON(http.StatusConflict, gin.H{"message": refNumber + " was deleted before the trash existed and cannot be restored"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error restoring " + refNumber + ": " + err.Error()})
+		s.auditFailure(c, event, services.ErrorStorageFailed, err.Error())
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": item, "timestamp": time.Now()})
+	s.audit(c, event)
+}
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"net/http"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerificationResponse is the public view of a document, it must never carry the payload
+type VerificationResponse struct {
+	Issuer    string    `json:"issuer"`
+	RefNumber string    `json:"refNumber"`
+	IssuedAt  time.Time `json:"issuedAt"`
+	Sha256    string    `json:"sha256"`
+	Source    string    `json:"source"`
+	Matches   bool      `json:"matches"`
+}
+
+var verificationPage = template.Must(template.New("verify").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Document verification</title></head>
+<body style="font-family: sans-serif; max-width: 36em; margin: 2em auto;">
+{{if .Matches}}<h2 style="color: #15803d;">Authentic document</h2>{{else}}<h2 style="color: #b91c1c;">Document could not be verified</h2>{{end}}
+<p>Issuer: {{.Issuer}}</p>
+<p>Reference number: {{.RefNumber}}</p>
+<p>Issued on: {{.IssuedAt.Format "02 Jan 2006 15:04 MST"}}</p>
+<p>SHA-256: <code>{{.Sha256}}</code></p>
+</body>
+</html>`))
+
+// VerifyDocument checks the stored PDF for a verification token against its recorded hash
+func (s *Server) VerifyDocument(c *gin.Context) {
+	document, ok := s.findVerifiableDocument(c)
+	if !ok {
+		return
+	}
+
+	pdfBytes, err := services.DownloadFile("pdfs", document.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching document"})
+		return
+	}
+
+	s.respondVerification(c, document, "stored", services.HashPDF(pdfBytes) == document.Sha256)
+}
+
+// VerifyUploadedDocument checks an uploaded PDF against the hash recorded for a verification token
+func (s *Server) VerifyUploadedDocument(c *gin.Context) {
+	document, ok := s.findVerifiableDocument(c)
+	if !ok {
+		return
+	}
+
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to retrieve file: " + err.Error()})
+		return
+	}
+	defer file.Close()
+
+	pdfBytes, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reading file: " + err.Error()})
+		return
+	}
+
+	s.respondVerification(c, document, "upload", services.HashPDF(pdfBytes) == document.Sha256)
+}
+
+func (s *Server) findVerifiableDocument(c *gin.Context) (models.Document, bool) {
+	token := c.Param("token")
+
+	// an empty token would match documents generated before tokens existed
+	document, err := models.Document{}, repository.ErrNotFound
+	if token != "" {
+		document, err = s.Documents.ByVerificationToken(token)
+	}
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Document not found"})
+		s.auditFailure(c, models.AuditEvent{EventType: services.EventDocumentVerified, TargetType: "document"}, services.ErrorVerificationToken, "Verification token not found")
+		return document, false
+	}
+
+	return document, true
+}
+
+func (s *Server) respondVerification(c *gin.Context, document models.Document, source string, matches bool) {
+	response := VerificationResponse{
+		Issuer:    services.DocumentIssuer(),
+		RefNumber: document.RefNumber,
+		IssuedAt:  document.CreatedAt,
+		Sha256:    document.Sha256,
+		Source:    source,
+		Matches:   matches,
+	}
+
+	event := models.AuditEvent{
+		EventType:   services.EventDocumentVerified,
+		TargetType:  "document",
+		TargetId:    document.ID,
+		TemplateId:  document.TemplateId,
+		RefNumber:   document.RefNumber,
+		Description: "Document verification (" + source + ")",
+	}
+	if !matches {
+		event.ErrorCode = services.ErrorHashMismatch
+		event.Message = "Uploaded document does not match the issued one"
+	}
+	// recorded once the response is written, whichever form it takes
+	defer s.audit(c, event)
+
+	if c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML {
+		var page bytes.Buffer
+		if err := verificationPage.Execute(&page, response); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error rendering verification page"})
+			return
+		}
+		c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": response, "timestamp": time.Now()})
+}
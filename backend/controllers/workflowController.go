@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"example/pdfgenerator/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WorkflowRequest struct {
+	Comment string `json:"comment"`
+}
+
+type ReviewRequest struct {
+	Decision string `json:"decision"`
+	Comment  string `json:"comment"`
+}
+
+// SubmitRevision sends a draft revision to review
+func (s *Server) SubmitRevision(c *gin.Context) {
+	template, revision, ok := s.findRevision(c)
+	if !ok {
+		return
+	}
+
+	var request WorkflowRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+
+	revision, err := services.SubmitRevision(s.DB, revision, authenticatedActor(c), request.Comment)
+	if errors.Is(err, services.ErrInvalidTransition) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error submitting revision: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": revision, "refNumber": template.RefNumber, "timestamp": time.Now()})
+}
+
+// ReviewRevision approves or rejects a revision in review, with the reviewer's comment
+func (s *Server) ReviewRevision(c *gin.Context) {
+	template, revision, ok := s.findRevision(c)
+	if !ok {
+		return
+	}
+
+	var request ReviewRequest
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request: " + err.Error()})
+		return
+	}
+	if request.Decision != "approve" && request.Decision != "reject" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "decision must be approve or reject"})
+		return
+	}
+	if request.Decision == "reject" && request.Comment == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "a comment is required to reject a revision"})
+		return
+	}
+
+	revision, err := services.ReviewRevision(s.DB, revision, request.Decision == "approve", authenticatedActor(c), request.Comment)
+	if errors.Is(err, services.ErrInvalidTransition) || errors.Is(err, services.ErrSelfApproval) {
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error reviewing revision: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": revision, "refNumber": template.RefNumber, "timestamp": time.Now()})
+}
+
+// TemplateAuditTrail lists every workflow transition of a template's revisions, oldest first
+func (s *Server) TemplateAuditTrail(c *gin.Context) {
+	template, err := s.Templates.ByRefNumber(c.Param("refNumber"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Template not found"})
+		return
+	}
+
+	transitions, err := services.TemplateTransitions(s.DB, template.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching audit trail: " + err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, gin.H{"code": 200, "data": transitions, "timestamp": time.Now()})
+}
@@ -0,0 +1,42 @@
+package initializers
+
+import (
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CopyLegacyLogs copies the request logs written before the audit log into it, once, while the audit log is still empty.
+// The copies get their own IDs, as the old rows shared theirs with documents and templates.
+func CopyLegacyLogs() error {
+	var events int64
+	if err := DB.Model(&models.AuditEvent{}).Count(&events).Error; err != nil || events > 0 {
+		return err
+	}
+
+	var logs []models.Logs
+	return DB.Unscoped().Order("created_at").FindInBatches(&logs, 500, func(tx *gorm.DB, batch int) error {
+		copies := make([]models.AuditEvent, len(logs))
+		for i, entry := range logs {
+			outcome := entry.Status
+			if outcome == "" {
+				outcome = "SUCCESS"
+			}
+			copies[i] = models.AuditEvent{
+				ID:          uuid.New().String(),
+				EventType:   "legacy",
+				Method:      entry.Method,
+				TargetId:    entry.DocumentName,
+				TemplateId:  entry.TemplateId,
+				RefNumber:   entry.RefNumber,
+				Description: entry.DocumentDescription,
+				Outcome:     outcome,
+				Message:     entry.LogDescription,
+				JsonPayload: entry.JsonPayload,
+				CreatedAt:   entry.CreatedAt,
+			}
+		}
+		return DB.Create(&copies).Error
+	}).Error
+}
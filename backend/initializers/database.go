@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 
 	"gorm.io/gorm"
@@ -15,6 +16,19 @@ var DB *gorm.DB
 
 func ConnectToDB() {
 	var err error
+
+	// DB_DRIVER=sqlite runs on a local database file instead of Postgres
+	switch driver := os.Getenv("DB_DRIVER"); driver {
+	case "", "postgres":
+	case "sqlite":
+		DB, err = ConnectSQLite(os.Getenv("SQLITE_PATH"))
+		if err != nil {
+			log.Printf("Failed to connect to database: %v", err)
+		}
+		return
+	default:
+		log.Fatalf("Unknown DB_DRIVER %q, use postgres or sqlite", driver)
+	}
 	// dsn := os.Getenv("DB")
 
 	dbHost := os.Getenv("DB_HOST")
@@ -36,24 +50,56 @@ func ConnectToDB() {
 
 }
 
-func MigrateDB() {
-	err := DB.AutoMigrate(&models.Document{})
+// ConnectSQLite opens a SQLite database file, pdfgenerator.db by default; ":memory:" keeps the database in memory
+func ConnectSQLite(path string) (*gorm.DB, error) {
+	if path == "" {
+		path = "pdfgenerator.db"
+	}
+	db, err := gorm.Open(sqlite.Open(path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite has a single writer, and every new connection to :memory: would open another empty database
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Printf("Error migrating database: %v", err)
+		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(1)
+	return db, nil
+}
 
-	err2 := DB.AutoMigrate(&models.Template{})
-	if err2 != nil {
-		log.Printf("Error migrating database: %v", err)
+// adoptLegacySchema brings a database created by AutoMigrate before versioned migrations up to the baseline migration:
+// text payloads become JSONB, missing tables and columns are added and request logs are copied to the audit log
+func adoptLegacySchema() error {
+	if err := ConvertPayloadsToJSONB(); err != nil {
+		return fmt.Errorf("converting payloads to JSONB: %v", err)
 	}
 
-	err3 := DB.AutoMigrate(&models.Logs{})
-	if err3 != nil {
-		log.Printf("Error migrating database: %v", err)
+	if err := DB.AutoMigrate(
+		&models.Document{},
+		&models.Template{},
+		&models.Logs{},
+		&models.FailedGenerations{},
+		&models.TemplateAsset{},
+		&models.Partial{}, &models.PartialDependency{},
+		&models.TranslationCatalog{},
+		&models.TemplateRevision{}, &models.TemplateSample{}, &models.WorkflowTransition{},
+		&models.TemplateTag{}, &models.TemplateMetadata{},
+		&models.TemplateSearchPath{}, &models.DocumentSearch{},
+		&models.AuditEvent{},
+		&models.RetentionPolicy{}, &models.PurgeRun{},
+		&models.StorageOperation{}, &models.ReconcileRun{},
+	); err != nil {
+		return err
 	}
 
-	err4 := DB.AutoMigrate(&models.FailedGenerations{})
-	if err4 != nil {
-		log.Printf("Error migrating database: %v", err)
+	// full-text index the document search queries with, the only legacy databases are on Postgres
+	if err := DB.Exec("CREATE INDEX IF NOT EXISTS idx_document_searches_content ON document_searches USING GIN (to_tsvector('simple', content))").Error; err != nil {
+		return err
+	}
+	if err := CopyLegacyLogs(); err != nil {
+		return fmt.Errorf("copying request logs to the audit log: %v", err)
 	}
+	return IndexPayloads()
 }
@@ -0,0 +1,291 @@
+package initializers
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"gorm.io/gorm"
+)
+
+// migrationFiles holds the versioned migrations of every dialect, as migrations/<dialect>/<version>_<name>.<up|down>.sql
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change with the SQL that applies and reverts it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Migrations lists the migrations of the connected database's dialect, oldest first
+func Migrations() ([]Migration, error) {
+	dir := path.Join("migrations", DB.Dialector.Name())
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s: %v", DB.Dialector.Name(), err)
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s is not named <version>_<name>.<up|down>.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, match[2])
+		}
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// AppliedMigrations returns the migrations recorded in schema_migrations by version
+func AppliedMigrations() (map[int]models.SchemaMigration, error) {
+	applied := map[int]models.SchemaMigration{}
+	if !DB.Migrator().HasTable(&models.SchemaMigration{}) {
+		return applied, nil
+	}
+	var rows []models.SchemaMigration
+	if err := DB.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// PendingMigrations lists the migrations not applied yet, oldest first
+func PendingMigrations() ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := AppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// CheckSchema returns an error when migrations are pending, so the server does not run against an older schema
+func CheckSchema() error {
+	pending, err := PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	versions := make([]string, len(pending))
+	for i, migration := range pending {
+		versions[i] = fmt.Sprintf("%d_%s", migration.Version, migration.Name)
+	}
+	return fmt.Errorf("the database schema is behind, pending migrations: %s; run `migrate up`", strings.Join(versions, ", "))
+}
+
+// MigrateUp applies the pending migrations in order, each in its own transaction, and returns those it applied.
+// A database created by AutoMigrate before versioned migrations is brought up to date and recorded at the baseline first.
+func MigrateUp() ([]Migration, error) {
+	if !DB.Migrator().HasTable(&models.SchemaMigration{}) {
+		if err := createMigrationTable(); err != nil {
+			return nil, err
+		}
+	}
+
+	pending, err := PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, migration := range pending {
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := execStatements(tx, migration.Up); err != nil {
+				return err
+			}
+			return tx.Create(&models.SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return applied, fmt.Errorf("migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the latest applied migrations, newest first, and returns those it reverted
+func MigrateDown(steps int) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := AppliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := execStatements(tx, migration.Down); err != nil {
+				return err
+			}
+			return tx.Delete(&models.SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("reverting migration %d_%s: %v", migration.Version, migration.Name, err)
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// MigrateCommand runs `migrate up`, `migrate down [steps]` or `migrate status`; without arguments it migrates up
+func MigrateCommand(args []string) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := MigrateUp()
+		for _, migration := range applied {
+			fmt.Printf("applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("the schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			parsed, err := strconv.Atoi(args[1])
+			if err != nil || parsed < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = parsed
+		}
+		reverted, err := MigrateDown(steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		migrations, err := Migrations()
+		if err != nil {
+			return err
+		}
+		applied, err := AppliedMigrations()
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			state := "pending"
+			if row, ok := applied[migration.Version]; ok {
+				state = "applied " + row.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d_%s\t%s\n", migration.Version, migration.Name, state)
+		}
+		return nil
+	default:
+		return errors.New("usage: migrate [up | down [steps] | status]")
+	}
+}
+
+// createMigrationTable creates schema_migrations. A database that already has tables was created by AutoMigrate
+// before versioned migrations: it is brought up to date the old way and recorded at the baseline migration.
+func createMigrationTable() error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	// SQLite databases have only ever been created by migrations
+	legacy := DB.Dialector.Name() == "postgres" && DB.Migrator().HasTable(&models.Document{})
+	if legacy {
+		if err := adoptLegacySchema(); err != nil {
+			return fmt.Errorf("adopting the existing schema: %v", err)
+		}
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().CreateTable(&models.SchemaMigration{}); err != nil {
+			return err
+		}
+		if !legacy || len(migrations) == 0 {
+			return nil
+		}
+		baseline := migrations[0]
+		return tx.Create(&models.SchemaMigration{Version: baseline.Version, Name: baseline.Name, AppliedAt: time.Now()}).Error
+	})
+}
+
+// execStatements runs the statements of a migration file; each statement ends with a semicolon at the end of a line
+func execStatements(tx *gorm.DB, sql string) error {
+	var statement strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		statement.WriteString(line)
+		statement.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			if err := tx.Exec(strings.TrimSuffix(strings.TrimSpace(statement.String()), ";")).Error; err != nil {
+				return err
+			}
+			statement.Reset()
+		}
+	}
+	if strings.TrimSpace(statement.String()) != "" {
+		return fmt.Errorf("statement without a closing semicolon: %s", statement.String())
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+DROP TABLE IF EXISTS "reconcile_runs";
+DROP TABLE IF EXISTS "storage_operations";
+DROP TABLE IF EXISTS "purge_runs";
+DROP TABLE IF EXISTS "retention_policies";
+DROP TABLE IF EXISTS "audit_events";
+DROP TABLE IF EXISTS "document_searches";
+DROP TABLE IF EXISTS "template_search_paths";
+DROP TABLE IF EXISTS "template_metadata";
+DROP TABLE IF EXISTS "template_tags";
+DROP TABLE IF EXISTS "workflow_transitions";
+DROP TABLE IF EXISTS "template_samples";
+DROP TABLE IF EXISTS "template_revisions";
+DROP TABLE IF EXISTS "translation_catalogs";
+DROP TABLE IF EXISTS "partial_dependencies";
+DROP TABLE IF EXISTS "partials";
+DROP TABLE IF EXISTS "template_assets";
+DROP TABLE IF EXISTS "failed_generations";
+DROP TABLE IF EXISTS "logs";
+DROP TABLE IF EXISTS "templates";
+DROP TABLE IF EXISTS "documents";
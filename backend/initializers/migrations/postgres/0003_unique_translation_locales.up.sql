@@ -0,0 +1,7 @@
+-- Concurrent saves could store two catalogs for one locale of a template.
+-- Keep the most recently updated one of each, then make (template_id, locale) unique.
+
+DELETE FROM "translation_catalogs" WHERE "id" IN (
+SELECT "id" FROM (SELECT "id", ROW_NUMBER() OVER (PARTITION BY "template_id", "locale" ORDER BY "updated_at" DESC, "id") AS "position" FROM "translation_catalogs") AS "ranked"
+WHERE "position" > 1);
+CREATE UNIQUE INDEX "idx_translation_catalogs_template_locale" ON "translation_catalogs" ("template_id", "locale");
@@ -0,0 +1,4 @@
+-- The revisions and transitions recorded by the up migration cannot be told apart from later ones and are kept.
+-- Published revisions become active again and drafts take back their check result as status.
+UPDATE "template_revisions" SET "status" = 'active' WHERE "status" = 'published';
+UPDATE "template_revisions" SET "status" = "check" WHERE "status" = 'draft';
@@ -0,0 +1 @@
+ALTER TABLE "template_revisions" DROP COLUMN IF EXISTS "changes";
@@ -0,0 +1,3 @@
+-- Imported revisions carry the template details they replace once published.
+-- Databases adopted from AutoMigrate may have the column already.
+ALTER TABLE "template_revisions" ADD COLUMN IF NOT EXISTS "changes" text;
@@ -0,0 +1 @@
+ALTER TABLE "retention_policies" ADD COLUMN IF NOT EXISTS "purge_after_days" bigint;
@@ -0,0 +1,2 @@
+ALTER TABLE "templates" DROP COLUMN IF EXISTS "in_trash";
+ALTER TABLE "documents" DROP COLUMN IF EXISTS "in_trash";
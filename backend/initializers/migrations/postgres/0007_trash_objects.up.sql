@@ -0,0 +1,4 @@
+-- Rows soft-deleted before the trash existed never had their objects moved there and cannot be restored.
+-- Databases adopted from AutoMigrate may have the columns already.
+ALTER TABLE "documents" ADD COLUMN IF NOT EXISTS "in_trash" boolean DEFAULT false;
+ALTER TABLE "templates" ADD COLUMN IF NOT EXISTS "in_trash" boolean DEFAULT false;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS "idx_template_revisions_template_revision";
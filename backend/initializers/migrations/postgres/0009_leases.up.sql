@@ -0,0 +1,2 @@
+-- the lease retention runs and reconciliation take, so only one instance changes storage at a time
+CREATE TABLE "leases" ("name" text,"holder" text,"expires_at" timestamptz,PRIMARY KEY ("name"));
@@ -0,0 +1,74 @@
+-- The same schema as the Postgres baseline, with payloads stored as JSON text and no GIN indexes.
+
+CREATE TABLE `documents` (`id` text,`document_name` text,`description` text,`template_id` text,`json_payload` text,`ref_number` text,`sha256` text,`verification_token` text,`legal_hold` numeric DEFAULT false,`legal_hold_reason` text,`created_at` datetime,`deleted_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_documents_legal_hold` ON `documents`(`legal_hold`);
+CREATE INDEX `idx_documents_verification_token` ON `documents`(`verification_token`);
+
+CREATE TABLE `templates` (`id` text,`name` text,`ref_number` text,`file_name` text,`default_locale` text,`format` text,`description` text,`category` text,`owner` text,`status` text DEFAULT 'active',`created_at` datetime,`deleted_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_templates_owner` ON `templates`(`owner`);
+CREATE INDEX `idx_templates_category` ON `templates`(`category`);
+CREATE INDEX `idx_templates_status` ON `templates`(`status`);
+
+CREATE TABLE `logs` (`id` text,`document_name` text,`document_description` text,`log_description` text,`template_id` text,`status` text,`method` text,`json_payload` text,`ref_number` text,`created_at` datetime,`deleted_at` datetime,PRIMARY KEY (`id`));
+
+CREATE TABLE `failed_generations` (`id` text,`document_name` text,`description` text,`template_id` text,`status` text,`method` text,`json_payload` text,`ref_number` text,`created_at` datetime,`deleted_at` datetime,PRIMARY KEY (`id`));
+
+CREATE TABLE `template_assets` (`id` text,`template_id` text,`path` text,`object_name` text,`content_type` text,`size` integer,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_template_assets_template_id` ON `template_assets`(`template_id`);
+
+CREATE TABLE `partials` (`id` text,`name` text,`kind` text,`version` integer,`file_name` text,`created_at` datetime,`deleted_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_partials_name` ON `partials`(`name`);
+
+CREATE TABLE `partial_dependencies` (`id` text,`dependent_id` text,`dependent_kind` text,`partial_name` text,`reference` text,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_partial_dependencies_dependent_id` ON `partial_dependencies`(`dependent_id`);
+CREATE INDEX `idx_partial_dependencies_partial_name` ON `partial_dependencies`(`partial_name`);
+
+CREATE TABLE `translation_catalogs` (`id` text,`template_id` text,`locale` text,`entries` text,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_translation_catalogs_template_id` ON `translation_catalogs`(`template_id`);
+
+CREATE TABLE `template_revisions` (`id` text,`template_id` text,`revision` integer,`file_name` text,`status` text,`check` text,`report` text,`created_by` text,`submitted_by` text,`reviewed_by` text,`created_at` datetime,`activated_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_template_revisions_template_id` ON `template_revisions`(`template_id`);
+
+CREATE TABLE `template_samples` (`id` text,`template_id` text,`name` text,`data` text,`locale` text,`golden_revision` integer,`golden_text` text,`golden_image` text,`golden_updated_at` datetime,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_template_samples_template_id` ON `template_samples`(`template_id`);
+
+CREATE TABLE `workflow_transitions` (`id` text,`template_id` text,`revision` integer,`from_status` text,`to_status` text,`actor` text,`comment` text,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_workflow_transitions_template_id` ON `workflow_transitions`(`template_id`);
+
+CREATE TABLE `template_tags` (`id` text,`template_id` text,`tag` text,PRIMARY KEY (`id`));
+CREATE INDEX `idx_template_tags_tag` ON `template_tags`(`tag`);
+CREATE INDEX `idx_template_tags_template_id` ON `template_tags`(`template_id`);
+
+CREATE TABLE `template_metadata` (`id` text,`template_id` text,`key` text,`value` text,PRIMARY KEY (`id`));
+CREATE INDEX `idx_template_metadata_key` ON `template_metadata`(`key`);
+CREATE INDEX `idx_template_metadata_template_id` ON `template_metadata`(`template_id`);
+
+CREATE TABLE `template_search_paths` (`id` text,`template_id` text,`path` text,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_template_search_paths_template_id` ON `template_search_paths`(`template_id`);
+
+CREATE TABLE `document_searches` (`document_id` text,`template_id` text,`content` text,`updated_at` datetime,PRIMARY KEY (`document_id`));
+CREATE INDEX `idx_document_searches_template_id` ON `document_searches`(`template_id`);
+
+CREATE TABLE `audit_events` (`id` text,`request_id` text,`event_type` text,`actor` text,`client_ip` text,`user_agent` text,`method` text,`path` text,`target_type` text,`target_id` text,`template_id` text,`ref_number` text,`description` text,`outcome` text,`status_code` integer,`error_code` text,`message` text,`json_payload` text,`duration_ms` integer,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_audit_events_outcome` ON `audit_events`(`outcome`);
+CREATE INDEX `idx_audit_events_ref_number` ON `audit_events`(`ref_number`);
+CREATE INDEX `idx_audit_events_template_id` ON `audit_events`(`template_id`);
+CREATE INDEX `idx_audit_events_target_id` ON `audit_events`(`target_id`);
+CREATE INDEX `idx_audit_events_actor` ON `audit_events`(`actor`);
+CREATE INDEX `idx_audit_events_event_type` ON `audit_events`(`event_type`);
+CREATE INDEX `idx_audit_events_request_id` ON `audit_events`(`request_id`);
+CREATE INDEX `idx_audit_events_created_at` ON `audit_events`(`created_at`);
+
+CREATE TABLE `retention_policies` (`id` text,`entity` text,`template_id` text,`retain_days` integer,`purge_after_days` integer,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_retention_policies_template_id` ON `retention_policies`(`template_id`);
+CREATE INDEX `idx_retention_policies_entity` ON `retention_policies`(`entity`);
+
+CREATE TABLE `purge_runs` (`id` text,`trigger` text,`dry_run` numeric,`report` text,`error` text,`started_at` datetime,`finished_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_purge_runs_started_at` ON `purge_runs`(`started_at`);
+
+CREATE TABLE `storage_operations` (`id` text,`action` text,`bucket` text,`object_name` text,`target` text,`reason` text,`attempts` integer,`last_error` text,`due_at` datetime,`created_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_storage_operations_due_at` ON `storage_operations`(`due_at`);
+CREATE INDEX `idx_storage_operations_object` ON `storage_operations`(`bucket`,`object_name`);
+
+CREATE TABLE `reconcile_runs` (`id` text,`trigger` text,`dry_run` numeric,`report` text,`error` text,`started_at` datetime,`finished_at` datetime,PRIMARY KEY (`id`));
+CREATE INDEX `idx_reconcile_runs_started_at` ON `reconcile_runs`(`started_at`);
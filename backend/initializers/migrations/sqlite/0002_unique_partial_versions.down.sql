@@ -0,0 +1 @@
+DROP INDEX IF EXISTS `idx_partials_name_version`;
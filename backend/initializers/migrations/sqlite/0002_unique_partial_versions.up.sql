@@ -0,0 +1,8 @@
+-- Concurrent uploads could store two versions of a partial under the same number.
+-- Renumber the versions of those partials in upload order, then make (name, version) unique.
+
+UPDATE `partials` SET `version` = `ranked`.`version`
+FROM (SELECT `id`, ROW_NUMBER() OVER (PARTITION BY `name` ORDER BY `version`, `created_at`, `id`) AS `version` FROM `partials`) AS `ranked`
+WHERE `partials`.`id` = `ranked`.`id` AND `partials`.`version` <> `ranked`.`version`
+AND `partials`.`name` IN (SELECT `name` FROM `partials` GROUP BY `name`, `version` HAVING COUNT(*) > 1);
+CREATE UNIQUE INDEX `idx_partials_name_version` ON `partials` (`name`, `version`);
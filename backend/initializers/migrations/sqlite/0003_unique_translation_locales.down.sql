@@ -0,0 +1 @@
+DROP INDEX IF EXISTS `idx_translation_catalogs_template_locale`;
@@ -0,0 +1,16 @@
+-- Before the publish workflow a revision's status held its golden check and "active" marked the revision in use.
+-- The revision in use becomes published, the others become drafts that keep their check result.
+UPDATE `template_revisions` SET `check` = `status`, `status` = 'draft' WHERE `status` IN ('passed', 'failed', 'unchecked');
+UPDATE `template_revisions` SET `status` = 'published' WHERE `status` = 'active';
+UPDATE `template_revisions` SET `check` = 'unchecked' WHERE `check` IS NULL OR `check` = '';
+
+-- Templates stored before revisions existed get their content recorded as a published revision
+INSERT INTO `template_revisions` (`id`, `template_id`, `revision`, `file_name`, `status`, `check`, `report`, `created_by`, `submitted_by`, `reviewed_by`, `created_at`, `activated_at`)
+SELECT lower(hex(randomblob(16))), `templates`.`id`, COALESCE((SELECT MAX(`revision`) FROM `template_revisions` WHERE `template_id` = `templates`.`id`), 0) + 1,
+`templates`.`file_name`, 'published', 'unchecked', '', '', '', '', `templates`.`created_at`, `templates`.`created_at`
+FROM `templates` WHERE NOT EXISTS (SELECT 1 FROM `template_revisions` WHERE `template_id` = `templates`.`id` AND `file_name` = `templates`.`file_name`);
+
+-- and every revision without a workflow transition gets one, so the audit trail shows where it came from
+INSERT INTO `workflow_transitions` (`id`, `template_id`, `revision`, `from_status`, `to_status`, `actor`, `comment`, `created_at`)
+SELECT lower(hex(randomblob(16))), `template_id`, `revision`, '', `status`, '', 'recorded before the publish workflow', `created_at`
+FROM `template_revisions` WHERE NOT EXISTS (SELECT 1 FROM `workflow_transitions` WHERE `workflow_transitions`.`template_id` = `template_revisions`.`template_id` AND `workflow_transitions`.`revision` = `template_revisions`.`revision`);
@@ -0,0 +1,2 @@
+-- Imported revisions carry the template details they replace once published
+ALTER TABLE `template_revisions` ADD COLUMN `changes` text;
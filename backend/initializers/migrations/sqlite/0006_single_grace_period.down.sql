@@ -0,0 +1 @@
+ALTER TABLE `retention_policies` ADD COLUMN `purge_after_days` integer;
@@ -0,0 +1,2 @@
+-- Soft-deleted rows are purged after the trash grace period, policies no longer set their own
+ALTER TABLE `retention_policies` DROP COLUMN `purge_after_days`;
@@ -0,0 +1,2 @@
+ALTER TABLE `templates` DROP COLUMN `in_trash`;
+ALTER TABLE `documents` DROP COLUMN `in_trash`;
@@ -0,0 +1,3 @@
+-- Rows soft-deleted before the trash existed never had their objects moved there and cannot be restored
+ALTER TABLE `documents` ADD COLUMN `in_trash` numeric DEFAULT false;
+ALTER TABLE `templates` ADD COLUMN `in_trash` numeric DEFAULT false;
@@ -0,0 +1,11 @@
+-- Concurrent uploads could store two revisions of a template under the same number.
+-- Give the later copies of a number the next free numbers in upload order, then make (template_id, revision) unique.
+-- Copies are renumbered rather than the whole template, so the workflow transitions of the other revisions keep their number.
+
+UPDATE `template_revisions` SET `revision` = `moved`.`revision`
+FROM (SELECT `id`, `latest` + ROW_NUMBER() OVER (PARTITION BY `template_id` ORDER BY `revision`, `created_at`, `id`) AS `revision`
+FROM (SELECT `id`, `template_id`, `revision`, `created_at`, MAX(`revision`) OVER (PARTITION BY `template_id`) AS `latest`,
+ROW_NUMBER() OVER (PARTITION BY `template_id`, `revision` ORDER BY `created_at`, `id`) AS `copy` FROM `template_revisions`) AS `copies`
+WHERE `copy` > 1) AS `moved`
+WHERE `template_revisions`.`id` = `moved`.`id`;
+CREATE UNIQUE INDEX `idx_template_revisions_template_revision` ON `template_revisions` (`template_id`, `revision`);
@@ -0,0 +1,201 @@
+package initializers
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useMemoryDB points DB at a new, empty in-memory SQLite database for the rest of the test
+func useMemoryDB(t *testing.T) {
+	t.Helper()
+	db, err := ConnectSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := DB
+	DB = db.Session(&gorm.Session{Logger: logger.Discard})
+	t.Cleanup(func() {
+		DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	useMemoryDB(t)
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSchema(); err == nil {
+		t.Error("an empty database passed the schema check")
+	}
+
+	applied, err := MigrateUp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(migrations))
+	}
+	if err := CheckSchema(); err != nil {
+		t.Error(err)
+	}
+	if applied, err := MigrateUp(); err != nil || len(applied) != 0 {
+		t.Errorf("second run applied %v, %v", applied, err)
+	}
+
+	reverted, err := MigrateDown(len(migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(migrations) || reverted[0].Version != migrations[len(migrations)-1].Version {
+		t.Fatalf("reverted %v, want every migration newest first", reverted)
+	}
+	if DB.Migrator().HasTable(&models.Document{}) {
+		t.Error("documents table left after reverting the baseline")
+	}
+	pending, err := PendingMigrations()
+	if err != nil || len(pending) != len(migrations) {
+		t.Errorf("pending %v, %v", pending, err)
+	}
+
+	// the down files leave a schema the up files can build on again
+	if _, err := MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateUpStopsAtAFailingMigration(t *testing.T) {
+	useMemoryDB(t)
+	if _, err := MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := 0
+	for _, migration := range migrations {
+		if migration.Version >= 7 {
+			steps++
+		}
+	}
+	if _, err := MigrateDown(steps); err != nil {
+		t.Fatal(err)
+	}
+	// 0007 alters documents, then templates: without templates its second statement fails,
+	// and the first is rolled back with it
+	if err := DB.Exec("DROP TABLE templates").Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := MigrateUp(); err == nil {
+		t.Fatal("expected 0007 to fail without a templates table")
+	}
+	pending, err := PendingMigrations()
+	if err != nil || len(pending) != steps {
+		t.Errorf("pending %v, %v", pending, err)
+	}
+	if DB.Migrator().HasColumn(&models.Document{}, "in_trash") {
+		t.Error("the failed migration was partly applied")
+	}
+}
+
+func TestUniqueRevisionNumbersMigration(t *testing.T) {
+	useMemoryDB(t)
+	if _, err := MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := 0
+	for _, migration := range migrations {
+		if migration.Version >= 8 {
+			steps++
+		}
+	}
+	if _, err := MigrateDown(steps); err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded := time.Now()
+	for i, revision := range []models.TemplateRevision{
+		{ID: "a", TemplateId: "T-1", Revision: 1},
+		{ID: "b", TemplateId: "T-1", Revision: 2},
+		{ID: "c", TemplateId: "T-1", Revision: 2},
+		{ID: "d", TemplateId: "T-1", Revision: 3},
+		{ID: "e", TemplateId: "T-2", Revision: 1},
+	} {
+		revision.CreatedAt = uploaded.Add(time.Duration(i) * time.Minute)
+		if err := DB.Create(&revision).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	var revisions []models.TemplateRevision
+	DB.Order("id").Find(&revisions)
+	numbers := map[string]int{}
+	for _, revision := range revisions {
+		numbers[revision.ID] = revision.Revision
+	}
+	// the later copy of revision 2 comes after the latest revision, the others keep their number
+	if want := map[string]int{"a": 1, "b": 2, "c": 4, "d": 3, "e": 1}; len(numbers) != len(want) {
+		t.Errorf("revisions %v, want %v", numbers, want)
+	} else {
+		for id, number := range want {
+			if numbers[id] != number {
+				t.Errorf("revisions %v, want %v", numbers, want)
+				break
+			}
+		}
+	}
+}
+
+func TestMigrationsMatchAcrossDialects(t *testing.T) {
+	versions := map[string][]string{}
+	for _, dialect := range []string{"postgres", "sqlite"} {
+		entries, err := fs.ReadDir(migrationFiles, path.Join("migrations", dialect))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if !migrationName.MatchString(entry.Name()) {
+				t.Errorf("%s/%s is not named <version>_<name>.<up|down>.sql", dialect, entry.Name())
+			}
+			versions[dialect] = append(versions[dialect], entry.Name())
+		}
+	}
+	if strings.Join(versions["postgres"], " ") != strings.Join(versions["sqlite"], " ") {
+		t.Errorf("postgres has %v, sqlite has %v", versions["postgres"], versions["sqlite"])
+	}
+}
+
+func TestExecStatements(t *testing.T) {
+	useMemoryDB(t)
+	sql := "-- a comment; not a statement\nCREATE TABLE a (id text,\n  name text);\n\nINSERT INTO a VALUES ('1', 'x;y');\n"
+	if err := execStatements(DB, sql); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	DB.Table("a").Count(&count)
+	if count != 1 {
+		t.Errorf("%d rows, want 1", count)
+	}
+	if err := execStatements(DB, "INSERT INTO a VALUES ('2', 'z')"); err == nil {
+		t.Error("a statement without a semicolon was run")
+	}
+}
@@ -0,0 +1,67 @@
+package initializers
+
+import (
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// payloadTables are the tables whose json_payload column holds request payloads
+var payloadTables = []string{"documents", "logs", "failed_generations", "audit_events"}
+
+// ConvertPayloadsToJSONB turns text payload columns into JSONB, which AutoMigrate cannot do as existing rows need converting.
+// Empty payloads become NULL and text that is not valid JSON is kept as a JSON string.
+func ConvertPayloadsToJSONB() error {
+	if DB.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, table := range payloadTables {
+		if !DB.Migrator().HasColumn(table, "json_payload") {
+			continue
+		}
+		columns, err := DB.Migrator().ColumnTypes(table)
+		if err != nil {
+			return err
+		}
+		for _, column := range columns {
+			if column.Name() != "json_payload" || strings.EqualFold(column.DatabaseTypeName(), "jsonb") {
+				continue
+			}
+			log.Printf("Converting %s.json_payload to JSONB", table)
+			// the function lives in the transaction's session, so every statement runs on one connection
+			err := DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(`CREATE FUNCTION pg_temp.payload_to_jsonb(payload text) RETURNS jsonb AS $$
+BEGIN
+	RETURN NULLIF(payload, '')::jsonb;
+EXCEPTION WHEN others THEN
+	RETURN to_jsonb(payload);
+END;
+$$ LANGUAGE plpgsql`).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec("ALTER TABLE " + table + " ALTER COLUMN json_payload TYPE jsonb USING pg_temp.payload_to_jsonb(json_payload)").Error; err != nil {
+					return err
+				}
+				return tx.Exec("DROP FUNCTION pg_temp.payload_to_jsonb(text)").Error
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IndexPayloads adds the GIN indexes payload filters use
+func IndexPayloads() error {
+	if DB.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, table := range payloadTables {
+		if err := DB.Exec("CREATE INDEX IF NOT EXISTS idx_" + table + "_json_payload ON " + table + " USING GIN (json_payload jsonb_path_ops)").Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"log"
+	"os"
+
 	"example/pdfgenerator/controllers"
 	"example/pdfgenerator/initializers"
+	"example/pdfgenerator/services"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -11,41 +15,120 @@ import (
 func init() {
 	initializers.LoadEnvVariables()
 	initializers.ConnectToDB()
-	initializers.MigrateDB()
-	initializers.InitMinioClient()
 }
 
 func main() {
+	// `main migrate up|down|status` manages the schema instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := initializers.MigrateCommand(os.Args[2:]); err != nil {
+			log.Fatalf("Error migrating database: %v", err)
+		}
+		return
+	}
+	if err := initializers.CheckSchema(); err != nil {
+		log.Fatalf("Refusing to start: %v", err)
+	}
+	initializers.InitMinioClient()
+	server := controllers.NewServer(initializers.DB)
+	tokens, err := controllers.ParseAPITokens(os.Getenv("API_TOKENS"))
+	if err != nil {
+		log.Fatalf("Error reading API_TOKENS: %v", err)
+	}
 
 	r := gin.Default()
 
 	// Set up CORS middleware
 	config := cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Authorization", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Authorization", "Content-Type", "X-Request-ID"},
+		ExposeHeaders:    []string{"Content-Length", "X-Request-ID"},
 		AllowCredentials: true,
 	}
 	r.Use(cors.New(config))
+	r.Use(controllers.RequestID())
+	r.Use(controllers.Authenticate(tokens))
+
+	// new templates and revisions are recorded under the name of the caller's API token
+	r.POST("/upload-template", controllers.RequireActor(), server.UploadTemplate)
+	r.POST("/generate", server.CreateDocument, server.AutodocsLogs)
+	r.POST("/generate-text", server.GenerateText)
+	r.POST("/generate-docx", server.GenerateDocx)
+	r.GET("/documents", server.GetDocuments)
+	r.GET("/documents/diff", server.DiffDocuments)
+	r.GET("/documents/search", server.SearchDocuments)
+	r.POST("/documents/search/reindex", server.ReindexDocuments)
+	r.GET("/templates", server.GetTemplates)
+	r.GET("/templates/export", server.ExportTemplates)
+	r.POST("/templates/import", controllers.RequireActor(), server.ImportTemplates)
+	r.GET("/document-history", server.GetDocumentHistory)
+	r.GET("/logs", server.AutodocsLogs)
+	r.GET("/daterange-metrics", server.GetRangeMetrics)
+	r.GET("failed-generations", server.GetFailedGenerations)
+
+	r.GET("/templates/preview/:refNumber", server.PreviewTemplate)
+	r.GET("/documents/preview/:refNumber", server.PreviewDocument)
+
+	r.PATCH("/templates/:refNumber", server.PatchTemplate)
+	r.POST("/templates/:refNumber/clone", controllers.RequireActor(), server.CloneTemplate)
+	r.DELETE("/templates/:refNumber", server.DeleteTemplate)
+	r.GET("/templates/:refNumber/translations", server.TemplateTranslations)
+	r.PUT("/templates/:refNumber/translations/:locale", server.SaveTranslations)
+	r.DELETE("/templates/:refNumber/translations/:locale", server.DeleteTranslations)
+	r.GET("/templates/:refNumber/fields", server.TemplateFields)
+	r.GET("/templates/:refNumber/search-paths", server.TemplateSearchPaths)
+	r.PUT("/templates/:refNumber/search-paths", server.SaveSearchPaths)
+	r.GET("/templates/:refNumber/samples", server.TemplateSamples)
+	r.PUT("/templates/:refNumber/samples/:name", server.SaveSample)
+	r.DELETE("/templates/:refNumber/samples/:name", server.DeleteSample)
+	r.POST("/templates/:refNumber/samples/render", server.RenderSamples)
+	r.POST("/templates/:refNumber/samples/golden", server.RecordGoldens)
+	r.GET("/templates/:refNumber/revisions", server.TemplateRevisions)
+	r.POST("/templates/:refNumber/revisions", controllers.RequireActor(), server.UploadRevision)
+	// workflow steps are recorded under the name of the caller's API token
+	r.POST("/templates/:refNumber/revisions/:revision/submit", controllers.RequireActor(), server.SubmitRevision)
+	r.POST("/templates/:refNumber/revisions/:revision/review", controllers.RequireActor(), server.ReviewRevision)
+	r.POST("/templates/:refNumber/revisions/:revision/publish", controllers.RequireActor(), server.PublishRevision)
+	r.POST("/templates/:refNumber/revisions/diff", server.DiffRevisions)
+	r.GET("/templates/:refNumber/audit", server.TemplateAuditTrail)
+	r.DELETE("/documents/:refNumber", server.DeleteDocument)
+	r.PUT("/documents/:refNumber/legal-hold", controllers.RequireActor(), server.SetLegalHold)
+
+	// shared partials and base layouts included by templates
+	r.POST("/partials", server.UploadPartial)
+	r.GET("/partials", server.Partials)
+	r.GET("/partials/:name/versions", server.PartialVersions)
+	r.GET("/partials/:name/preview", server.PreviewPartial)
+	r.GET("/partials/:name/dependents", server.PartialDependents)
+	r.DELETE("/partials/:name", server.DeletePartial)
+
+	// public document verification, linked from the QR code on generated documents
+	r.GET("/verify/:token", server.VerifyDocument)
+	r.POST("/verify/:token", server.VerifyUploadedDocument)
+
+	// retention policies, applied by a background sweeper or on demand; changing them or purging needs an API token
+	r.GET("/retention/policies", server.RetentionPolicies)
+	r.PUT("/retention/policies", controllers.RequireActor(), server.SaveRetentionPolicy)
+	r.DELETE("/retention/policies/:id", controllers.RequireActor(), server.DeleteRetentionPolicy)
+	r.POST("/retention/purge", controllers.RequireActor(), server.RunRetention)
+	r.GET("/retention/runs", server.PurgeRuns)
+	r.GET("/retention/runs/:id", server.PurgeRunReport)
 
-	r.POST("/upload-template", controllers.UploadTemplate)
-	r.POST("/generate", controllers.CreateDocument, controllers.AutodocsLogs)
-	r.GET("/documents", controllers.GetDocuments)
-	r.GET("/templates", controllers.Templates)
-	r.GET("/document-history", controllers.GetDocumentHistory)
-	r.GET("/logs", controllers.AutodocsLogs)
-	r.GET("/daterange-metrics", controllers.GetRangeMetrics)
-	r.GET("failed-generations", controllers.GetFailedGenerations)
+	// deleted templates and documents, restorable until the trash is purged
+	r.GET("/trash", server.TrashItems)
+	r.POST("/trash/:refNumber/restore", server.RestoreFromTrash)
 
-	r.GET("/templates/preview/:refNumber", controllers.PreviewTemplate)
-	r.GET("/documents/preview/:refNumber", controllers.PreviewDocument)
+	// storage operations waiting to be applied, and checks of the database against object storage
+	r.GET("/storage/outbox", server.StorageOperations)
+	r.POST("/storage/reconcile", controllers.RequireActor(), server.Reconcile)
+	r.GET("/storage/reconcile/runs", server.ReconcileRuns)
+	r.GET("/storage/reconcile/runs/:id", server.ReconcileRunReport)
 
-	r.DELETE("/templates/:refNumber", controllers.DeleteTemplate)
-	r.DELETE("/documents/:refNumber", controllers.DeleteDocument)
-	r.DELETE("/clear-logs", controllers.DeleteAllLogs)
+	services.StartRetentionSweeper(server.DB)
+	services.StartOutboxWorker(server.DB)
+	services.StartSearchBackfill(server.DB)
 
 	//endpoint to log the html before it turns to pdf
-	r.POST("/htmlbeforepdf", controllers.HtmlBeforePDF)
+	r.POST("/htmlbeforepdf", server.HtmlBeforePDF)
 	r.Run()
 }
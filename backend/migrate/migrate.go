@@ -1,8 +1,10 @@
 package main
 
 import (
+	"log"
+	"os"
+
 	"example/pdfgenerator/initializers"
-	"example/pdfgenerator/models"
 )
 
 func init() {
@@ -10,7 +12,9 @@ func init() {
 	initializers.ConnectToDB()
 }
 
+// migrate runs `up`, `down [steps]` or `status` against the database, like `main migrate`
 func main() {
-	initializers.DB.AutoMigrate(&models.Document{})
-	initializers.DB.AutoMigrate(&models.Template{})
+	if err := initializers.MigrateCommand(os.Args[1:]); err != nil {
+		log.Fatalf("Error migrating database: %v", err)
+	}
 }
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrAppendOnly is returned when an audit event is updated, or deleted other than by retention
+var ErrAppendOnly = errors.New("audit events are append-only")
+
+// AllowAuditPurge is the session setting retention sets to delete expired events
+const AllowAuditPurge = "audit:retention-purge"
+
+// AuditEvent is one entry of the append-only request audit log.
+// Method, outcome and description keep the JSON names of the logs the dashboard reads.
+type AuditEvent struct {
+	ID          string      `json:"id"`
+	RequestId   string      `json:"requestId" gorm:"index"`
+	EventType   string      `json:"eventType" gorm:"index"`
+	Actor       string      `json:"actor" gorm:"index"`
+	ClientIP    string      `json:"clientIp"`
+	UserAgent   string      `json:"userAgent"`
+	Method      string      `json:"requestMethod"`
+	Path        string      `json:"path"`
+	TargetType  string      `json:"targetType"`
+	TargetId    string      `json:"targetId" gorm:"index"`
+	TemplateId  string      `json:"templateId" gorm:"index"`
+	RefNumber   string      `json:"refNumber" gorm:"index"`
+	Description string      `json:"description"`
+	Outcome     string      `json:"requestStatus" gorm:"index"`
+	StatusCode  int         `json:"statusCode"`
+	ErrorCode   string      `json:"errorCode,omitempty"`
+	Message     string      `json:"message"`
+	JsonPayload JSONPayload `json:"jsonPayload"`
+	DurationMs  int64       `json:"durationMs"`
+	CreatedAt   time.Time   `json:"created_at" gorm:"index"`
+}
+
+// BeforeUpdate keeps recorded events unchanged
+func (AuditEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAppendOnly
+}
+
+// BeforeDelete only lets the logs retention policy remove events
+func (AuditEvent) BeforeDelete(tx *gorm.DB) error {
+	if allowed, ok := tx.Get(AllowAuditPurge); ok && allowed == true {
+		return nil
+	}
+	return ErrAppendOnly
+}
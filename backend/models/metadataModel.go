@@ -0,0 +1,16 @@
+package models
+
+// TemplateTag is one tag of a template, kept in its own table so templates can be filtered by tag
+type TemplateTag struct {
+	ID         string `json:"id"`
+	TemplateId string `json:"templateId" gorm:"index"`
+	Tag        string `json:"tag" gorm:"index"`
+}
+
+// TemplateMetadata is one custom key/value pair of a template
+type TemplateMetadata struct {
+	ID         string `json:"id"`
+	TemplateId string `json:"templateId" gorm:"index"`
+	Key        string `json:"key" gorm:"index"`
+	Value      string `json:"value"`
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// SchemaMigration records a versioned migration applied to the database
+type SchemaMigration struct {
+	Version   int       `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
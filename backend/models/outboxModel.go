@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// StorageOperation is a pending change to object storage, written in the same transaction as the rows it belongs to
+// and applied after the commit, or written before an upload as the step that undoes it.
+// The outbox worker retries an operation until it succeeds.
+type StorageOperation struct {
+	ID         string    `json:"id"`
+	Action     string    `json:"action"`
+	Bucket     string    `json:"bucket" gorm:"index:idx_storage_operations_object"`
+	ObjectName string    `json:"objectName" gorm:"index:idx_storage_operations_object"`
+	Target     string    `json:"target,omitempty"`
+	Reason     string    `json:"reason"`
+	Attempts   int       `json:"attempts"`
+	LastError  string    `json:"lastError,omitempty"`
+	DueAt      time.Time `json:"dueAt" gorm:"index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReconcileRun is one comparison of the database with object storage, with its report as JSON
+type ReconcileRun struct {
+	ID         string     `json:"id"`
+	Trigger    string     `json:"trigger"`
+	DryRun     bool       `json:"dryRun"`
+	Report     string     `json:"-"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt" gorm:"index"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
+
+// Lease is held by the one run, across every instance on the database, allowed to do a kind of work at a time.
+// Its holder renews it while working; a lease past ExpiresAt was left by a holder that stopped and can be taken over.
+type Lease struct {
+	Name      string    `json:"name" gorm:"primaryKey"`
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Partial is one version of a shared snippet or base layout that templates include with {{template "name" .}}
+type Partial struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name" gorm:"index"`
+	Kind      string         `json:"kind"`
+	Version   int            `json:"version"`
+	FileName  string         `json:"fileName"`
+	CreatedAt time.Time      `json:"created_at"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at"`
+}
+
+// PartialDependency records that a template or partial references a partial by name
+type PartialDependency struct {
+	ID            string    `json:"id"`
+	DependentId   string    `json:"dependentId" gorm:"index"`
+	DependentKind string    `json:"dependentKind"`
+	PartialName   string    `json:"partialName" gorm:"index"`
+	Reference     string    `json:"reference"`
+	CreatedAt     time.Time `json:"created_at"`
+}
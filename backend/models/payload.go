@@ -0,0 +1,43 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// JSONPayload is a JSON request payload, stored as JSONB on Postgres so it can be queried; an empty payload is stored as NULL
+type JSONPayload string
+
+// Value implements driver.Valuer
+func (p JSONPayload) Value() (driver.Value, error) {
+	if p == "" {
+		return nil, nil
+	}
+	return string(p), nil
+}
+
+// Scan implements sql.Scanner
+func (p *JSONPayload) Scan(value interface{}) error {
+	switch value := value.(type) {
+	case nil:
+		*p = ""
+	case []byte:
+		*p = JSONPayload(value)
+	case string:
+		*p = JSONPayload(value)
+	default:
+		return fmt.Errorf("cannot scan %T into a JSON payload", value)
+	}
+	return nil
+}
+
+// GormDBDataType picks the column type of payloads for the database in use
+func (JSONPayload) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "jsonb"
+	}
+	return "text"
+}
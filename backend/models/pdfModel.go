@@ -13,23 +13,51 @@ type Document struct {
 	TemplateId   string `json:"templateId"`
 	// Status       string         `json:"requestStatus"`
 	// Method       string         `json:"requestMethod"`
-	JsonPayload string         `json:"jsonPayload"`
-	RefNumber   string         `json:"refNumber"`
-	CreatedAt   time.Time      `json:"created_at"`
-	DeletedAt   gorm.DeletedAt `json:"deleted_at"`
+	JsonPayload       JSONPayload    `json:"jsonPayload"`
+	RefNumber         string         `json:"refNumber"`
+	Sha256            string         `json:"sha256"`
+	VerificationToken string         `json:"-" gorm:"index"`
+	LegalHold         bool           `json:"legalHold" gorm:"index;default:false"`
+	LegalHoldReason   string         `json:"legalHoldReason"`
+	CreatedAt         time.Time      `json:"created_at"`
+	DeletedAt         gorm.DeletedAt `json:"deleted_at"`
+	// InTrash is set when the PDF was moved to the trash on delete, documents deleted before the trash have none to restore
+	InTrash bool `json:"-" gorm:"default:false"`
 }
 
 type Template struct {
-	ID        string         `json:"id"`
-	Name      string         `json:"templateName"`
-	RefNumber string         `json:"refNumber"`
-	FileName  string         `json:"fileName"`
-	CreatedAt time.Time      `json:"created_at"`
-	DeletedAt gorm.DeletedAt `json:"deleted_at"`
+	ID            string `json:"id"`
+	Name          string `json:"templateName"`
+	RefNumber     string `json:"refNumber"`
+	FileName      string `json:"fileName"`
+	DefaultLocale string `json:"defaultLocale"`
+	Format        string `json:"format"`
+	Description   string `json:"description"`
+	Category      string `json:"category" gorm:"index"`
+	Owner         string `json:"owner" gorm:"index"`
+	Status        string `json:"status" gorm:"index;default:active"`
+	// Tags and Metadata live in their own tables and are filled in by services.LoadTemplateMetadata
+	Tags      []string          `json:"tags" gorm:"-"`
+	Metadata  map[string]string `json:"metadata" gorm:"-"`
+	CreatedAt time.Time         `json:"created_at"`
+	DeletedAt gorm.DeletedAt    `json:"deleted_at"`
+	// InTrash is set when the objects were moved to the trash on delete, templates deleted before the trash have none to restore
+	InTrash bool `json:"-" gorm:"default:false"`
 	// Status    string         `json:"requestStatus"`
 	// Method    string         `json:"requestMethod"`
 }
 
+// TemplateAsset is one file of a ZIP template bundle, stored next to the template in MinIO
+type TemplateAsset struct {
+	ID          string    `json:"id"`
+	TemplateId  string    `json:"templateId" gorm:"index"`
+	Path        string    `json:"path"`
+	ObjectName  string    `json:"objectName"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
 type Logs struct {
 	ID                  string         `json:"id"`
 	DocumentName        string         `json:"documentName"`
@@ -38,7 +66,7 @@ type Logs struct {
 	TemplateId          string         `json:"templateId"`
 	Status              string         `json:"requestStatus"`
 	Method              string         `json:"requestMethod"`
-	JsonPayload         string         `json:"jsonPayload"`
+	JsonPayload         JSONPayload    `json:"jsonPayload"`
 	RefNumber           string         `json:"refNumber"`
 	CreatedAt           time.Time      `json:"created_at"`
 	DeletedAt           gorm.DeletedAt `json:"deleted_at"`
@@ -51,7 +79,7 @@ type FailedGenerations struct {
 	TemplateId   string         `json:"templateId"`
 	Status       string         `json:"requestStatus"`
 	Method       string         `json:"requestMethod"`
-	JsonPayload  string         `json:"jsonPayload"`
+	JsonPayload  JSONPayload    `json:"jsonPayload"`
 	RefNumber    string         `json:"refNumber"`
 	CreatedAt    time.Time      `json:"created_at"`
 	DeletedAt    gorm.DeletedAt `json:"deleted_at"`
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// RetentionPolicy keeps the rows of an entity for RetainDays, after which the sweeper soft-deletes them
+// and, once the trash grace period is over, removes them and their stored objects for good.
+// A document policy with a TemplateId applies to that template's documents instead of the default document policy.
+type RetentionPolicy struct {
+	ID         string    `json:"id"`
+	Entity     string    `json:"entity" gorm:"index"`
+	TemplateId string    `json:"templateId" gorm:"index"`
+	RetainDays int       `json:"retainDays"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// PurgeRun is one run of the retention sweeper, with its report as JSON
+type PurgeRun struct {
+	ID         string     `json:"id"`
+	Trigger    string     `json:"trigger"`
+	DryRun     bool       `json:"dryRun"`
+	Report     string     `json:"-"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt" gorm:"index"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TemplateRevision is one uploaded version of a template's content; the template serves the published revision
+type TemplateRevision struct {
+	ID          string     `json:"id"`
+	TemplateId  string     `json:"templateId" gorm:"index"`
+	Revision    int        `json:"revision"`
+	FileName    string     `json:"fileName"`
+	Status      string     `json:"status"`
+	Check       string     `json:"check"`
+	Report      string     `json:"report"`
+	CreatedBy   string     `json:"createdBy"`
+	SubmittedBy string     `json:"submittedBy"`
+	ReviewedBy  string     `json:"reviewedBy"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatedAt *time.Time `json:"activated_at"`
+	// Changes are the template details an imported revision replaces once it is published
+	Changes *RevisionChanges `json:"changes,omitempty" gorm:"serializer:json;type:text"`
+}
+
+// RevisionChanges are the name, metadata, assets, translations and samples that come with a revision
+type RevisionChanges struct {
+	Name          string                       `json:"templateName"`
+	DefaultLocale string                       `json:"defaultLocale"`
+	Description   string                       `json:"description"`
+	Category      string                       `json:"category"`
+	Owner         string                       `json:"owner"`
+	Tags          []string                     `json:"tags"`
+	Metadata      map[string]string            `json:"metadata"`
+	Assets        []TemplateAsset              `json:"assets"`
+	Translations  map[string]map[string]string `json:"translations"`
+	Samples       []RevisionSample             `json:"samples"`
+}
+
+// RevisionSample is a sample payload that comes with a revision
+type RevisionSample struct {
+	Name   string          `json:"name"`
+	Locale string          `json:"locale"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// WorkflowTransition records one state change of a template revision, the audit trail of the publish workflow
+type WorkflowTransition struct {
+	ID         string    `json:"id"`
+	TemplateId string    `json:"templateId" gorm:"index"`
+	Revision   int       `json:"revision"`
+	FromStatus string    `json:"from"`
+	ToStatus   string    `json:"to"`
+	Actor      string    `json:"actor"`
+	Comment    string    `json:"comment"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TemplateSample is a named sample payload of a template together with its approved golden rendering
+type TemplateSample struct {
+	ID              string    `json:"id"`
+	TemplateId      string    `json:"templateId" gorm:"index"`
+	Name            string    `json:"name"`
+	Data            string    `json:"data"`
+	Locale          string    `json:"locale"`
+	GoldenRevision  int       `json:"goldenRevision"`
+	GoldenText      string    `json:"-"`
+	GoldenImage     string    `json:"goldenImage"`
+	GoldenUpdatedAt time.Time `json:"goldenUpdatedAt"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
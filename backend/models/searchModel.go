@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// TemplateSearchPath is a payload field of a template's documents that document search looks into, as a dot separated path
+type TemplateSearchPath struct {
+	ID         string    `json:"id"`
+	TemplateId string    `json:"templateId" gorm:"index"`
+	Path       string    `json:"path"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// DocumentSearch holds the searchable text of a document: its description and the values of its template's search paths
+type DocumentSearch struct {
+	DocumentId string    `json:"documentId" gorm:"primaryKey"`
+	TemplateId string    `json:"templateId" gorm:"index"`
+	Content    string    `json:"content"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
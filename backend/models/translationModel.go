@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// TranslationCatalog holds the key to string translations of one template for one locale
+type TranslationCatalog struct {
+	ID         string    `json:"id"`
+	TemplateId string    `json:"templateId" gorm:"index"`
+	Locale     string    `json:"locale"`
+	Entries    string    `json:"entries"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
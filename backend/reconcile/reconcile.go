@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"example/pdfgenerator/initializers"
+	"example/pdfgenerator/services"
+)
+
+func init() {
+	initializers.LoadEnvVariables()
+	initializers.ConnectToDB()
+	initializers.InitMinioClient()
+}
+
+// reconcile compares the database with object storage and prints the report; -confirm fixes what does not match
+func main() {
+	confirm := flag.Bool("confirm", false, "fix what does not match instead of only reporting it")
+	flag.Parse()
+
+	report, err := services.Reconcile(initializers.DB, "command", !*confirm)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(report)
+	if err != nil {
+		log.Fatalf("Error reconciling storage: %v", err)
+	}
+}
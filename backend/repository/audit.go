@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AuditRepository appends to and reads the audit log
+type AuditRepository interface {
+	// Record appends an event, giving it an ID and time when it has none
+	Record(event models.AuditEvent) error
+	// List returns a page of LogList and the number of matching events
+	List(list ListQuery) ([]models.AuditEvent, int64, error)
+}
+
+// NewAuditRepository returns the AuditRepository of a database
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return auditEvents{db}
+}
+
+type auditEvents struct {
+	db *gorm.DB
+}
+
+func (r auditEvents) Record(event models.AuditEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	return r.db.Create(&event).Error
+}
+
+func (r auditEvents) List(list ListQuery) ([]models.AuditEvent, int64, error) {
+	var events []models.AuditEvent
+	total, err := Paginate(r.db.Model(&models.AuditEvent{}), LogList, list, &events)
+	return events, total, err
+}
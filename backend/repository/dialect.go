@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Dialect writes the SQL that differs between the databases the service runs on
+type Dialect interface {
+	// Weekday is an expression for the day of the week of a UTC timestamp column, 0 for Sunday to 6 for Saturday
+	Weekday(column string) string
+	// PayloadCondition matches rows whose JSON column holds value at a path of keys
+	PayloadCondition(column string, path []string, value string) (string, []interface{}, error)
+	// TextMatch matches rows whose text column matches a web search query
+	TextMatch(column, search string) (string, []interface{})
+	// TextRank is an expression ranking how well a text column matches a web search query, higher first
+	TextRank(column, search string) (string, []interface{})
+}
+
+// For returns the dialect of a database connection; anything but SQLite is taken for Postgres
+func For(db *gorm.DB) Dialect {
+	if db.Dialector.Name() == "sqlite" {
+		return sqlite{}
+	}
+	return postgres{}
+}
+
+// payloadCandidates are the values a payload filter compares with: the text itself and, when it reads as one,
+// the number, boolean or null it spells, so that "123" and 123 both match
+func payloadCandidates(value string) []interface{} {
+	candidates := []interface{}{value}
+	var typed interface{}
+	if err := json.Unmarshal([]byte(value), &typed); err == nil {
+		switch typed.(type) {
+		case float64, bool, nil:
+			candidates = append(candidates, json.RawMessage(value))
+		}
+	}
+	return candidates
+}
+
+// postgres uses JSONB containment and full-text search with the simple configuration
+type postgres struct{}
+
+func (postgres) Weekday(column string) string {
+	return "CAST(EXTRACT(DOW FROM " + column + " AT TIME ZONE 'UTC') AS INTEGER)"
+}
+
+func (postgres) PayloadCondition(column string, path []string, value string) (string, []interface{}, error) {
+	candidates := payloadCandidates(value)
+	conditions := make([]string, len(candidates))
+	args := make([]interface{}, len(candidates))
+	for i, candidate := range candidates {
+		// nest the value under the path, from the innermost key out
+		for j := len(path) - 1; j >= 0; j-- {
+			candidate = map[string]interface{}{path[j]: candidate}
+		}
+		contained, err := json.Marshal(candidate)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions[i] = column + " @> ?::jsonb"
+		args[i] = string(contained)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args, nil
+}
+
+func (postgres) TextMatch(column, search string) (string, []interface{}) {
+	return "to_tsvector('simple', " + column + ") @@ websearch_to_tsquery('simple', ?)", []interface{}{search}
+}
+
+func (postgres) TextRank(column, search string) (string, []interface{}) {
+	return "ts_rank(to_tsvector('simple', " + column + "), websearch_to_tsquery('simple', ?))", []interface{}{search}
+}
+
+// sqlite reads payloads with the JSON functions and approximates full-text search with LIKE:
+// every word of the query must appear, words with a leading - must not, and phrases and "or" are not understood
+type sqlite struct{}
+
+func (sqlite) Weekday(column string) string {
+	return "CAST(strftime('%w', " + column + ") AS INTEGER)"
+}
+
+func (sqlite) PayloadCondition(column string, path []string, value string) (string, []interface{}, error) {
+	quoted := make([]string, len(path))
+	for i, key := range path {
+		quoted[i] = `"` + strings.ReplaceAll(key, `"`, `\"`) + `"`
+	}
+	jsonPath := "$." + strings.Join(quoted, ".")
+
+	conditions := []string{"(json_type(" + column + ", ?) = 'text' AND json_extract(" + column + ", ?) = ?)"}
+	args := []interface{}{jsonPath, jsonPath, value}
+	var typed interface{}
+	if err := json.Unmarshal([]byte(value), &typed); err == nil {
+		switch typed := typed.(type) {
+		case float64:
+			conditions = append(conditions, "(json_type("+column+", ?) IN ('integer', 'real') AND json_extract("+column+", ?) = ?)")
+			args = append(args, jsonPath, jsonPath, typed)
+		case bool:
+			conditions = append(conditions, "json_type("+column+", ?) = ?")
+			args = append(args, jsonPath, fmt.Sprint(typed))
+		case nil:
+			conditions = append(conditions, "json_type("+column+", ?) = 'null'")
+			args = append(args, jsonPath)
+		}
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args, nil
+}
+
+func (sqlite) TextMatch(column, search string) (string, []interface{}) {
+	include, exclude := sqliteTerms(search)
+	if len(include) == 0 {
+		return "1 = 0", nil
+	}
+	var conditions []string
+	var args []interface{}
+	for _, term := range include {
+		conditions = append(conditions, "LOWER("+column+") LIKE ? ESCAPE '\\'")
+		args = append(args, containsPattern(term))
+	}
+	for _, term := range exclude {
+		conditions = append(conditions, "LOWER("+column+") NOT LIKE ? ESCAPE '\\'")
+		args = append(args, containsPattern(term))
+	}
+	return "(" + strings.Join(conditions, " AND ") + ")", args
+}
+
+func (sqlite) TextRank(column, search string) (string, []interface{}) {
+	include, _ := sqliteTerms(search)
+	if len(include) == 0 {
+		return "0", nil
+	}
+	// the number of times the query's words appear
+	parts := make([]string, len(include))
+	args := make([]interface{}, 0, 2*len(include))
+	for i, term := range include {
+		parts[i] = "(LENGTH(LOWER(" + column + ")) - LENGTH(REPLACE(LOWER(" + column + "), ?, ''))) / LENGTH(?)"
+		args = append(args, term, term)
+	}
+	return "(" + strings.Join(parts, " + ") + ")", args
+}
+
+// containsPattern is a LIKE pattern, escaped with a backslash, matching text that contains a word as typed
+func containsPattern(word string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(word)
+	return "%" + escaped + "%"
+}
+
+// sqliteTerms splits a web search query into the lowercase words it asks for and those it excludes
+func sqliteTerms(search string) ([]string, []string) {
+	var include, exclude []string
+	for _, word := range strings.Fields(strings.ToLower(strings.ReplaceAll(search, `"`, " "))) {
+		if word == "or" {
+			continue
+		}
+		if excluded, ok := strings.CutPrefix(word, "-"); ok {
+			if excluded != "" {
+				exclude = append(exclude, excluded)
+			}
+			continue
+		}
+		include = append(include, word)
+	}
+	return include, exclude
+}
@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"gorm.io/gorm"
+)
+
+// DocumentRepository reads the live documents; generating and deleting them goes through the services,
+// which keep their PDFs in step
+type DocumentRepository interface {
+	// ByRefNumber finds a document, or returns ErrNotFound
+	ByRefNumber(refNumber string) (models.Document, error)
+	// ByVerificationToken finds the document a QR code points to, or returns ErrNotFound
+	ByVerificationToken(token string) (models.Document, error)
+	// List returns a page of DocumentList and the number of matching documents
+	List(list ListQuery) ([]models.Document, int64, error)
+	// CountCreatedBetween counts the documents created within a time range, both ends included
+	CountCreatedBetween(start, end time.Time) (int64, error)
+	// PerWeekday counts the documents created since a time by UTC day of the week, 0 for Sunday to 6 for Saturday
+	PerWeekday(since time.Time) (map[int]int, error)
+}
+
+// NewDocumentRepository returns the DocumentRepository of a database
+func NewDocumentRepository(db *gorm.DB) DocumentRepository {
+	return documents{db}
+}
+
+type documents struct {
+	db *gorm.DB
+}
+
+func (r documents) ByRefNumber(refNumber string) (models.Document, error) {
+	var document models.Document
+	err := r.db.Where("ref_number = ?", refNumber).First(&document).Error
+	return document, err
+}
+
+func (r documents) ByVerificationToken(token string) (models.Document, error) {
+	var document models.Document
+	err := r.db.Where("verification_token = ?", token).First(&document).Error
+	return document, err
+}
+
+func (r documents) List(list ListQuery) ([]models.Document, int64, error) {
+	var documents []models.Document
+	total, err := Paginate(r.db.Model(&models.Document{}), DocumentList, list, &documents)
+	return documents, total, err
+}
+
+func (r documents) CountCreatedBetween(start, end time.Time) (int64, error) {
+	return countCreatedBetween(r.db, &models.Document{}, start, end)
+}
+
+func (r documents) PerWeekday(since time.Time) (map[int]int, error) {
+	var rows []struct {
+		Weekday int
+		Count   int
+	}
+	weekday := For(r.db).Weekday("created_at")
+	err := r.db.Table("documents").
+		Select(weekday+" AS weekday, COUNT(*) AS count").
+		Where("created_at >= ?", since).
+		Group(weekday).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[int]int{}
+	for _, row := range rows {
+		counts[row.Weekday] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"gorm.io/gorm"
+)
+
+// FailureRepository keeps the list of failed generation requests
+type FailureRepository interface {
+	// Record adds a failed generation
+	Record(generation models.FailedGenerations) error
+	// List returns a page of FailedGenerationList and the number of matching failures
+	List(list ListQuery) ([]models.FailedGenerations, int64, error)
+	// CountCreatedBetween counts the failures recorded within a time range, both ends included
+	CountCreatedBetween(start, end time.Time) (int64, error)
+}
+
+// NewFailureRepository returns the FailureRepository of a database
+func NewFailureRepository(db *gorm.DB) FailureRepository {
+	return failures{db}
+}
+
+type failures struct {
+	db *gorm.DB
+}
+
+func (r failures) Record(generation models.FailedGenerations) error {
+	return r.db.Create(&generation).Error
+}
+
+func (r failures) List(list ListQuery) ([]models.FailedGenerations, int64, error) {
+	var generations []models.FailedGenerations
+	total, err := Paginate(r.db.Model(&models.FailedGenerations{}), FailedGenerationList, list, &generations)
+	return generations, total, err
+}
+
+func (r failures) CountCreatedBetween(start, end time.Time) (int64, error) {
+	return countCreatedBetween(r.db, &models.FailedGenerations{}, start, end)
+}
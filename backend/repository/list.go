@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ListResource describes what a list endpoint can be sorted, filtered and searched by, as query names mapped to columns.
+// Payload names the JSONB column that data.<path> filters look into.
+type ListResource struct {
+	Sorts       map[string]string
+	Filters     map[string]string
+	Search      []string
+	Payload     string
+	DefaultSort string
+}
+
+// ListQuery is one page request of a list endpoint; a zero Limit returns every row
+type ListQuery struct {
+	Limit   int
+	Offset  int
+	Sort    string
+	Desc    bool
+	From    *time.Time
+	To      *time.Time
+	Filters map[string]string
+	Data    map[string]string
+	Search  string
+}
+
+// List resources of the repositories' lists
+var (
+	DocumentList = ListResource{
+		Sorts:       map[string]string{"createdAt": "created_at", "documentName": "document_name", "refNumber": "ref_number"},
+		Filters:     map[string]string{"templateId": "template_id", "refNumber": "ref_number"},
+		Search:      []string{"description", "document_name"},
+		Payload:     "json_payload",
+		DefaultSort: "createdAt",
+	}
+	LogList = ListResource{
+		Sorts: map[string]string{"createdAt": "created_at", "status": "outcome", "method": "method", "refNumber": "ref_number", "eventType": "event_type", "durationMs": "duration_ms"},
+		Filters: map[string]string{"status": "outcome", "method": "method", "templateId": "template_id", "refNumber": "ref_number",
+			"eventType": "event_type", "actor": "actor", "requestId": "request_id", "targetType": "target_type", "targetId": "target_id", "errorCode": "error_code"},
+		Search:      []string{"description", "message", "path"},
+		Payload:     "json_payload",
+		DefaultSort: "createdAt",
+	}
+	FailedGenerationList = ListResource{
+		Sorts:       map[string]string{"createdAt": "created_at", "status": "status", "method": "method", "refNumber": "ref_number"},
+		Filters:     map[string]string{"status": "status", "method": "method", "templateId": "template_id", "refNumber": "ref_number"},
+		Search:      []string{"description", "document_name"},
+		Payload:     "json_payload",
+		DefaultSort: "createdAt",
+	}
+)
+
+// Paginate applies a list query to query and loads the requested page into out, returning the total number of matching rows
+func Paginate(query *gorm.DB, resource ListResource, list ListQuery, out interface{}) (int64, error) {
+	for name, value := range list.Filters {
+		column, ok := resource.Filters[name]
+		if !ok {
+			return 0, fmt.Errorf("cannot filter by %s", name)
+		}
+		query = query.Where(column+" = ?", value)
+	}
+	for path, value := range list.Data {
+		if resource.Payload == "" {
+			return 0, fmt.Errorf("cannot filter by payload")
+		}
+		condition, args, err := PayloadCondition(query, resource.Payload, path, value)
+		if err != nil {
+			return 0, err
+		}
+		query = query.Where(condition, args...)
+	}
+	if list.From != nil {
+		query = query.Where("created_at >= ?", *list.From)
+	}
+	if list.To != nil {
+		query = query.Where("created_at < ?", *list.To)
+	}
+	if search := strings.TrimSpace(list.Search); search != "" && len(resource.Search) > 0 {
+		pattern := containsPattern(strings.ToLower(search))
+		conditions := make([]string, len(resource.Search))
+		args := make([]interface{}, len(resource.Search))
+		for i, column := range resource.Search {
+			conditions[i] = "LOWER(" + column + ") LIKE ? ESCAPE '\\'"
+			args[i] = pattern
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+
+	// the session lets the count and the page share the conditions without one changing the other
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return 0, err
+	}
+
+	sort := list.Sort
+	if sort == "" {
+		sort = resource.DefaultSort
+	}
+	column, ok := resource.Sorts[sort]
+	if !ok {
+		return 0, fmt.Errorf("cannot sort by %s", sort)
+	}
+	order := column
+	if list.Desc {
+		order += " desc"
+	}
+	// id breaks ties so rows do not move between pages
+	query = query.Order(order).Order("id")
+
+	if list.Limit > 0 {
+		query = query.Limit(list.Limit).Offset(list.Offset)
+	}
+	return total, query.Find(out).Error
+}
+
+// PayloadCondition matches rows whose payload holds value at a dot separated path, such as customer.id=123.
+// Values are compared as text and, when they read as one, as a number, boolean or null, so that "123" and 123 both match.
+func PayloadCondition(query *gorm.DB, column, path, value string) (string, []interface{}, error) {
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return "", nil, fmt.Errorf("invalid payload path %q", path)
+		}
+	}
+	return For(query).PayloadCondition(column, segments, value)
+}
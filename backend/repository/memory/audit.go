@@ -0,0 +1,42 @@
+package memory
+
+import (
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+
+	"github.com/google/uuid"
+)
+
+// Audit is an in-memory AuditRepository; it is not safe for concurrent use
+type Audit struct {
+	Events []models.AuditEvent
+	// Err, when set, is returned by every method
+	Err error
+	// LastList is the latest query passed to List
+	LastList repository.ListQuery
+}
+
+func (r *Audit) Record(event models.AuditEvent) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	r.Events = append(r.Events, event)
+	return nil
+}
+
+func (r *Audit) List(list repository.ListQuery) ([]models.AuditEvent, int64, error) {
+	r.LastList = list
+	if r.Err != nil {
+		return nil, 0, r.Err
+	}
+	events, total := page(r.Events, func(event models.AuditEvent) time.Time { return event.CreatedAt }, list)
+	return events, total, nil
+}
@@ -0,0 +1,81 @@
+package memory
+
+import (
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+)
+
+// Documents is an in-memory DocumentRepository; it is not safe for concurrent use
+type Documents struct {
+	Rows []models.Document
+	// Err, when set, is returned by every method
+	Err error
+	// LastList is the latest query passed to List
+	LastList repository.ListQuery
+}
+
+func (r *Documents) ByRefNumber(refNumber string) (models.Document, error) {
+	return r.find(func(document models.Document) bool { return document.RefNumber == refNumber })
+}
+
+func (r *Documents) ByVerificationToken(token string) (models.Document, error) {
+	return r.find(func(document models.Document) bool { return document.VerificationToken == token })
+}
+
+func (r *Documents) List(list repository.ListQuery) ([]models.Document, int64, error) {
+	r.LastList = list
+	if r.Err != nil {
+		return nil, 0, r.Err
+	}
+	documents, total := page(r.live(), documentCreatedAt, list)
+	return documents, total, nil
+}
+
+func (r *Documents) CountCreatedBetween(start, end time.Time) (int64, error) {
+	if r.Err != nil {
+		return 0, r.Err
+	}
+	return countBetween(r.live(), documentCreatedAt, start, end), nil
+}
+
+// PerWeekday counts deleted documents too, like the query it stands in for
+func (r *Documents) PerWeekday(since time.Time) (map[int]int, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	counts := map[int]int{}
+	for _, document := range r.Rows {
+		if !document.CreatedAt.Before(since) {
+			counts[int(document.CreatedAt.UTC().Weekday())]++
+		}
+	}
+	return counts, nil
+}
+
+func (r *Documents) find(match func(models.Document) bool) (models.Document, error) {
+	if r.Err != nil {
+		return models.Document{}, r.Err
+	}
+	for _, document := range r.live() {
+		if match(document) {
+			return document, nil
+		}
+	}
+	return models.Document{}, repository.ErrNotFound
+}
+
+func (r *Documents) live() []models.Document {
+	var live []models.Document
+	for _, document := range r.Rows {
+		if !document.DeletedAt.Valid {
+			live = append(live, document)
+		}
+	}
+	return live
+}
+
+func documentCreatedAt(document models.Document) time.Time {
+	return document.CreatedAt
+}
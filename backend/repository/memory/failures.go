@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+)
+
+// Failures is an in-memory FailureRepository; it is not safe for concurrent use
+type Failures struct {
+	Rows []models.FailedGenerations
+	// Err, when set, is returned by every method
+	Err error
+	// LastList is the latest query passed to List
+	LastList repository.ListQuery
+}
+
+func (r *Failures) Record(generation models.FailedGenerations) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	r.Rows = append(r.Rows, generation)
+	return nil
+}
+
+func (r *Failures) List(list repository.ListQuery) ([]models.FailedGenerations, int64, error) {
+	r.LastList = list
+	if r.Err != nil {
+		return nil, 0, r.Err
+	}
+	generations, total := page(r.live(), failureCreatedAt, list)
+	return generations, total, nil
+}
+
+func (r *Failures) CountCreatedBetween(start, end time.Time) (int64, error) {
+	if r.Err != nil {
+		return 0, r.Err
+	}
+	return countBetween(r.live(), failureCreatedAt, start, end), nil
+}
+
+func (r *Failures) live() []models.FailedGenerations {
+	var live []models.FailedGenerations
+	for _, generation := range r.Rows {
+		if !generation.DeletedAt.Valid {
+			live = append(live, generation)
+		}
+	}
+	return live
+}
+
+func failureCreatedAt(generation models.FailedGenerations) time.Time {
+	return generation.CreatedAt
+}
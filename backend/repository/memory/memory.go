@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"example/pdfgenerator/repository"
+)
+
+// page applies the date range, creation-time order and paging of a list query to rows.
+// Filters, payload filters, search and other sort columns are not applied; fakes record the query for tests to check instead.
+func page[T any](rows []T, createdAt func(T) time.Time, list repository.ListQuery) ([]T, int64) {
+	matching := []T{}
+	for _, row := range rows {
+		created := createdAt(row)
+		if (list.From != nil && created.Before(*list.From)) || (list.To != nil && !created.Before(*list.To)) {
+			continue
+		}
+		matching = append(matching, row)
+	}
+	sort.SliceStable(matching, func(i, j int) bool {
+		if list.Desc {
+			return createdAt(matching[i]).After(createdAt(matching[j]))
+		}
+		return createdAt(matching[i]).Before(createdAt(matching[j]))
+	})
+
+	total := int64(len(matching))
+	if list.Offset >= len(matching) {
+		return []T{}, total
+	}
+	matching = matching[list.Offset:]
+	if list.Limit > 0 && list.Limit < len(matching) {
+		matching = matching[:list.Limit]
+	}
+	return matching, total
+}
+
+// countBetween counts the rows created within a time range, both ends included
+func countBetween[T any](rows []T, createdAt func(T) time.Time, start, end time.Time) int64 {
+	var count int64
+	for _, row := range rows {
+		if created := createdAt(row); !created.Before(start) && !created.After(end) {
+			count++
+		}
+	}
+	return count
+}
+
+// the fakes must keep up with the interfaces they stand in for
+var (
+	_ repository.TemplateRepository = (*Templates)(nil)
+	_ repository.DocumentRepository = (*Documents)(nil)
+	_ repository.AuditRepository    = (*Audit)(nil)
+	_ repository.FailureRepository  = (*Failures)(nil)
+	_ repository.PartialRepository  = (*Partials)(nil)
+	_ repository.ObjectStore        = (*Objects)(nil)
+)
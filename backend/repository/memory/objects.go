@@ -0,0 +1,117 @@
+package memory
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Object is a file kept by Objects
+type Object struct {
+	Content     []byte
+	ContentType string
+	Modified    time.Time
+}
+
+// Objects is an in-memory ObjectStore; it is not safe for concurrent use
+type Objects struct {
+	// Buckets holds the objects by bucket, then by name
+	Buckets map[string]map[string]Object
+	// Err, when set, is returned by every method
+	Err error
+	// Fail, when set, is called before every change and its error returned instead of making it
+	Fail func(action, bucketName, objectName string) error
+}
+
+func (s *Objects) Put(bucketName, objectName string, content io.Reader, contentType string) error {
+	if err := s.check("put", bucketName, objectName); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	s.bucket(bucketName)[objectName] = Object{Content: data, ContentType: contentType, Modified: time.Now()}
+	return nil
+}
+
+func (s *Objects) Get(bucketName, objectName string) ([]byte, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	object, ok := s.Buckets[bucketName][objectName]
+	if !ok {
+		return nil, fmt.Errorf("object %s/%s does not exist", bucketName, objectName)
+	}
+	return object.Content, nil
+}
+
+func (s *Objects) Remove(bucketName, objectName string) error {
+	if err := s.check("remove", bucketName, objectName); err != nil {
+		return err
+	}
+	delete(s.Buckets[bucketName], objectName)
+	return nil
+}
+
+func (s *Objects) Move(bucketName, from, to string) error {
+	if err := s.check("move", bucketName, from); err != nil {
+		return err
+	}
+	object, ok := s.Buckets[bucketName][from]
+	if !ok {
+		return fmt.Errorf("object %s/%s does not exist", bucketName, from)
+	}
+	object.Modified = time.Now()
+	s.bucket(bucketName)[to] = object
+	delete(s.Buckets[bucketName], from)
+	return nil
+}
+
+func (s *Objects) Exists(bucketName, objectName string) (bool, error) {
+	if s.Err != nil {
+		return false, s.Err
+	}
+	_, ok := s.Buckets[bucketName][objectName]
+	return ok, nil
+}
+
+func (s *Objects) List(bucketName string) (map[string]time.Time, error) {
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	files := map[string]time.Time{}
+	for name, object := range s.Buckets[bucketName] {
+		files[name] = object.Modified
+	}
+	return files, nil
+}
+
+// Names lists the objects of a bucket, for tests to compare
+func (s *Objects) Names(bucketName string) map[string]bool {
+	names := map[string]bool{}
+	for name := range s.Buckets[bucketName] {
+		names[name] = true
+	}
+	return names
+}
+
+func (s *Objects) check(action, bucketName, objectName string) error {
+	if s.Err != nil {
+		return s.Err
+	}
+	if s.Fail != nil {
+		return s.Fail(action, bucketName, objectName)
+	}
+	return nil
+}
+
+func (s *Objects) bucket(bucketName string) map[string]Object {
+	if s.Buckets == nil {
+		s.Buckets = map[string]map[string]Object{}
+	}
+	if s.Buckets[bucketName] == nil {
+		s.Buckets[bucketName] = map[string]Object{}
+	}
+	return s.Buckets[bucketName]
+}
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+
+	"gorm.io/gorm"
+)
+
+// Partials is an in-memory PartialRepository; it is not safe for concurrent use
+type Partials struct {
+	Rows []models.Partial
+	// Err, when set, is returned by every method
+	Err error
+}
+
+func (r *Partials) Latest() ([]models.Partial, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	latest := map[string]models.Partial{}
+	for _, partial := range r.live() {
+		if current, ok := latest[partial.Name]; !ok || partial.Version > current.Version {
+			latest[partial.Name] = partial
+		}
+	}
+	partials := []models.Partial{}
+	for _, partial := range latest {
+		partials = append(partials, partial)
+	}
+	sort.Slice(partials, func(i, j int) bool { return partials[i].Name < partials[j].Name })
+	return partials, nil
+}
+
+func (r *Partials) Versions(name string) ([]models.Partial, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	versions := []models.Partial{}
+	for _, partial := range r.live() {
+		if partial.Name == name {
+			versions = append(versions, partial)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+// Delete soft-deletes, like the query it stands in for
+func (r *Partials) Delete(name string) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	deleted := false
+	for i := range r.Rows {
+		if r.Rows[i].Name == name && !r.Rows[i].DeletedAt.Valid {
+			r.Rows[i].DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			deleted = true
+		}
+	}
+	if !deleted {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *Partials) live() []models.Partial {
+	var live []models.Partial
+	for _, partial := range r.Rows {
+		if !partial.DeletedAt.Valid {
+			live = append(live, partial)
+		}
+	}
+	return live
+}
@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+)
+
+// Templates is an in-memory TemplateRepository; it is not safe for concurrent use
+type Templates struct {
+	Rows         []models.Template
+	Revisions    []models.TemplateRevision
+	Samples      []models.TemplateSample
+	Translations []models.TranslationCatalog
+	// Err, when set, is returned by every method
+	Err error
+}
+
+func (r *Templates) ByRefNumber(refNumber string) (models.Template, error) {
+	if r.Err != nil {
+		return models.Template{}, r.Err
+	}
+	for _, template := range r.Rows {
+		if template.RefNumber == refNumber && !template.DeletedAt.Valid {
+			return template, nil
+		}
+	}
+	return models.Template{}, repository.ErrNotFound
+}
+
+func (r *Templates) ByRefNumbers(refNumbers []string) ([]models.Template, error) {
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	wanted := map[string]bool{}
+	for _, refNumber := range refNumbers {
+		wanted[refNumber] = true
+	}
+	templates := []models.Template{}
+	for _, template := range r.live() {
+		if wanted[template.RefNumber] {
+			templates = append(templates, template)
+		}
+	}
+	return templates, nil
+}
+
+func (r *Templates) CountCreatedBetween(start, end time.Time) (int64, error) {
+	if r.Err != nil {
+		return 0, r.Err
+	}
+	return countBetween(r.live(), func(template models.Template) time.Time { return template.CreatedAt }, start, end), nil
+}
+
+func (r *Templates) Revision(templateId string, number int) (models.TemplateRevision, error) {
+	if r.Err != nil {
+		return models.TemplateRevision{}, r.Err
+	}
+	for _, revision := range r.Revisions {
+		if revision.TemplateId == templateId && revision.Revision == number {
+			return revision, nil
+		}
+	}
+	return models.TemplateRevision{}, repository.ErrNotFound
+}
+
+func (r *Templates) Sample(templateId, name string) (models.TemplateSample, error) {
+	if r.Err != nil {
+		return models.TemplateSample{}, r.Err
+	}
+	for _, sample := range r.Samples {
+		if sample.TemplateId == templateId && sample.Name == name {
+			return sample, nil
+		}
+	}
+	return models.TemplateSample{}, repository.ErrNotFound
+}
+
+func (r *Templates) DeleteTranslations(templateId, locale string) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	kept := r.Translations[:0]
+	for _, catalog := range r.Translations {
+		if catalog.TemplateId != templateId || catalog.Locale != locale {
+			kept = append(kept, catalog)
+		}
+	}
+	deleted := len(r.Translations) - len(kept)
+	r.Translations = kept
+	if deleted == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *Templates) live() []models.Template {
+	var live []models.Template
+	for _, template := range r.Rows {
+		if !template.DeletedAt.Valid {
+			live = append(live, template)
+		}
+	}
+	return live
+}
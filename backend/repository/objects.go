@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ObjectStore keeps the files of templates and documents in buckets
+type ObjectStore interface {
+	// Put stores an object, replacing any object of the same name
+	Put(bucketName, objectName string, content io.Reader, contentType string) error
+	// Get returns the content of an object
+	Get(bucketName, objectName string) ([]byte, error)
+	// Remove deletes an object; removing one that does not exist is not an error
+	Remove(bucketName, objectName string) error
+	// Move renames an object within its bucket
+	Move(bucketName, from, to string) error
+	// Exists reports whether an object exists
+	Exists(bucketName, objectName string) (bool, error)
+	// List returns every object of a bucket with the time it was last modified
+	List(bucketName string) (map[string]time.Time, error)
+}
+
+// NewObjectStore returns the ObjectStore of a MinIO client
+func NewObjectStore(client *minio.Client) ObjectStore {
+	return objects{client}
+}
+
+type objects struct {
+	client *minio.Client
+}
+
+var errNoClient = errors.New("MinioClient is not initialized")
+
+func (s objects) Put(bucketName, objectName string, content io.Reader, contentType string) error {
+	if s.client == nil {
+		return errNoClient
+	}
+	if bucketName == "" || objectName == "" {
+		return errors.New("bucketName and objectName cannot be empty")
+	}
+	_, err := s.client.PutObject(context.Background(), bucketName, objectName, content, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (s objects) Get(bucketName, objectName string) ([]byte, error) {
+	if s.client == nil {
+		return nil, errNoClient
+	}
+	object, err := s.client.GetObject(context.Background(), bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	var buffer bytes.Buffer
+	if _, err := io.Copy(&buffer, object); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (s objects) Remove(bucketName, objectName string) error {
+	if s.client == nil {
+		return errNoClient
+	}
+	return s.client.RemoveObject(context.Background(), bucketName, objectName, minio.RemoveObjectOptions{})
+}
+
+func (s objects) Move(bucketName, from, to string) error {
+	if s.client == nil {
+		return errNoClient
+	}
+	_, err := s.client.CopyObject(context.Background(),
+		minio.CopyDestOptions{Bucket: bucketName, Object: to},
+		minio.CopySrcOptions{Bucket: bucketName, Object: from})
+	if err != nil {
+		return err
+	}
+	return s.client.RemoveObject(context.Background(), bucketName, from, minio.RemoveObjectOptions{})
+}
+
+func (s objects) Exists(bucketName, objectName string) (bool, error) {
+	if s.client == nil {
+		return false, errNoClient
+	}
+	_, err := s.client.StatObject(context.Background(), bucketName, objectName, minio.StatObjectOptions{})
+	if err == nil {
+		return true, nil
+	}
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return false, nil
+	}
+	return false, err
+}
+
+func (s objects) List(bucketName string) (map[string]time.Time, error) {
+	if s.client == nil {
+		return nil, errNoClient
+	}
+	files := map[string]time.Time{}
+	for object := range s.client.ListObjects(context.Background(), bucketName, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		files[object.Key] = object.LastModified
+	}
+	return files, nil
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"example/pdfgenerator/models"
+
+	"gorm.io/gorm"
+)
+
+// PartialRepository reads the versions of shared partials and layouts; uploading them goes through the services,
+// which store their content and check their references
+type PartialRepository interface {
+	// Latest returns the latest version of every partial and layout, by name
+	Latest() ([]models.Partial, error)
+	// Versions returns every version of a partial, newest first, or none when it does not exist
+	Versions(name string) ([]models.Partial, error)
+	// Delete removes every version of a partial, or returns ErrNotFound when it has none
+	Delete(name string) error
+}
+
+// NewPartialRepository returns the PartialRepository of a database
+func NewPartialRepository(db *gorm.DB) PartialRepository {
+	return partials{db}
+}
+
+type partials struct {
+	db *gorm.DB
+}
+
+func (r partials) Latest() ([]models.Partial, error) {
+	var versions []models.Partial
+	if err := r.db.Order("name, version desc").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	latest := []models.Partial{}
+	for _, partial := range versions {
+		if len(latest) == 0 || latest[len(latest)-1].Name != partial.Name {
+			latest = append(latest, partial)
+		}
+	}
+	return latest, nil
+}
+
+func (r partials) Versions(name string) ([]models.Partial, error) {
+	var versions []models.Partial
+	err := r.db.Where("name = ?", name).Order("version desc").Find(&versions).Error
+	return versions, err
+}
+
+func (r partials) Delete(name string) error {
+	result := r.db.Where("name = ?", name).Delete(&models.Partial{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return result.Error
+}
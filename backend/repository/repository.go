@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned when no row matches; it is gorm's own, so errors.Is works with either
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// countCreatedBetween counts the rows of a model created within a time range, both ends included
+func countCreatedBetween(db *gorm.DB, model interface{}, start, end time.Time) (int64, error) {
+	var count int64
+	err := db.Model(model).Where("created_at BETWEEN ? AND ?", start, end).Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,195 @@
+package repository_test
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"example/pdfgenerator/initializers"
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sqliteDocuments migrates a new in-memory SQLite database and stores documents in it
+func sqliteDocuments(t *testing.T, documents ...models.Document) *gorm.DB {
+	t.Helper()
+	db, err := initializers.ConnectSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = db.Session(&gorm.Session{Logger: logger.Discard})
+	previous := initializers.DB
+	initializers.DB = db
+	t.Cleanup(func() {
+		initializers.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	if _, err := initializers.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, document := range documents {
+		if err := db.Create(&document).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func refNumbers(documents []models.Document) string {
+	refs := make([]string, len(documents))
+	for i, document := range documents {
+		refs[i] = document.RefNumber
+	}
+	sort.Strings(refs)
+	return strings.Join(refs, " ")
+}
+
+func TestSQLitePerWeekday(t *testing.T) {
+	monday := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	// late on Monday in New York is Tuesday in UTC
+	newYork := time.FixedZone("EST", -5*60*60)
+	db := sqliteDocuments(t,
+		models.Document{ID: "1", RefNumber: "DOC-1", CreatedAt: monday},
+		models.Document{ID: "2", RefNumber: "DOC-2", CreatedAt: monday.Add(time.Hour)},
+		models.Document{ID: "3", RefNumber: "DOC-3", CreatedAt: time.Date(2024, 3, 4, 23, 30, 0, 0, newYork)},
+		models.Document{ID: "4", RefNumber: "DOC-4", CreatedAt: monday.AddDate(0, 0, 6)},
+		models.Document{ID: "5", RefNumber: "DOC-5", CreatedAt: monday.AddDate(0, 0, -1)},
+	)
+
+	counts, err := repository.NewDocumentRepository(db).PerWeekday(monday.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{1: 2, 2: 1, 0: 1}
+	if len(counts) != len(want) {
+		t.Errorf("got %v, want %v", counts, want)
+	}
+	for weekday, count := range want {
+		if counts[weekday] != count {
+			t.Errorf("weekday %d: %d documents, want %d", weekday, counts[weekday], count)
+		}
+	}
+}
+
+func TestSQLitePayloadFilter(t *testing.T) {
+	db := sqliteDocuments(t,
+		models.Document{ID: "1", RefNumber: "NUMBER", JsonPayload: models.JSONPayload(`{"customer":{"id":123,"vip":true}}`)},
+		models.Document{ID: "2", RefNumber: "TEXT", JsonPayload: models.JSONPayload(`{"customer":{"id":"123"}}`)},
+		models.Document{ID: "3", RefNumber: "OTHER", JsonPayload: models.JSONPayload(`{"customer":{"id":1234,"vip":false}}`)},
+		models.Document{ID: "4", RefNumber: "NONE", JsonPayload: models.JSONPayload(`{"customer":{"id":null}}`)},
+	)
+	documents := repository.NewDocumentRepository(db)
+
+	for filter, want := range map[string]string{
+		"customer.id=123":    "NUMBER TEXT",
+		"customer.vip=true":  "NUMBER",
+		"customer.vip=false": "OTHER",
+		"customer.id=null":   "NONE",
+		"customer.name=123":  "",
+	} {
+		path, value, _ := strings.Cut(filter, "=")
+		found, total, err := documents.List(repository.ListQuery{Data: map[string]string{path: value}})
+		if err != nil {
+			t.Fatalf("%s: %v", filter, err)
+		}
+		if got := refNumbers(found); got != want || total != int64(len(found)) {
+			t.Errorf("%s found %q (%d), want %q", filter, got, total, want)
+		}
+	}
+}
+
+func TestSQLiteSearchTakesWildcardsLiterally(t *testing.T) {
+	db := sqliteDocuments(t,
+		models.Document{ID: "1", RefNumber: "PERCENT", Description: "50% off the invoice"},
+		models.Document{ID: "2", RefNumber: "NUMBER", Description: "500 of the invoices"},
+		models.Document{ID: "3", RefNumber: "UNDERSCORE", Description: "line_item total"},
+		models.Document{ID: "4", RefNumber: "SPACE", Description: "line item total"},
+		models.Document{ID: "5", RefNumber: "BACKSLASH", Description: `path C:\invoices`},
+	)
+	dialect := repository.For(db)
+
+	for search, want := range map[string]string{
+		"50%":              "PERCENT",
+		"line_item":        "UNDERSCORE",
+		`c:\invoices`:      "BACKSLASH",
+		"invoice -50%":     "BACKSLASH NUMBER",
+		"total -line_item": "SPACE",
+	} {
+		match, args := dialect.TextMatch("description", search)
+		var found []models.Document
+		if err := db.Where(match, args...).Find(&found).Error; err != nil {
+			t.Fatalf("%s: %v", search, err)
+		}
+		if got := refNumbers(found); got != want {
+			t.Errorf("%q matched %q, want %q", search, got, want)
+		}
+	}
+
+	// the list search escapes its pattern the same way
+	found, _, err := repository.NewDocumentRepository(db).List(repository.ListQuery{Search: "50%"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := refNumbers(found); got != "PERCENT" {
+		t.Errorf("list search for 50%% found %q", got)
+	}
+}
+
+func TestSQLiteTextRank(t *testing.T) {
+	db := sqliteDocuments(t,
+		models.Document{ID: "1", RefNumber: "ONCE", Description: "invoice for March"},
+		models.Document{ID: "2", RefNumber: "TWICE", Description: "Invoice and invoice copy"},
+		models.Document{ID: "3", RefNumber: "NEVER", Description: "receipt"},
+	)
+	rank, args := repository.For(db).TextRank("description", "invoice")
+	var rows []struct {
+		RefNumber string
+		Rank      float64
+	}
+	if err := db.Model(&models.Document{}).Select("ref_number, "+rank+" AS rank", args...).Order("rank desc").Scan(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].RefNumber != "TWICE" || rows[0].Rank != 2 || rows[1].Rank != 1 || rows[2].Rank != 0 {
+		t.Errorf("ranked %+v", rows)
+	}
+}
+
+func TestSQLitePartials(t *testing.T) {
+	db := sqliteDocuments(t)
+	for _, partial := range []models.Partial{
+		{ID: "1", Name: "header", Version: 1},
+		{ID: "2", Name: "header", Version: 2},
+		{ID: "3", Name: "footer", Version: 1},
+	} {
+		if err := db.Create(&partial).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	partials := repository.NewPartialRepository(db)
+
+	latest, err := partials.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(latest) != 2 || latest[0].Name != "footer" || latest[1].ID != "2" {
+		t.Errorf("latest %+v, want footer and header version 2", latest)
+	}
+
+	if err := partials.Delete("header"); err != nil {
+		t.Fatal(err)
+	}
+	if versions, err := partials.Versions("header"); err != nil || len(versions) != 0 {
+		t.Errorf("versions after delete %+v, %v", versions, err)
+	}
+	if err := partials.Delete("header"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("second delete gave %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"gorm.io/gorm"
+)
+
+// TemplateRepository reads the live templates and the revisions, samples and translations that belong to them
+type TemplateRepository interface {
+	// ByRefNumber finds a template, or returns ErrNotFound
+	ByRefNumber(refNumber string) (models.Template, error)
+	// ByRefNumbers finds the templates among refNumbers, leaving out those that do not exist
+	ByRefNumbers(refNumbers []string) ([]models.Template, error)
+	// CountCreatedBetween counts the templates created within a time range, both ends included
+	CountCreatedBetween(start, end time.Time) (int64, error)
+	// Revision finds a template's revision by number, or returns ErrNotFound
+	Revision(templateId string, number int) (models.TemplateRevision, error)
+	// Sample finds a template's sample payload by name, or returns ErrNotFound
+	Sample(templateId, name string) (models.TemplateSample, error)
+	// DeleteTranslations removes a template's catalog for one locale, or returns ErrNotFound when it has none
+	DeleteTranslations(templateId, locale string) error
+}
+
+// NewTemplateRepository returns the TemplateRepository of a database
+func NewTemplateRepository(db *gorm.DB) TemplateRepository {
+	return templates{db}
+}
+
+type templates struct {
+	db *gorm.DB
+}
+
+func (r templates) ByRefNumber(refNumber string) (models.Template, error) {
+	var template models.Template
+	err := r.db.Where("ref_number = ?", refNumber).First(&template).Error
+	return template, err
+}
+
+func (r templates) ByRefNumbers(refNumbers []string) ([]models.Template, error) {
+	var templates []models.Template
+	err := r.db.Where("ref_number IN ?", refNumbers).Find(&templates).Error
+	return templates, err
+}
+
+func (r templates) CountCreatedBetween(start, end time.Time) (int64, error) {
+	return countCreatedBetween(r.db, &models.Template{}, start, end)
+}
+
+func (r templates) Revision(templateId string, number int) (models.TemplateRevision, error) {
+	var revision models.TemplateRevision
+	err := r.db.Where("template_id = ? AND revision = ?", templateId, number).First(&revision).Error
+	return revision, err
+}
+
+func (r templates) Sample(templateId, name string) (models.TemplateSample, error) {
+	var sample models.TemplateSample
+	err := r.db.Where("template_id = ? AND name = ?", templateId, name).First(&sample).Error
+	return sample, err
+}
+
+func (r templates) DeleteTranslations(templateId, locale string) error {
+	result := r.db.Where("template_id = ? AND locale = ?", templateId, locale).Delete(&models.TranslationCatalog{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return result.Error
+}
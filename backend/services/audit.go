@@ -0,0 +1,51 @@
+package services
+
+// Audit event outcomes, named like the statuses of the earlier request logs
+const (
+	AuditSuccess = "SUCCESS"
+	AuditFailed  = "FAILED"
+)
+
+// AnonymousActor is the actor of events of requests without an API token
+const AnonymousActor = "anonymous"
+
+// Audit event types
+const (
+	EventTemplateUploaded  = "template.uploaded"
+	EventTemplateViewed    = "template.viewed"
+	EventTemplateDeleted   = "template.deleted"
+	EventDocumentGenerated = "document.generated"
+	EventDocumentViewed    = "document.viewed"
+	EventDocumentDeleted   = "document.deleted"
+	EventDocumentVerified  = "document.verified"
+	EventTextGenerated     = "text.generated"
+	EventDocxGenerated     = "docx.generated"
+	EventHTMLRendered      = "html.rendered"
+	EventPartialUploaded   = "partial.uploaded"
+	EventPartialDeleted    = "partial.deleted"
+	EventMetricsViewed     = "metrics.viewed"
+	EventRetentionChanged  = "retention.changed"
+	EventRetentionPurged   = "retention.purged"
+	EventLegalHoldChanged  = "document.legal_hold"
+	EventTrashRestored     = "trash.restored"
+	EventStorageReconciled = "storage.reconciled"
+)
+
+// Error codes of failed audit events
+const (
+	ErrorInvalidRequest    = "invalid_request"
+	ErrorInvalidDate       = "invalid_date"
+	ErrorTemplateNotFound  = "template_not_found"
+	ErrorDocumentNotFound  = "document_not_found"
+	ErrorTemplateFetch     = "template_fetch_failed"
+	ErrorDocumentFetch     = "document_fetch_failed"
+	ErrorRenderFailed      = "render_failed"
+	ErrorStorageFailed     = "storage_failed"
+	ErrorDatabaseFailed    = "database_failed"
+	ErrorDeleteFailed      = "delete_failed"
+	ErrorHashMismatch      = "hash_mismatch"
+	ErrorVerificationToken = "token_not_found"
+	ErrorLegalHold         = "legal_hold"
+	ErrorNotPublished      = "template_not_published"
+	ErrorRunInProgress     = "run_in_progress"
+)
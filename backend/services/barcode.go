@@ -0,0 +1,218 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/datamatrix"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/qr"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const barcodeTextHeight = 16
+
+// BarcodeOptions controls how a barcode is drawn, it is filled from "key=value" template arguments
+type BarcodeOptions struct {
+	Width           int
+	Height          int
+	ErrorCorrection string
+	Text            string
+}
+
+// ParseBarcodeOptions reads width, height, size, ec and text options given to the barcode template functions
+func ParseBarcodeOptions(kind string, args []string) (BarcodeOptions, error) {
+	opts := BarcodeOptions{Width: 300, Height: 80, ErrorCorrection: "M"}
+	if isMatrixBarcode(kind) {
+		opts.Width, opts.Height = 150, 150
+	}
+
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return opts, fmt.Errorf("barcode option %q must be in the form key=value", arg)
+		}
+
+		key = strings.ToLower(key)
+		switch key {
+		case "width", "height", "size":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("barcode option %s must be a positive number", key)
+			}
+			if key != "height" {
+				opts.Width = n
+			}
+			if key != "width" {
+				opts.Height = n
+			}
+		case "ec":
+			opts.ErrorCorrection = strings.ToUpper(value)
+		case "text":
+			opts.Text = value
+		default:
+			return opts, fmt.Errorf("unknown barcode option %q", key)
+		}
+	}
+
+	return opts, nil
+}
+
+// EncodeBarcode builds an unscaled barcode of the given kind: code128, ean13, datamatrix or qr
+func EncodeBarcode(kind, content string, opts BarcodeOptions) (barcode.Barcode, error) {
+	switch strings.ToLower(kind) {
+	case "code128":
+		return code128.Encode(content)
+	case "ean13":
+		if len(content) != 12 && len(content) != 13 {
+			return nil, fmt.Errorf("ean13 needs 12 or 13 digits, got %q", content)
+		}
+		return ean.Encode(content)
+	case "datamatrix":
+		return datamatrix.Encode(content)
+	case "qr":
+		level, err := qrErrorCorrection(opts.ErrorCorrection)
+		if err != nil {
+			return nil, err
+		}
+		return qr.Encode(content, level, qr.Auto)
+	default:
+		return nil, fmt.Errorf("unsupported barcode type %q", kind)
+	}
+}
+
+// BarcodeSVG renders a barcode as an inline SVG element
+func BarcodeSVG(kind, content string, opts BarcodeOptions) (template.HTML, error) {
+	code, err := EncodeBarcode(kind, content, opts)
+	if err != nil {
+		return "", err
+	}
+
+	bounds := code.Bounds()
+	modulesX, modulesY := bounds.Dx(), bounds.Dy()
+	label := barcodeLabel(code, opts)
+
+	totalHeight := opts.Height
+	if label != "" {
+		totalHeight += barcodeTextHeight
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.Width, totalHeight, opts.Width, totalHeight)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#fff"/>`, opts.Width, totalHeight)
+
+	moduleWidth := float64(opts.Width) / float64(modulesX)
+	moduleHeight := float64(opts.Height) / float64(modulesY)
+	for y := 0; y < modulesY; y++ {
+		for x := 0; x < modulesX; {
+			if !isDark(code.At(bounds.Min.X+x, bounds.Min.Y+y)) {
+				x++
+				continue
+			}
+			run := 1
+			for x+run < modulesX && isDark(code.At(bounds.Min.X+x+run, bounds.Min.Y+y)) {
+				run++
+			}
+			fmt.Fprintf(&svg, `<rect x="%.3f" y="%.3f" width="%.3f" height="%.3f" fill="#000"/>`,
+				float64(x)*moduleWidth, float64(y)*moduleHeight, float64(run)*moduleWidth, moduleHeight)
+			x += run
+		}
+	}
+
+	if label != "" {
+		fmt.Fprintf(&svg, `<text x="%d" y="%d" font-family="monospace" font-size="13" text-anchor="middle" fill="#000">%s</text>`,
+			opts.Width/2, totalHeight-3, html.EscapeString(label))
+	}
+	svg.WriteString(`</svg>`)
+
+	return template.HTML(svg.String()), nil
+}
+
+// BarcodePNG renders a barcode as a PNG data URI suitable for an img src attribute
+func BarcodePNG(kind, content string, opts BarcodeOptions) (template.URL, error) {
+	code, err := EncodeBarcode(kind, content, opts)
+	if err != nil {
+		return "", err
+	}
+
+	scaled, err := barcode.Scale(code, opts.Width, opts.Height)
+	if err != nil {
+		return "", err
+	}
+
+	var img image.Image = scaled
+	if label := barcodeLabel(code, opts); label != "" {
+		canvas := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height+barcodeTextHeight))
+		draw.Draw(canvas, canvas.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(canvas, scaled.Bounds(), scaled, scaled.Bounds().Min, draw.Src)
+
+		face := basicfont.Face7x13
+		drawer := font.Drawer{Dst: canvas, Src: image.Black, Face: face}
+		textWidth := drawer.MeasureString(label).Round()
+		drawer.Dot = fixed.P((opts.Width-textWidth)/2, opts.Height+barcodeTextHeight-3)
+		drawer.DrawString(label)
+		img = canvas
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		return "", err
+	}
+
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(buffer.Bytes())), nil
+}
+
+// QRCodeDataURI encodes content as a square PNG QR code and returns it as a data URI
+func QRCodeDataURI(content string, size int) (template.URL, error) {
+	return BarcodePNG("qr", content, BarcodeOptions{Width: size, Height: size, ErrorCorrection: "M"})
+}
+
+func barcodeLabel(code barcode.Barcode, opts BarcodeOptions) string {
+	switch strings.ToLower(opts.Text) {
+	case "", "false", "no":
+		return ""
+	case "true", "yes":
+		return code.Content()
+	default:
+		return opts.Text
+	}
+}
+
+func qrErrorCorrection(level string) (qr.ErrorCorrectionLevel, error) {
+	switch level {
+	case "L":
+		return qr.L, nil
+	case "", "M":
+		return qr.M, nil
+	case "Q":
+		return qr.Q, nil
+	case "H":
+		return qr.H, nil
+	default:
+		return qr.M, fmt.Errorf("unknown QR error correction level %q, use L, M, Q or H", level)
+	}
+}
+
+func isMatrixBarcode(kind string) bool {
+	kind = strings.ToLower(kind)
+	return kind == "qr" || kind == "datamatrix"
+}
+
+func isDark(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r+g+b < 3*0x8000
+}
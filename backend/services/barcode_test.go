@@ -0,0 +1,64 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBarcodeOptions(t *testing.T) {
+	tests := []struct {
+		name          string
+		kind          string
+		args          []string
+		width, height int
+	}{
+		{"linear defaults", "code128", nil, 300, 80},
+		{"matrix defaults", "qr", nil, 150, 150},
+		{"height only", "code128", []string{"height=50"}, 300, 50},
+		{"mixed case height", "code128", []string{"Height=50"}, 300, 50},
+		{"mixed case width", "code128", []string{"WIDTH=120"}, 120, 80},
+		{"size sets both", "qr", []string{"Size=200"}, 200, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := ParseBarcodeOptions(tt.kind, tt.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.Width != tt.width || opts.Height != tt.height {
+				t.Errorf("got %dx%d, want %dx%d", opts.Width, opts.Height, tt.width, tt.height)
+			}
+		})
+	}
+}
+
+func TestParseBarcodeOptionsErrors(t *testing.T) {
+	for _, args := range [][]string{{"height"}, {"height=0"}, {"width=wide"}, {"colour=red"}} {
+		if _, err := ParseBarcodeOptions("code128", args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestParseBarcodeOptionsText(t *testing.T) {
+	opts, err := ParseBarcodeOptions("qr", []string{"EC=h", "Text=yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.ErrorCorrection != "H" || opts.Text != "yes" {
+		t.Errorf("unexpected options %+v", opts)
+	}
+}
+
+func TestBarcodeSVG(t *testing.T) {
+	svg, err := BarcodeSVG("code128", "ABC-123", BarcodeOptions{Width: 200, Height: 40, Text: "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(svg), "<svg") || !strings.Contains(string(svg), ">ABC-123</text>") {
+		t.Errorf("unexpected svg %.120s", svg)
+	}
+	if _, err := BarcodeSVG("ean13", "123", BarcodeOptions{Width: 200, Height: 40}); err == nil {
+		t.Error("expected an error for a short ean13 code")
+	}
+}
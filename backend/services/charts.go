@@ -0,0 +1,333 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var defaultChartColors = []string{
+	"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f",
+	"#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac",
+}
+
+// ChartOptions controls how a chart is drawn, it is filled from "key=value" template arguments
+type ChartOptions struct {
+	Title      string
+	Width      int
+	Height     int
+	Colors     []string
+	LabelKey   string
+	SeriesKeys []string
+	Legend     bool
+	// KeyOrder keeps the labels of object data in the order the request gave them
+	KeyOrder KeyOrder
+}
+
+type chartSeries struct {
+	Name   string
+	Values []float64
+}
+
+type chartData struct {
+	Labels []string
+	Series []chartSeries
+}
+
+// ParseChartOptions reads title, width, height, colors, label, series and legend options
+func ParseChartOptions(args []string) (ChartOptions, error) {
+	opts := ChartOptions{
+		Width:      600,
+		Height:     300,
+		Colors:     defaultChartColors,
+		LabelKey:   "label",
+		SeriesKeys: []string{"value"},
+		Legend:     true,
+	}
+
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return opts, fmt.Errorf("chart option %q must be in the form key=value", arg)
+		}
+
+		key = strings.ToLower(key)
+		switch key {
+		case "title":
+			opts.Title = value
+		case "width", "height":
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("chart option %s must be a positive number", key)
+			}
+			if key == "width" {
+				opts.Width = n
+			} else {
+				opts.Height = n
+			}
+		case "colors":
+			opts.Colors = splitList(value)
+		case "label":
+			opts.LabelKey = value
+		case "series":
+			opts.SeriesKeys = splitList(value)
+		case "legend":
+			opts.Legend = value != "false" && value != "no"
+		default:
+			return opts, fmt.Errorf("unknown chart option %q", key)
+		}
+	}
+
+	if len(opts.Colors) == 0 || len(opts.SeriesKeys) == 0 {
+		return opts, errors.New("chart colors and series cannot be empty")
+	}
+
+	return opts, nil
+}
+
+// ChartSVG renders a bar, line or pie chart from request data as an inline SVG element.
+// The data is either a list of objects holding the label and series keys, or a map of label to value.
+func ChartSVG(kind string, data interface{}, opts ChartOptions) (template.HTML, error) {
+	kind = strings.ToLower(kind)
+	chart, err := readChartData(data, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(chart.Labels) == 0 {
+		return "", errors.New("chart has no data points")
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="sans-serif" font-size="11">`,
+		opts.Width, opts.Height, opts.Width, opts.Height)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#fff"/>`, opts.Width, opts.Height)
+
+	top := 10.0
+	if opts.Title != "" {
+		fmt.Fprintf(&svg, `<text x="%d" y="18" font-size="14" font-weight="bold" text-anchor="middle">%s</text>`, opts.Width/2, html.EscapeString(opts.Title))
+		top = 30
+	}
+
+	right := float64(opts.Width) - 10
+	if opts.Legend {
+		right = float64(opts.Width) - 130
+		legendItems := chart.Labels
+		if kind != "pie" {
+			legendItems = nil
+			for _, series := range chart.Series {
+				legendItems = append(legendItems, series.Name)
+			}
+		}
+		writeLegend(&svg, legendItems, opts.Colors, right+15, top)
+	}
+
+	switch kind {
+	case "bar", "line":
+		err = writeAxisChart(&svg, kind, chart, opts, top, right)
+	case "pie":
+		err = writePieChart(&svg, chart, opts, top, right)
+	default:
+		err = fmt.Errorf("unsupported chart type %q, use bar, line or pie", kind)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String()), nil
+}
+
+func writeAxisChart(svg *strings.Builder, kind string, chart chartData, opts ChartOptions, top, right float64) error {
+	left, bottom := 50.0, float64(opts.Height)-30
+	plotWidth, plotHeight := right-left, bottom-top
+	if plotWidth <= 0 || plotHeight <= 0 {
+		return errors.New("chart is too small to draw")
+	}
+
+	minValue, maxValue := 0.0, 0.0
+	for _, series := range chart.Series {
+		for _, v := range series.Values {
+			minValue = math.Min(minValue, v)
+			maxValue = math.Max(maxValue, v)
+		}
+	}
+	if minValue == maxValue {
+		maxValue = 1
+	}
+
+	step := niceStep((maxValue - minValue) / 5)
+	axisMin := math.Floor(minValue/step) * step
+	axisMax := math.Ceil(maxValue/step) * step
+	scaleY := func(v float64) float64 {
+		return bottom - (v-axisMin)/(axisMax-axisMin)*plotHeight
+	}
+
+	// horizontal grid lines with value ticks
+	decimals := int(math.Max(0, -math.Floor(math.Log10(step))))
+	for v := axisMin; v <= axisMax+step/2; v += step {
+		y := scaleY(v)
+		fmt.Fprintf(svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#e5e7eb"/>`, left, y, right, y)
+		fmt.Fprintf(svg, `<text x="%.1f" y="%.1f" text-anchor="end" fill="#374151">%s</text>`, left-6, y+4, strconv.FormatFloat(v, 'f', decimals, 64))
+	}
+	fmt.Fprintf(svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#374151"/>`, left, top, left, bottom)
+	fmt.Fprintf(svg, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#374151"/>`, left, scaleY(0), right, scaleY(0))
+
+	slot := plotWidth / float64(len(chart.Labels))
+	for i, label := range chart.Labels {
+		x := left + slot*(float64(i)+0.5)
+		fmt.Fprintf(svg, `<text x="%.1f" y="%.1f" text-anchor="middle" fill="#374151">%s</text>`, x, bottom+16, html.EscapeString(label))
+	}
+
+	for s, series := range chart.Series {
+		color := html.EscapeString(opts.Colors[s%len(opts.Colors)])
+		if kind == "bar" {
+			barWidth := slot * 0.8 / float64(len(chart.Series))
+			for i, v := range series.Values {
+				x := left + slot*float64(i) + slot*0.1 + barWidth*float64(s)
+				y1, y2 := scaleY(math.Max(v, 0)), scaleY(math.Min(v, 0))
+				fmt.Fprintf(svg, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`, x, y1, barWidth, y2-y1, color)
+			}
+			continue
+		}
+
+		points := make([]string, len(series.Values))
+		for i, v := range series.Values {
+			points[i] = fmt.Sprintf("%.1f,%.1f", left+slot*(float64(i)+0.5), scaleY(v))
+		}
+		fmt.Fprintf(svg, `<polyline points="%s" fill="none" stroke="%s" stroke-width="2"/>`, strings.Join(points, " "), color)
+		for _, point := range points {
+			x, y, _ := strings.Cut(point, ",")
+			fmt.Fprintf(svg, `<circle cx="%s" cy="%s" r="3" fill="%s"/>`, x, y, color)
+		}
+	}
+
+	return nil
+}
+
+func writePieChart(svg *strings.Builder, chart chartData, opts ChartOptions, top, right float64) error {
+	values := chart.Series[0].Values
+	total := 0.0
+	for _, v := range values {
+		if v < 0 {
+			return errors.New("pie charts cannot show negative values")
+		}
+		total += v
+	}
+	if total == 0 {
+		return errors.New("pie chart values add up to zero")
+	}
+
+	cx, cy := (10+right)/2, (top+float64(opts.Height)-10)/2
+	radius := math.Min(right-10, float64(opts.Height)-10-top) / 2
+
+	angle := -math.Pi / 2
+	for i, v := range values {
+		color := html.EscapeString(opts.Colors[i%len(opts.Colors)])
+		if v == total {
+			fmt.Fprintf(svg, `<circle cx="%.1f" cy="%.1f" r="%.1f" fill="%s"/>`, cx, cy, radius, color)
+			break
+		}
+
+		sweep := v / total * 2 * math.Pi
+		largeArc := 0
+		if sweep > math.Pi {
+			largeArc = 1
+		}
+		x1, y1 := cx+radius*math.Cos(angle), cy+radius*math.Sin(angle)
+		x2, y2 := cx+radius*math.Cos(angle+sweep), cy+radius*math.Sin(angle+sweep)
+		fmt.Fprintf(svg, `<path d="M%.1f,%.1f L%.1f,%.1f A%.1f,%.1f 0 %d 1 %.1f,%.1f Z" fill="%s" stroke="#fff"/>`,
+			cx, cy, x1, y1, radius, radius, largeArc, x2, y2, color)
+		angle += sweep
+	}
+
+	return nil
+}
+
+func writeLegend(svg *strings.Builder, items []string, colors []string, x, top float64) {
+	for i, item := range items {
+		y := top + float64(i)*18
+		fmt.Fprintf(svg, `<rect x="%.1f" y="%.1f" width="12" height="12" fill="%s"/>`, x, y, html.EscapeString(colors[i%len(colors)]))
+		fmt.Fprintf(svg, `<text x="%.1f" y="%.1f" fill="#374151">%s</text>`, x+18, y+10, html.EscapeString(item))
+	}
+}
+
+func readChartData(data interface{}, opts ChartOptions) (chartData, error) {
+	var chart chartData
+
+	switch rows := data.(type) {
+	case []interface{}:
+		chart.Series = make([]chartSeries, len(opts.SeriesKeys))
+		for s, key := range opts.SeriesKeys {
+			chart.Series[s].Name = key
+		}
+		for i, row := range rows {
+			object, ok := row.(map[string]interface{})
+			if !ok {
+				return chart, fmt.Errorf("chart row %d is not an object", i)
+			}
+			chart.Labels = append(chart.Labels, fmt.Sprint(object[opts.LabelKey]))
+			for s, key := range opts.SeriesKeys {
+				v, err := toFloat(object[key])
+				if err != nil {
+					return chart, fmt.Errorf("chart row %d field %q: %v", i, key, err)
+				}
+				chart.Series[s].Values = append(chart.Series[s].Values, v)
+			}
+		}
+	case map[string]interface{}:
+		chart.Labels = opts.KeyOrder.Keys(rows)
+		series := chartSeries{Name: opts.SeriesKeys[0]}
+		for _, label := range chart.Labels {
+			v, err := toFloat(rows[label])
+			if err != nil {
+				return chart, fmt.Errorf("chart field %q: %v", label, err)
+			}
+			series.Values = append(series.Values, v)
+		}
+		chart.Series = []chartSeries{series}
+	default:
+		return chart, fmt.Errorf("chart data must be a list or an object, got %T", data)
+	}
+
+	return chart, nil
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("%v is not a number", value)
+	}
+}
+
+// niceStep rounds a raw axis step up to 1, 2 or 5 times a power of ten
+func niceStep(raw float64) float64 {
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, factor := range []float64{1, 2, 5, 10} {
+		if raw <= factor*magnitude {
+			return factor * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseChartOptions(t *testing.T) {
+	opts, err := ParseChartOptions([]string{"Height=120", "WIDTH=400", "Series=revenue, cost", "legend=no"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Width != 400 || opts.Height != 120 {
+		t.Errorf("got %dx%d, want 400x120", opts.Width, opts.Height)
+	}
+	if len(opts.SeriesKeys) != 2 || opts.SeriesKeys[1] != "cost" || opts.Legend {
+		t.Errorf("unexpected options %+v", opts)
+	}
+
+	for _, args := range [][]string{{"title"}, {"width=-1"}, {"series="}, {"kind=bar"}} {
+		if _, err := ParseChartOptions(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+}
+
+func TestChartLabelsKeepInputOrder(t *testing.T) {
+	data, keyOrder, err := DecodeOrderedJSON(`{"monthly": {"Mar": 3, "Jan": 1, "Feb": 2}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, _ := ParseChartOptions(nil)
+	opts.KeyOrder = keyOrder
+
+	for i := 0; i < 5; i++ {
+		chart, err := readChartData(data["monthly"], opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(chart.Labels, ","); got != "Mar,Jan,Feb" {
+			t.Fatalf("labels %s, want Mar,Jan,Feb", got)
+		}
+		if chart.Series[0].Values[0] != 3 {
+			t.Errorf("values %v do not follow the labels", chart.Series[0].Values)
+		}
+	}
+}
+
+func TestChartLabelsWithoutKeyOrderAreSorted(t *testing.T) {
+	chart, err := readChartData(map[string]interface{}{"b": 2.0, "a": 1.0}, ChartOptions{SeriesKeys: []string{"value"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(chart.Labels, ","); got != "a,b" {
+		t.Errorf("labels %s, want a,b", got)
+	}
+}
+
+func TestDecodeOrderedJSON(t *testing.T) {
+	data, keyOrder, err := DecodeOrderedJSON(`{"z": [{"y": 1, "x": null}], "a": "text"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(keyOrder.Keys(data), ","); got != "z,a" {
+		t.Errorf("keys %s, want z,a", got)
+	}
+	row := data["z"].([]interface{})[0].(map[string]interface{})
+	if got := strings.Join(keyOrder.Keys(row), ","); got != "y,x" || row["y"] != 1.0 {
+		t.Errorf("nested object %v keys %s", row, got)
+	}
+
+	for _, input := range []string{`[1, 2]`, `{"a": 1} {}`, `{"a": }`} {
+		if _, _, err := DecodeOrderedJSON(input); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+	if data, _, err := DecodeOrderedJSON(`null`); err != nil || data != nil {
+		t.Errorf("null decoded to %v, %v", data, err)
+	}
+}
+
+func TestChartSVG(t *testing.T) {
+	svg, err := ChartSVG("bar", []interface{}{
+		map[string]interface{}{"label": "Q1", "value": 10.0},
+		map[string]interface{}{"label": "Q2", "value": "12.5"},
+	}, ChartOptions{Width: 400, Height: 200, Colors: defaultChartColors, LabelKey: "label", SeriesKeys: []string{"value"}, Title: "Sales"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(svg), ">Sales</text>") || strings.Count(string(svg), "<rect") != 3 {
+		t.Errorf("unexpected svg %s", svg)
+	}
+	if _, err := ChartSVG("pie", map[string]interface{}{"a": -1.0}, ChartOptions{Width: 400, Height: 200, Colors: defaultChartColors, SeriesKeys: []string{"value"}}); err == nil {
+		t.Error("expected an error for a negative pie value")
+	}
+}
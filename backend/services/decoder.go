@@ -2,6 +2,11 @@ package services
 
 import (
 	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
 )
 
 
@@ -10,3 +15,84 @@ func DecodeJSON(jsonData string) (map[string]interface{}, error) {
 	err := json.Unmarshal([]byte(jsonData), &data)
 	return data, err
 }
+
+// KeyOrder remembers the order the keys of every object had in decoded JSON
+type KeyOrder map[uintptr][]string
+
+// Keys returns the keys of an object in input order, objects the order doesn't know are sorted
+func (order KeyOrder) Keys(object map[string]interface{}) []string {
+	if keys, ok := order[reflect.ValueOf(object).Pointer()]; ok && len(keys) == len(object) {
+		return keys
+	}
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// DecodeOrderedJSON decodes a JSON object like DecodeJSON and records the key order of every object in it
+func DecodeOrderedJSON(jsonData string) (map[string]interface{}, KeyOrder, error) {
+	decoder := json.NewDecoder(strings.NewReader(jsonData))
+	order := KeyOrder{}
+	value, err := decodeOrderedValue(decoder, order)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, nil, fmt.Errorf("unexpected data after the JSON object")
+	}
+
+	if value == nil {
+		return nil, order, nil
+	}
+	data, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("JSON data must be an object, got %T", value)
+	}
+	return data, order, nil
+}
+
+func decodeOrderedValue(decoder *json.Decoder, order KeyOrder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('['):
+		list := []interface{}{}
+		for decoder.More() {
+			value, err := decodeOrderedValue(decoder, order)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := decoder.Token()
+		return list, err
+	case json.Delim('{'):
+		object := map[string]interface{}{}
+		var keys []string
+		for decoder.More() {
+			token, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key := token.(string)
+			value, err := decodeOrderedValue(decoder, order)
+			if err != nil {
+				return nil, err
+			}
+			if _, seen := object[key]; !seen {
+				keys = append(keys, key)
+			}
+			object[key] = value
+		}
+		order[reflect.ValueOf(object).Pointer()] = keys
+		_, err := decoder.Token()
+		return object, err
+	}
+	return token, nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxDiffLines caps the changed lines returned in a diff report
+const maxDiffLines = 200
+
+// maxDiffCells bounds the LCS table; larger edits are reported as a full replacement of the edited block
+const maxDiffCells = 4 << 20
+
+// regionTile is the side in pixels of the tiles changed pixels are grouped into for region boxes
+const regionTile = 16
+
+// pixelTolerance ignores anti-aliasing noise when comparing two renders, out of 255 per channel
+const pixelTolerance = 16
+
+// DiffLine is an added or removed line of a text diff
+type DiffLine struct {
+	Op   string `json:"op"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// TextDiffReport is a line diff of two texts
+type TextDiffReport struct {
+	Changed   int        `json:"changed"`
+	Total     int        `json:"total"`
+	Ratio     float64    `json:"ratio"`
+	Lines     []DiffLine `json:"lines"`
+	Truncated bool       `json:"truncated,omitempty"`
+}
+
+// ImageDiffReport compares two renders pixel by pixel
+type ImageDiffReport struct {
+	Width         int     `json:"width"`
+	Height        int     `json:"height"`
+	ChangedPixels int     `json:"changedPixels"`
+	Ratio         float64 `json:"ratio"`
+	// Regions are the bounding boxes of the changed areas, in pixels of the render
+	Regions []Region `json:"regions,omitempty"`
+	// Highlight is a PNG of the new render with changed pixels marked red
+	Highlight []byte `json:"highlight,omitempty"`
+}
+
+// Region is a rectangle of an image in pixels from the top left
+type Region struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// TextDiff compares two texts line by line using their longest common subsequence
+func TextDiff(before, after string) TextDiffReport {
+	all, allAfter := splitLines(before), splitLines(after)
+	report := TextDiffReport{Total: max(len(all), len(allAfter)), Lines: []DiffLine{}}
+
+	// the unchanged head and tail are skipped so only the edited middle needs the quadratic table
+	prefix := 0
+	for prefix < len(all) && prefix < len(allAfter) && all[prefix] == allAfter[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(all)-prefix && suffix < len(allAfter)-prefix && all[len(all)-1-suffix] == allAfter[len(allAfter)-1-suffix] {
+		suffix++
+	}
+	a, b := all[prefix:len(all)-suffix], allAfter[prefix:len(allAfter)-suffix]
+
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	var lcs [][]int
+	if len(a)*len(b) <= maxDiffCells {
+		lcs = make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+	}
+
+	add := func(line DiffLine) {
+		report.Changed++
+		if len(report.Lines) < maxDiffLines {
+			report.Lines = append(report.Lines, line)
+		} else {
+			report.Truncated = true
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs != nil && lcs[i][j+1] >= lcs[i+1][j]):
+			add(DiffLine{Op: "+", Line: prefix + j + 1, Text: b[j]})
+			j++
+		default:
+			add(DiffLine{Op: "-", Line: prefix + i + 1, Text: a[i]})
+			i++
+		}
+	}
+
+	if report.Total > 0 {
+		report.Ratio = float64(report.Changed) / float64(len(all)+len(allAfter))
+	}
+	return report
+}
+
+// ImageDiff compares two PNG renders; pixels outside the smaller image count as changed
+func ImageDiff(before, after []byte) (ImageDiffReport, error) {
+	var report ImageDiffReport
+
+	a, err := png.Decode(bytes.NewReader(before))
+	if err != nil {
+		return report, err
+	}
+	b, err := png.Decode(bytes.NewReader(after))
+	if err != nil {
+		return report, err
+	}
+
+	report.Width = max(a.Bounds().Dx(), b.Bounds().Dx())
+	report.Height = max(a.Bounds().Dy(), b.Bounds().Dy())
+	highlight := image.NewRGBA(image.Rect(0, 0, report.Width, report.Height))
+	columns, rows := (report.Width+regionTile-1)/regionTile, (report.Height+regionTile-1)/regionTile
+	tiles := make([]bool, columns*rows)
+
+	for y := 0; y < report.Height; y++ {
+		for x := 0; x < report.Width; x++ {
+			pa, inA := pixelAt(a, x, y)
+			pb, inB := pixelAt(b, x, y)
+			if inA && inB && similarColor(pa, pb) {
+				// unchanged pixels are kept faded so the changes stand out
+				gray := color.GrayModel.Convert(pb).(color.Gray)
+				faded := 255 - (255-gray.Y)/4
+				highlight.Set(x, y, color.RGBA{faded, faded, faded, 255})
+				continue
+			}
+			report.ChangedPixels++
+			tiles[y/regionTile*columns+x/regionTile] = true
+			highlight.Set(x, y, color.RGBA{220, 0, 0, 255})
+		}
+	}
+
+	if total := report.Width * report.Height; total > 0 {
+		report.Ratio = float64(report.ChangedPixels) / float64(total)
+	}
+	if report.ChangedPixels > 0 {
+		report.Regions = changedRegions(tiles, columns, rows, report.Width, report.Height)
+
+		var encoded bytes.Buffer
+		if err := png.Encode(&encoded, highlight); err != nil {
+			return report, err
+		}
+		report.Highlight = encoded.Bytes()
+	}
+	return report, nil
+}
+
+// HTMLText extracts the visible text of an HTML document, one line per text block
+func HTMLText(document []byte) string {
+	tokenizer := html.NewTokenizer(bytes.NewReader(document))
+	var lines []string
+	skip := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return strings.Join(lines, "\n")
+		case html.StartTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "script" || string(name) == "style" {
+				skip++
+			}
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); (string(name) == "script" || string(name) == "style") && skip > 0 {
+				skip--
+			}
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			if text := strings.Join(strings.Fields(string(tokenizer.Text())), " "); text != "" {
+				lines = append(lines, text)
+			}
+		}
+	}
+}
+
+// changedRegions joins neighbouring changed tiles into boxes, clipped to the image
+func changedRegions(tiles []bool, columns, rows, width, height int) []Region {
+	var regions []Region
+	seen := make([]bool, len(tiles))
+	for start := range tiles {
+		if !tiles[start] || seen[start] {
+			continue
+		}
+
+		minX, minY, maxX, maxY := columns, rows, 0, 0
+		stack := []int{start}
+		seen[start] = true
+		for len(stack) > 0 {
+			tile := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y := tile%columns, tile/columns
+			minX, minY, maxX, maxY = min(minX, x), min(minY, y), max(maxX, x), max(maxY, y)
+
+			for _, next := range [][2]int{{x - 1, y}, {x + 1, y}, {x, y - 1}, {x, y + 1}} {
+				if next[0] < 0 || next[0] >= columns || next[1] < 0 || next[1] >= rows {
+					continue
+				}
+				if n := next[1]*columns + next[0]; tiles[n] && !seen[n] {
+					seen[n] = true
+					stack = append(stack, n)
+				}
+			}
+		}
+
+		regions = append(regions, Region{
+			X:      minX * regionTile,
+			Y:      minY * regionTile,
+			Width:  min((maxX+1)*regionTile, width) - minX*regionTile,
+			Height: min((maxY+1)*regionTile, height) - minY*regionTile,
+		})
+	}
+	return regions
+}
+
+func splitLines(text string) []string {
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+func pixelAt(img image.Image, x, y int) (color.Color, bool) {
+	bounds := img.Bounds()
+	if x >= bounds.Dx() || y >= bounds.Dy() {
+		return nil, false
+	}
+	return img.At(bounds.Min.X+x, bounds.Min.Y+y), true
+}
+
+func similarColor(a, b color.Color) bool {
+	r1, g1, b1, a1 := a.RGBA()
+	r2, g2, b2, a2 := b.RGBA()
+	for _, d := range []int{int(r1>>8) - int(r2>>8), int(g1>>8) - int(g2>>8), int(b1>>8) - int(b2>>8), int(a1>>8) - int(a2>>8)} {
+		if d > pixelTolerance || d < -pixelTolerance {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,563 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// DocxContentType is the media type of filled Word documents
+const DocxContentType = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+
+// docxConvertTimeout bounds a single DOCX to PDF conversion
+const docxConvertTimeout = 2 * time.Minute
+
+// ErrNoDocxConverter is returned when a PDF is requested from a DOCX template but DOCX_CONVERTER is not set
+var ErrNoDocxConverter = errors.New("DOCX to PDF conversion is not configured, set DOCX_CONVERTER")
+
+// docxParts are the parts of a Word document that can hold merge fields
+var docxParts = regexp.MustCompile(`^word/(document|header\d*|footer\d*|footnotes|endnotes)\.xml$`)
+
+var (
+	docxText        = regexp.MustCompile(`(?s)<w:t(\s[^>]*)?>(.*?)</w:t>`)
+	docxAction      = regexp.MustCompile(`(?s)\{\{.*?\}\}`)
+	docxControl     = regexp.MustCompile(`^\{\{-?\s*(if|else|range|with|end|break|continue)\b`)
+	docxAssignment  = regexp.MustCompile(`^\$\w*\s*:?=`)
+	docxFieldName   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+	docxSimpleField = regexp.MustCompile(`(?s)<w:fldSimple\s[^>]*?w:instr="([^"]*)"[^>]*>(.*?)</w:fldSimple>`)
+	docxInstrText   = regexp.MustCompile(`(?s)<w:instrText(?:\s[^>]*)?>(.*?)</w:instrText>`)
+	docxRunProps    = regexp.MustCompile(`(?s)<w:rPr>.*?</w:rPr>`)
+	docxEmptyCell   = regexp.MustCompile(`(?s)(<w:tc>|</w:tcPr>)(\s*)</w:tc>`)
+	smartQuotes     = strings.NewReplacer("“", `"`, "”", `"`, "‘", "'", "’", "'")
+)
+
+// FillDocx merges data into a Word template and returns the filled document.
+// Placeholders use the same syntax as HTML templates ({{.customer.name}}, {{if}}, {{range}}, {{end}})
+// and Word MERGEFIELD fields are accepted too, with TableStart:name/TableEnd:name marking repeated rows.
+// A paragraph holding only {{if}}/{{range}}/{{end}} actions is removed, so the paragraphs between them are
+// conditional or repeated, and actions at the start and end of a table row repeat or hide the whole row.
+func FillDocx(templateBytes []byte, data map[string]interface{}, opts RenderOptions) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(templateBytes), int64(len(templateBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DOCX file: %v", err)
+	}
+
+	var filled bytes.Buffer
+	writer := zip.NewWriter(&filled)
+	for _, file := range archive.File {
+		content, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if docxParts.MatchString(file.Name) {
+			tmpl, err := parseDocxPart(file.Name, content, opts)
+			if err != nil {
+				return nil, err
+			}
+			var part bytes.Buffer
+			if err := tmpl.Execute(&part, data); err != nil {
+				return nil, fmt.Errorf("%s: %v", file.Name, err)
+			}
+			content = docxEmptyCell.ReplaceAll(part.Bytes(), []byte("$1$2<w:p/></w:tc>"))
+		}
+
+		entry, err := writer.CreateHeader(&zip.FileHeader{Name: file.Name, Method: file.Method, Modified: file.Modified})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := entry.Write(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return filled.Bytes(), nil
+}
+
+// ValidateDocx checks an uploaded Word template opens and that its placeholders parse
+func ValidateDocx(templateBytes []byte) error {
+	archive, err := zip.NewReader(bytes.NewReader(templateBytes), int64(len(templateBytes)))
+	if err != nil {
+		return fmt.Errorf("invalid DOCX file: %v", err)
+	}
+
+	found := false
+	for _, file := range archive.File {
+		if !docxParts.MatchString(file.Name) {
+			continue
+		}
+		found = found || file.Name == "word/document.xml"
+
+		content, err := readZipFile(file)
+		if err != nil {
+			return err
+		}
+		if _, err := parseDocxPart(file.Name, content, RenderOptions{}); err != nil {
+			return err
+		}
+	}
+
+	if !found {
+		return errors.New("invalid DOCX file: word/document.xml is missing")
+	}
+	return nil
+}
+
+// ConvertDocxToPDF converts a filled DOCX with the LibreOffice compatible converter configured in DOCX_CONVERTER
+func ConvertDocxToPDF(docx []byte) ([]byte, error) {
+	converter := os.Getenv("DOCX_CONVERTER")
+	if converter == "" {
+		return nil, ErrNoDocxConverter
+	}
+
+	workDir, err := os.MkdirTemp("", "autodocs-docx-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	input := filepath.Join(workDir, "document.docx")
+	if err := os.WriteFile(input, docx, 0o600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), docxConvertTimeout)
+	defer cancel()
+
+	// a private profile lets conversions run in parallel without waiting on the profile lock
+	cmd := exec.CommandContext(ctx, converter,
+		"-env:UserInstallation=file://"+filepath.ToSlash(filepath.Join(workDir, "profile")),
+		"--headless", "--convert-to", "pdf", "--outdir", workDir, input)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("DOCX conversion failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return os.ReadFile(filepath.Join(workDir, "document.pdf"))
+}
+
+// parseDocxPart turns the XML of a document part into a template that writes XML-escaped values
+func parseDocxPart(name string, content []byte, opts RenderOptions) (*texttemplate.Template, error) {
+	if err := checkDocxXML(content); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	part, err := mapElements(string(content), "p", func(paragraph string) string {
+		return mergeTextRuns(convertMergeFields(paragraph))
+	})
+	if err == nil {
+		part, err = mapElements(part, "tr", liftRowActions)
+	}
+	if err == nil {
+		part, err = mapElements(part, "p", controlParagraph)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	part = docxAction.ReplaceAllStringFunc(part, escapeDocxAction)
+
+	funcs := texttemplate.FuncMap(TemplateFuncs(opts))
+	funcs["xml"] = docxValue
+	tmpl, err := texttemplate.New(name).Funcs(funcs).Parse(part)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// checkDocxXML makes sure a document part is well-formed XML before its elements are rewritten
+func checkDocxXML(content []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("malformed XML: %v", err)
+		}
+	}
+}
+
+// mapElements replaces every outermost <w:name> element of an XML part with fn(element)
+func mapElements(part, name string, fn func(string) string) (string, error) {
+	open, closing := "<w:"+name, "</w:"+name+">"
+	var out strings.Builder
+	for {
+		start := indexTag(part, open)
+		if start < 0 {
+			out.WriteString(part)
+			return out.String(), nil
+		}
+		out.WriteString(part[:start])
+
+		end, err := elementEnd(part, start, open, closing)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(fn(part[start:end]))
+		part = part[end:]
+	}
+}
+
+// indexTag finds the next opening tag, so "<w:p" does not match "<w:pPr"
+func indexTag(part, open string) int {
+	offset := 0
+	for {
+		i := strings.Index(part[offset:], open)
+		if i < 0 {
+			return -1
+		}
+		i += offset
+		if next := i + len(open); next < len(part) && strings.IndexByte(" >/", part[next]) >= 0 {
+			return i
+		}
+		offset = i + len(open)
+	}
+}
+
+// elementEnd returns the offset just after the element starting at start, counting nested elements of the same name.
+// An opening tag without '>' or an element that is never closed is malformed XML.
+func elementEnd(part string, start int, open, closing string) (int, error) {
+	tagEnd := strings.IndexByte(part[start:], '>')
+	if tagEnd < 0 {
+		return 0, fmt.Errorf("malformed XML: %s> at offset %d has no end", open, start)
+	}
+	tagEnd += start
+	if part[tagEnd-1] == '/' {
+		return tagEnd + 1, nil
+	}
+
+	depth := 1
+	offset := tagEnd + 1
+	for depth > 0 {
+		nextOpen := indexTag(part[offset:], open)
+		nextClose := strings.Index(part[offset:], closing)
+		if nextClose < 0 {
+			return 0, fmt.Errorf("malformed XML: %s> at offset %d is not closed", open, start)
+		}
+		if nextOpen >= 0 && nextOpen < nextClose {
+			openEnd := strings.IndexByte(part[offset+nextOpen:], '>')
+			if openEnd < 0 {
+				return 0, fmt.Errorf("malformed XML: %s> at offset %d has no end", open, offset+nextOpen)
+			}
+			openEnd += offset + nextOpen
+			if part[openEnd-1] != '/' {
+				depth++
+			}
+			offset = openEnd + 1
+			continue
+		}
+		depth--
+		offset += nextClose + len(closing)
+	}
+	return offset, nil
+}
+
+// convertMergeFields replaces Word MERGEFIELD fields in a paragraph by the equivalent placeholder
+func convertMergeFields(paragraph string) string {
+	paragraph = docxSimpleField.ReplaceAllStringFunc(paragraph, func(field string) string {
+		match := docxSimpleField.FindStringSubmatch(field)
+		action, ok := mergeFieldAction(html.UnescapeString(match[1]))
+		if !ok {
+			return field
+		}
+		return docxRun(docxRunProps.FindString(match[2]), action)
+	})
+
+	if !strings.Contains(paragraph, "w:fldCharType") {
+		return paragraph
+	}
+
+	// complex fields span runs: begin, instruction text, separate, displayed result, end
+	var runs [][2]int
+	offset := 0
+	for {
+		start := indexTag(paragraph[offset:], "<w:r")
+		if start < 0 {
+			break
+		}
+		start += offset
+		end, err := elementEnd(paragraph, start, "<w:r", "</w:r>")
+		if err != nil {
+			// parts are checked to be well-formed first, so this paragraph was not split from one
+			return paragraph
+		}
+		runs = append(runs, [2]int{start, end})
+		offset = end
+	}
+
+	var out strings.Builder
+	last := 0
+	for i := 0; i < len(runs); i++ {
+		if !strings.Contains(paragraph[runs[i][0]:runs[i][1]], `w:fldCharType="begin"`) {
+			continue
+		}
+
+		var instruction, props string
+		inResult, nested := false, false
+		end := -1
+		for j := i; j < len(runs); j++ {
+			run := paragraph[runs[j][0]:runs[j][1]]
+			if j > i && strings.Contains(run, `w:fldCharType="begin"`) {
+				nested = true
+			}
+			for _, text := range docxInstrText.FindAllStringSubmatch(run, -1) {
+				instruction += text[1]
+			}
+			if inResult && props == "" {
+				props = docxRunProps.FindString(run)
+			}
+			if strings.Contains(run, `w:fldCharType="separate"`) {
+				inResult = true
+			}
+			if strings.Contains(run, `w:fldCharType="end"`) {
+				end = j
+				break
+			}
+		}
+		if end < 0 || nested {
+			continue
+		}
+
+		action, ok := mergeFieldAction(html.UnescapeString(instruction))
+		if !ok {
+			i = end
+			continue
+		}
+		if props == "" {
+			props = docxRunProps.FindString(paragraph[runs[i][0]:runs[i][1]])
+		}
+
+		out.WriteString(paragraph[last:runs[i][0]])
+		out.WriteString(docxRun(props, action))
+		last = runs[end][1]
+		i = end
+	}
+	out.WriteString(paragraph[last:])
+	return out.String()
+}
+
+// mergeFieldAction maps a MERGEFIELD instruction to a placeholder
+func mergeFieldAction(instruction string) (string, bool) {
+	fields := strings.Fields(instruction)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "MERGEFIELD") {
+		return "", false
+	}
+
+	name := strings.TrimSpace(strings.TrimSpace(instruction)[len(fields[0]):])
+	if strings.HasPrefix(name, `"`) {
+		if end := strings.Index(name[1:], `"`); end >= 0 {
+			name = name[1 : end+1]
+		}
+	} else {
+		name = strings.Fields(name)[0]
+	}
+
+	switch {
+	case strings.HasPrefix(name, "TableStart:"), strings.HasPrefix(name, "BeginGroup:"):
+		region := name[strings.Index(name, ":")+1:]
+		return "{{range " + fieldReference(region) + "}}", true
+	case strings.HasPrefix(name, "TableEnd:"), strings.HasPrefix(name, "EndGroup:"):
+		return "{{end}}", true
+	default:
+		return "{{" + fieldReference(name) + "}}", true
+	}
+}
+
+func fieldReference(name string) string {
+	if docxFieldName.MatchString(name) {
+		return "." + name
+	}
+	return fmt.Sprintf("index . %q", name)
+}
+
+func docxRun(props, text string) string {
+	return `<w:r>` + props + `<w:t xml:space="preserve">` + text + `</w:t></w:r>`
+}
+
+// mergeTextRuns moves placeholders that Word split over several runs into the run where they start
+func mergeTextRuns(paragraph string) string {
+	matches := docxText.FindAllStringSubmatchIndex(paragraph, -1)
+	if len(matches) == 0 {
+		return paragraph
+	}
+
+	texts := make([]string, len(matches))
+	starts := make([]int, len(matches))
+	var combined strings.Builder
+	for i, m := range matches {
+		texts[i] = paragraph[m[4]:m[5]]
+		starts[i] = combined.Len()
+		combined.WriteString(texts[i])
+	}
+	if !strings.Contains(combined.String(), "{{") {
+		return paragraph
+	}
+
+	node := func(offset int) int {
+		i := len(starts) - 1
+		for i > 0 && starts[i] > offset {
+			i--
+		}
+		return i
+	}
+
+	actions := docxAction.FindAllStringIndex(combined.String(), -1)
+	for k := len(actions) - 1; k >= 0; k-- {
+		first, last := node(actions[k][0]), node(actions[k][1]-1)
+		if first == last {
+			continue
+		}
+		cut := actions[k][1] - starts[last]
+		for i := first + 1; i < last; i++ {
+			texts[first] += texts[i]
+			texts[i] = ""
+		}
+		texts[first] += texts[last][:cut]
+		texts[last] = texts[last][cut:]
+	}
+
+	var out strings.Builder
+	previous := 0
+	for i, m := range matches {
+		out.WriteString(paragraph[previous:m[0]])
+		out.WriteString(`<w:t xml:space="preserve">` + texts[i] + `</w:t>`)
+		previous = m[1]
+	}
+	out.WriteString(paragraph[previous:])
+	return out.String()
+}
+
+// liftRowActions moves control actions at the start and end of a table row outside the row,
+// so {{range .items}} in the first cell and {{end}} in the last repeat the row for every item
+func liftRowActions(row string) string {
+	matches := docxText.FindAllStringSubmatchIndex(row, -1)
+	texts := make([]string, len(matches))
+	for i, m := range matches {
+		texts[i] = row[m[4]:m[5]]
+	}
+
+	var before []string
+	for i := range texts {
+		for {
+			trimmed := strings.TrimLeft(texts[i], " \t")
+			action := docxAction.FindStringIndex(trimmed)
+			if action == nil || action[0] != 0 || !docxControl.MatchString(trimmed) {
+				break
+			}
+			before = append(before, trimmed[:action[1]])
+			texts[i] = trimmed[action[1]:]
+		}
+		if strings.TrimSpace(texts[i]) != "" {
+			break
+		}
+	}
+
+	var after []string
+	for i := len(texts) - 1; i >= 0; i-- {
+		for {
+			trimmed := strings.TrimRight(texts[i], " \t")
+			actions := docxAction.FindAllStringIndex(trimmed, -1)
+			if len(actions) == 0 {
+				break
+			}
+			action := actions[len(actions)-1]
+			if action[1] != len(trimmed) || !docxControl.MatchString(trimmed[action[0]:]) {
+				break
+			}
+			after = append([]string{trimmed[action[0]:]}, after...)
+			texts[i] = trimmed[:action[0]]
+		}
+		if strings.TrimSpace(texts[i]) != "" {
+			break
+		}
+	}
+
+	if len(before) == 0 && len(after) == 0 {
+		return row
+	}
+
+	var out strings.Builder
+	out.WriteString(strings.Join(before, ""))
+	previous := 0
+	for i, m := range matches {
+		out.WriteString(row[previous:m[4]])
+		out.WriteString(texts[i])
+		previous = m[5]
+	}
+	out.WriteString(row[previous:])
+	out.WriteString(strings.Join(after, ""))
+	return out.String()
+}
+
+// controlParagraph replaces a paragraph that only holds control actions by the actions themselves
+func controlParagraph(paragraph string) string {
+	var text strings.Builder
+	for _, m := range docxText.FindAllStringSubmatch(paragraph, -1) {
+		text.WriteString(m[2])
+	}
+
+	trimmed := strings.TrimSpace(text.String())
+	actions := docxAction.FindAllString(trimmed, -1)
+	if len(actions) == 0 || strings.TrimSpace(docxAction.ReplaceAllString(trimmed, "")) != "" {
+		return paragraph
+	}
+	for _, action := range actions {
+		if !docxControl.MatchString(action) {
+			return paragraph
+		}
+	}
+	return strings.Join(actions, "")
+}
+
+// escapeDocxAction undoes Word's XML escaping and smart quotes inside an action
+// and pipes output actions through xml so values cannot break the document
+func escapeDocxAction(action string) string {
+	action = smartQuotes.Replace(html.UnescapeString(action))
+
+	inner := strings.TrimSuffix(strings.TrimPrefix(action, "{{"), "}}")
+	leftTrim, rightTrim := strings.HasPrefix(inner, "- "), strings.HasSuffix(inner, " -")
+	inner = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(inner, "- "), " -"))
+
+	if docxControl.MatchString("{{"+inner) || docxAssignment.MatchString(inner) || strings.HasPrefix(inner, "/*") ||
+		strings.HasPrefix(inner, "template ") || strings.HasPrefix(inner, "define ") || strings.HasPrefix(inner, "block ") {
+		return action
+	}
+
+	escaped := "{{"
+	if leftTrim {
+		escaped += "- "
+	}
+	escaped += inner + " | xml"
+	if rightTrim {
+		escaped += " -"
+	}
+	return escaped + "}}"
+}
+
+// docxValue writes a value as run text, turning newlines into line breaks
+func docxValue(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+
+	var escaped bytes.Buffer
+	xml.EscapeText(&escaped, []byte(fmt.Sprint(value)))
+	text := strings.ReplaceAll(escaped.String(), "&#xD;&#xA;", "&#xA;")
+	return strings.ReplaceAll(text, "&#xA;", `</w:t><w:br/><w:t xml:space="preserve">`)
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const docxNamespace = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"`
+
+// testDocx packs a document body into a minimal Word file
+func testDocx(t *testing.T, body string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	entry, err := writer.Create("word/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><w:document ` + docxNamespace + `><w:body>` + body + `</w:body></w:document>`))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func fillDocxText(t *testing.T, body string, data map[string]interface{}) string {
+	t.Helper()
+	filled, err := FillDocx(testDocx(t, body), data, RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text, err := DocxText(filled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return text
+}
+
+func TestFillDocxPlaceholders(t *testing.T) {
+	// Word splits "{{.customer.name}}" over runs when part of it is formatted differently
+	body := `<w:p><w:r><w:t>Dear {{.cust</w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>omer.name}},</w:t></w:r></w:p>`
+	got := fillDocxText(t, body, map[string]interface{}{"customer": map[string]interface{}{"name": "Smith & <Sons>"}})
+	if got != "Dear Smith &amp; &lt;Sons&gt;," {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestFillDocxMergeFields(t *testing.T) {
+	simple := `<w:p><w:fldSimple w:instr=" MERGEFIELD invoice_no \* MERGEFORMAT "><w:r><w:t>«invoice_no»</w:t></w:r></w:fldSimple></w:p>`
+	complexField := `<w:p><w:r><w:t xml:space="preserve">Total: </w:t></w:r>` +
+		`<w:r><w:fldChar w:fldCharType="begin"/></w:r>` +
+		`<w:r><w:instrText xml:space="preserve"> MERGEFIELD "Grand Total" </w:instrText></w:r>` +
+		`<w:r><w:fldChar w:fldCharType="separate"/></w:r>` +
+		`<w:r><w:rPr><w:b/></w:rPr><w:t>«Grand Total»</w:t></w:r>` +
+		`<w:r><w:fldChar w:fldCharType="end"/></w:r></w:p>`
+
+	got := fillDocxText(t, simple+complexField, map[string]interface{}{"invoice_no": "INV-7", "Grand Total": 42.5})
+	if got != "INV-7\nTotal: 42.5" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestFillDocxRepeatsTableRows(t *testing.T) {
+	cell := func(text string) string {
+		return `<w:tc><w:p><w:r><w:t>` + text + `</w:t></w:r></w:p></w:tc>`
+	}
+	body := `<w:tbl><w:tr>` + cell("Item") + cell("Qty") + `</w:tr>` +
+		`<w:tr>` + cell("{{range .items}}{{.name}}") + cell("{{.qty}}{{end}}") + `</w:tr></w:tbl>` +
+		`<w:p><w:r><w:t>{{if .paid}}</w:t></w:r></w:p><w:p><w:r><w:t>Paid</w:t></w:r></w:p><w:p><w:r><w:t>{{end}}</w:t></w:r></w:p>`
+
+	got := fillDocxText(t, body, map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"name": "Pens", "qty": 3},
+			map[string]interface{}{"name": "Ink", "qty": 1},
+		},
+		"paid": false,
+	})
+	if got != "Item\nQty\nPens\n3\nInk\n1" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestValidateDocxRejectsMalformedXML(t *testing.T) {
+	for name, body := range map[string]string{
+		"tag without end":  `<w:p><w:r><w:t>text</w:t></w:r`,
+		"unclosed element": `<w:p><w:r><w:t>text</w:t></w:r>`,
+		"broken attribute": `<w:p w:rsidR="00A1><w:r><w:t>text</w:t></w:r></w:p>`,
+	} {
+		err := ValidateDocx(testDocx(t, body))
+		if err == nil || !strings.Contains(err.Error(), "malformed XML") {
+			t.Errorf("%s: got %v, want a malformed XML error", name, err)
+		}
+	}
+	if err := ValidateDocx(testDocx(t, `<w:p><w:r><w:t>{{.name}}</w:t></w:r></w:p>`)); err != nil {
+		t.Errorf("valid document rejected: %v", err)
+	}
+}
+
+func TestElementEndMalformed(t *testing.T) {
+	for _, part := range []string{`<w:p `, `<w:p><w:r>text`, `<w:p><w:p`, `x<w:p attr="1"`} {
+		start := indexTag(part, "<w:p")
+		if _, err := elementEnd(part, start, "<w:p", "</w:p>"); err == nil {
+			t.Errorf("%q: expected an error", part)
+		}
+		if _, err := mapElements(part, "p", func(element string) string { return element }); err == nil {
+			t.Errorf("%q: mapElements expected an error", part)
+		}
+	}
+
+	end, err := elementEnd(`<w:p><w:p/><w:p>x</w:p></w:p>tail`, 0, "<w:p", "</w:p>")
+	if err != nil || end != len(`<w:p><w:p/><w:p>x</w:p></w:p>`) {
+		t.Errorf("got %d, %v for nested paragraphs", end, err)
+	}
+}
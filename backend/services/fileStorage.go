@@ -2,59 +2,36 @@ package services
 
 import (
 	"context"
-	"errors"
 	"io"
 	"time"
 
 	"example/pdfgenerator/initializers"
-
-	"github.com/minio/minio-go/v7"
+	"example/pdfgenerator/repository"
 )
 
-// UploadFile uploads a file to MinIO.
-func UploadFile(bucketName, objectName string, file io.Reader) error {
-	// Check if MinioClient is initialized
-	if initializers.MinioClient == nil {
-		return errors.New("MinioClient is not initialized")
-	}
-
-	// Validate bucketName and objectName
-	if bucketName == "" || objectName == "" {
-		return errors.New("bucketName and objectName cannot be empty")
-	}
+// Objects is the object storage templates and documents are kept in; it is the MinIO client unless a test replaces it
+var Objects repository.ObjectStore
 
-	// Upload the file to MinIO
-	_, err := initializers.MinioClient.PutObject(context.Background(), bucketName, objectName, file, -1, minio.PutObjectOptions{
-		ContentType: "application/pdf",
-	})
-	if err != nil {
-		return err
+func objectStore() repository.ObjectStore {
+	if Objects != nil {
+		return Objects
 	}
+	return repository.NewObjectStore(initializers.MinioClient)
+}
 
-	return nil
+// UploadFile uploads a file to MinIO.
+func UploadFile(bucketName, objectName string, file io.Reader) error {
+	return objectStore().Put(bucketName, objectName, file, "application/pdf")
 }
 
 // UploadFile uploads a file to MinIO.
 func UploadTemplate(bucketName2, objectName2 string, file io.Reader) error {
-	// Check if MinioClient is initialized
-	if initializers.MinioClient == nil {
-		return errors.New("MinioClient is not initialized")
-	}
-
-	// Validate bucketName and objectName
-	if bucketName2 == "" || objectName2 == "" {
-		return errors.New("bucketName and objectName cannot be empty")
-	}
-
-	// Upload the file to MinIO
-	_, err := initializers.MinioClient.PutObject(context.Background(), bucketName2, objectName2, file, -1, minio.PutObjectOptions{
-		ContentType: "text/html",
-	})
-	if err != nil {
-		return err
-	}
+	return objectStore().Put(bucketName2, objectName2, file, "text/html")
+}
 
-	return nil
+// UploadAsset uploads a template bundle asset to MinIO with its own content type.
+func UploadAsset(bucketName, objectName string, file io.Reader, contentType string) error {
+	return objectStore().Put(bucketName, objectName, file, contentType)
 }
 
 // GenerateFileURL generates a presigned URL for accessing a file.
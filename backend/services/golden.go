@@ -0,0 +1,264 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Outcomes of comparing a revision's sample renders with the goldens; unchecked when no sample has a golden
+const (
+	CheckUnchecked = "unchecked"
+	CheckPassed    = "passed"
+	CheckFailed    = "failed"
+)
+
+// ErrRevisionBlocked is returned when publishing a revision whose renders differ from the goldens
+var ErrRevisionBlocked = errors.New("revision differs from the golden renders beyond the threshold")
+
+// SampleComparison is the diff of one sample's render against its golden
+type SampleComparison struct {
+	Sample string           `json:"sample"`
+	Passed bool             `json:"passed"`
+	Error  string           `json:"error,omitempty"`
+	Text   TextDiffReport   `json:"text"`
+	Image  *ImageDiffReport `json:"image,omitempty"`
+}
+
+// GoldenReport compares every sample of a template rendered with a revision against the goldens
+type GoldenReport struct {
+	Revision       int                `json:"revision"`
+	Passed         bool               `json:"passed"`
+	TextThreshold  float64            `json:"textThreshold"`
+	PixelThreshold float64            `json:"pixelThreshold"`
+	PixelDiff      bool               `json:"pixelDiff"`
+	Samples        []SampleComparison `json:"samples"`
+}
+
+// SaveSample creates or replaces a named sample payload of a template, data must be a JSON object and keeps its key order
+func SaveSample(db *gorm.DB, templateId, name string, data json.RawMessage, locale string) (models.TemplateSample, error) {
+	object, _, err := DecodeOrderedJSON(string(data))
+	if err != nil {
+		return models.TemplateSample{}, err
+	}
+	if object == nil {
+		return models.TemplateSample{}, errors.New("sample data is required")
+	}
+	var encoded bytes.Buffer
+	if err := json.Compact(&encoded, data); err != nil {
+		return models.TemplateSample{}, err
+	}
+
+	var sample models.TemplateSample
+	err = db.Where("template_id = ? AND name = ?", templateId, name).First(&sample).Error
+	if err != nil {
+		sample = models.TemplateSample{
+			ID:         uuid.New().String(),
+			TemplateId: templateId,
+			Name:       name,
+			CreatedAt:  time.Now(),
+		}
+	}
+	sample.Data = encoded.String()
+	sample.Locale = locale
+	sample.UpdatedAt = time.Now()
+
+	return sample, db.Save(&sample).Error
+}
+
+// TemplateSamples lists the sample payloads of a template by name
+func TemplateSamples(db *gorm.DB, templateId string) ([]models.TemplateSample, error) {
+	var samples []models.TemplateSample
+	err := db.Where("template_id = ?", templateId).Order("name").Find(&samples).Error
+	return samples, err
+}
+
+// DeleteSample removes a sample and its golden image
+func DeleteSample(db *gorm.DB, sample models.TemplateSample) error {
+	if sample.GoldenImage != "" {
+		if err := DeleteFile("templates", sample.GoldenImage); err != nil {
+			return err
+		}
+	}
+	return db.Delete(&sample).Error
+}
+
+// RenderSample renders one sample payload with template content and its render options
+func RenderSample(template models.Template, templateBytes []byte, opts RenderOptions, sample models.TemplateSample) (Snapshot, error) {
+	data, keyOrder, err := DecodeOrderedJSON(sample.Data)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("sample %s has invalid data: %v", sample.Name, err)
+	}
+	opts.KeyOrder = keyOrder
+	if opts.Locales, err = LocaleChain(sample.Locale, nil, template.DefaultLocale); err != nil {
+		return Snapshot{}, err
+	}
+	return RenderSnapshot(templateBytes, data, opts)
+}
+
+// RecordGoldens renders the samples with the template's current revision and stores the results as their goldens
+func RecordGoldens(db *gorm.DB, template models.Template, samples []models.TemplateSample) ([]models.TemplateSample, error) {
+	current, err := CurrentRevision(db, template)
+	if err != nil {
+		return nil, err
+	}
+	templateBytes, opts, err := LoadTemplate(db, template)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range samples {
+		snapshot, err := RenderSample(template, templateBytes, opts, samples[i])
+		if err != nil {
+			return nil, fmt.Errorf("sample %s: %v", samples[i].Name, err)
+		}
+
+		samples[i].GoldenImage = ""
+		if snapshot.Image != nil {
+			samples[i].GoldenImage = "golden/" + samples[i].ID + ".png"
+			if err := UploadAsset("templates", samples[i].GoldenImage, bytes.NewReader(snapshot.Image), "image/png"); err != nil {
+				return nil, err
+			}
+		}
+		samples[i].GoldenText = snapshot.Text
+		samples[i].GoldenRevision = current.Revision
+		samples[i].GoldenUpdatedAt = time.Now()
+		if err := db.Save(&samples[i]).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return samples, nil
+}
+
+// CompareSamples renders every sample that has a golden with the given content and diffs the results
+func CompareSamples(db *gorm.DB, template models.Template, templateBytes []byte, opts RenderOptions) (GoldenReport, error) {
+	report := GoldenReport{
+		Passed:         true,
+		TextThreshold:  goldenThreshold("GOLDEN_TEXT_THRESHOLD", 0),
+		PixelThreshold: goldenThreshold("GOLDEN_PIXEL_THRESHOLD", 0.001),
+		PixelDiff:      SnapshotImagesEnabled(),
+		Samples:        []SampleComparison{},
+	}
+
+	samples, err := TemplateSamples(db, template.ID)
+	if err != nil {
+		return report, err
+	}
+
+	for _, sample := range samples {
+		if sample.GoldenUpdatedAt.IsZero() {
+			continue
+		}
+		comparison := SampleComparison{Sample: sample.Name, Passed: true}
+
+		snapshot, err := RenderSample(template, templateBytes, opts, sample)
+		if err != nil {
+			comparison.Passed = false
+			comparison.Error = err.Error()
+		} else {
+			comparison.Text = TextDiff(sample.GoldenText, snapshot.Text)
+			comparison.Passed = comparison.Text.Ratio <= report.TextThreshold
+
+			if sample.GoldenImage != "" && snapshot.Image != nil {
+				golden, err := DownloadFile("templates", sample.GoldenImage)
+				if err != nil {
+					return report, fmt.Errorf("error fetching golden of %s: %v", sample.Name, err)
+				}
+				image, err := ImageDiff(golden, snapshot.Image)
+				if err != nil {
+					return report, fmt.Errorf("error comparing %s: %v", sample.Name, err)
+				}
+				comparison.Image = &image
+				comparison.Passed = comparison.Passed && image.Ratio <= report.PixelThreshold
+			}
+		}
+
+		report.Passed = report.Passed && comparison.Passed
+		report.Samples = append(report.Samples, comparison)
+	}
+
+	return report, nil
+}
+
+// CheckRevision renders the samples with a revision's content and saves the outcome on the revision
+func CheckRevision(db *gorm.DB, template models.Template, revision *models.TemplateRevision) (GoldenReport, error) {
+	report, err := checkRevision(db, template, revision)
+	if err != nil {
+		return report, err
+	}
+	// only the check is saved, a concurrent workflow step may have changed the status
+	return report, db.Model(revision).Select("check", "report").Updates(revision).Error
+}
+
+// checkRevision renders the samples with a revision's content and sets the outcome on the revision without saving it
+func checkRevision(db *gorm.DB, template models.Template, revision *models.TemplateRevision) (GoldenReport, error) {
+	templateBytes, opts, err := LoadRevision(db, template, *revision)
+	if err != nil {
+		return GoldenReport{}, err
+	}
+
+	report, err := CompareSamples(db, template, templateBytes, opts)
+	if err != nil {
+		return report, err
+	}
+	switch {
+	case len(report.Samples) == 0:
+		revision.Check = CheckUnchecked
+	case report.Passed:
+		revision.Check = CheckPassed
+	default:
+		revision.Check = CheckFailed
+	}
+	return report, setRevisionReport(revision, &report)
+}
+
+// setRevisionReport numbers a report after its revision and keeps it on the revision
+func setRevisionReport(revision *models.TemplateRevision, report *GoldenReport) error {
+	report.Revision = revision.Revision
+
+	// highlight images are returned to the caller but too large to keep on the revision
+	stored := *report
+	stored.Samples = make([]SampleComparison, len(report.Samples))
+	for i, comparison := range report.Samples {
+		if comparison.Image != nil {
+			image := *comparison.Image
+			image.Highlight = nil
+			comparison.Image = &image
+		}
+		stored.Samples[i] = comparison
+	}
+	encoded, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	revision.Report = string(encoded)
+	return nil
+}
+
+// deleteRevisionsAndSamples removes the revision, transition and sample rows of a purged template
+func deleteRevisionsAndSamples(tx *gorm.DB, templateId string) error {
+	if err := tx.Where("template_id = ?", templateId).Delete(&models.TemplateSample{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("template_id = ?", templateId).Delete(&models.WorkflowTransition{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("template_id = ?", templateId).Delete(&models.TemplateRevision{}).Error
+}
+
+func goldenThreshold(name string, fallback float64) float64 {
+	if value, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && value >= 0 {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rightToLeftLanguages are rendered with dir="rtl"
+var rightToLeftLanguages = map[string]bool{"ar": true, "fa": true, "he": true, "ur": true}
+
+// dateNames holds month and weekday names plus date patterns for the languages we issue documents in
+type dateNames struct {
+	months   [12]string
+	weekdays [7]string
+	patterns map[string]string
+}
+
+var localeDateNames = map[string]dateNames{
+	"en": {
+		months:   [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		weekdays: [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		patterns: map[string]string{"short": "{dd}/{MM}/{yyyy}", "medium": "{d} {MMM} {yyyy}", "long": "{d} {MMMM} {yyyy}", "full": "{EEEE}, {d} {MMMM} {yyyy}"},
+	},
+	"en-US": {
+		months:   [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		weekdays: [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		patterns: map[string]string{"short": "{MM}/{dd}/{yyyy}", "medium": "{MMM} {d}, {yyyy}", "long": "{MMMM} {d}, {yyyy}", "full": "{EEEE}, {MMMM} {d}, {yyyy}"},
+	},
+	"fr": {
+		months:   [12]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet", "août", "septembre", "octobre", "novembre", "décembre"},
+		weekdays: [7]string{"dimanche", "lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi"},
+		patterns: map[string]string{"short": "{dd}/{MM}/{yyyy}", "medium": "{d} {MMM} {yyyy}", "long": "{d} {MMMM} {yyyy}", "full": "{EEEE} {d} {MMMM} {yyyy}"},
+	},
+	"sw": {
+		months:   [12]string{"Januari", "Februari", "Machi", "Aprili", "Mei", "Juni", "Julai", "Agosti", "Septemba", "Oktoba", "Novemba", "Desemba"},
+		weekdays: [7]string{"Jumapili", "Jumatatu", "Jumanne", "Jumatano", "Alhamisi", "Ijumaa", "Jumamosi"},
+		patterns: map[string]string{"short": "{dd}/{MM}/{yyyy}", "medium": "{d} {MMM} {yyyy}", "long": "{d} {MMMM} {yyyy}", "full": "{EEEE}, {d} {MMMM} {yyyy}"},
+	},
+	"ar": {
+		months:   [12]string{"يناير", "فبراير", "مارس", "أبريل", "مايو", "يونيو", "يوليو", "أغسطس", "سبتمبر", "أكتوبر", "نوفمبر", "ديسمبر"},
+		weekdays: [7]string{"الأحد", "الاثنين", "الثلاثاء", "الأربعاء", "الخميس", "الجمعة", "السبت"},
+		patterns: map[string]string{"short": "{dd}/{MM}/{yyyy}", "medium": "{d} {MMMM} {yyyy}", "long": "{d} {MMMM} {yyyy}", "full": "{EEEE}، {d} {MMMM} {yyyy}"},
+	},
+}
+
+var datePatternToken = regexp.MustCompile(`\{(EEEE|MMMM|MMM|MM|dd|d|yyyy)\}`)
+
+// NormalizeLocale validates a locale tag and returns its canonical form, e.g. "fr-ca" becomes "fr-CA"
+func NormalizeLocale(locale string) (string, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return "", fmt.Errorf("invalid locale %q", locale)
+	}
+	return tag.String(), nil
+}
+
+// DefaultLocale is the last locale of every fallback chain
+func DefaultLocale() string {
+	if locale := os.Getenv("DEFAULT_LOCALE"); locale != "" {
+		return locale
+	}
+	return "en"
+}
+
+// LocaleChain builds the ordered list of locales to try for a request:
+// the requested locale, its base language, the explicit fallbacks, the template default and the service default
+func LocaleChain(locale string, fallbacks []string, templateDefault string) ([]string, error) {
+	var chain []string
+	seen := map[string]bool{}
+	add := func(candidate string) error {
+		if candidate == "" {
+			return nil
+		}
+		normalized, err := NormalizeLocale(candidate)
+		if err != nil {
+			return err
+		}
+		for _, l := range []string{normalized, baseLanguage(normalized)} {
+			if !seen[l] {
+				seen[l] = true
+				chain = append(chain, l)
+			}
+		}
+		return nil
+	}
+
+	for _, candidate := range append(append([]string{locale}, fallbacks...), templateDefault, DefaultLocale()) {
+		if err := add(candidate); err != nil {
+			return nil, err
+		}
+	}
+
+	return chain, nil
+}
+
+// SaveTranslations creates or replaces the catalog of one locale for a template
+func SaveTranslations(db *gorm.DB, templateId, locale string, entries map[string]string) (models.TranslationCatalog, error) {
+	encoded, err := json.Marshal(entries)
+	if err != nil {
+		return models.TranslationCatalog{}, err
+	}
+
+	// (template_id, locale) is unique, so a concurrent save of the same locale updates the catalog instead of adding one
+	catalog := models.TranslationCatalog{
+		ID:         uuid.New().String(),
+		TemplateId: templateId,
+		Locale:     locale,
+		Entries:    string(encoded),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "template_id"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"entries", "updated_at"}),
+	}).Create(&catalog).Error
+	if err != nil {
+		return catalog, err
+	}
+
+	var saved models.TranslationCatalog
+	err = db.Where("template_id = ? AND locale = ?", templateId, locale).First(&saved).Error
+	return saved, err
+}
+
+// TemplateTranslations loads all catalogs of a template keyed by locale
+func TemplateTranslations(db *gorm.DB, templateId string) (map[string]map[string]string, error) {
+	var catalogs []models.TranslationCatalog
+	if err := db.Where("template_id = ?", templateId).Find(&catalogs).Error; err != nil {
+		return nil, err
+	}
+
+	translations := make(map[string]map[string]string, len(catalogs))
+	for _, catalog := range catalogs {
+		entries := map[string]string{}
+		if err := json.Unmarshal([]byte(catalog.Entries), &entries); err != nil {
+			return nil, fmt.Errorf("catalog %s is corrupt: %v", catalog.Locale, err)
+		}
+		translations[catalog.Locale] = entries
+	}
+
+	return translations, nil
+}
+
+// Translate looks a key up along the locale chain, filling {name} placeholders from name/value pairs.
+// A missing key renders as the key itself so gaps in a catalog are visible in the output.
+func Translate(opts RenderOptions, key string, args ...interface{}) string {
+	text := key
+	for _, locale := range opts.Locales {
+		if value, ok := opts.Translations[locale][key]; ok {
+			text = value
+			break
+		}
+	}
+
+	for i := 0; i+1 < len(args); i += 2 {
+		text = strings.ReplaceAll(text, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+	return text
+}
+
+// RenderLocale is the locale a document is rendered in, the head of the chain
+func RenderLocale(opts RenderOptions) string {
+	if len(opts.Locales) > 0 {
+		return opts.Locales[0]
+	}
+	return DefaultLocale()
+}
+
+// TextDirection returns "rtl" for right-to-left languages such as Arabic and "ltr" otherwise
+func TextDirection(locale string) string {
+	if rightToLeftLanguages[baseLanguage(locale)] {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// FormatDate formats a date from the payload in the given style (short, medium, long, full) for a locale
+func FormatDate(locale string, value interface{}, style string) (string, error) {
+	date, err := parseDate(value)
+	if err != nil {
+		return "", err
+	}
+
+	names, ok := localeDateNames[locale]
+	if !ok {
+		if names, ok = localeDateNames[baseLanguage(locale)]; !ok {
+			names = localeDateNames["en"]
+		}
+	}
+
+	pattern, ok := names.patterns[style]
+	if !ok {
+		return "", fmt.Errorf("unknown date style %q, use short, medium, long or full", style)
+	}
+
+	return datePatternToken.ReplaceAllStringFunc(pattern, func(token string) string {
+		switch token {
+		case "{EEEE}":
+			return names.weekdays[date.Weekday()]
+		case "{MMMM}":
+			return names.months[date.Month()-1]
+		case "{MMM}":
+			month := []rune(names.months[date.Month()-1])
+			if len(month) > 3 {
+				month = month[:3]
+			}
+			return string(month)
+		case "{MM}":
+			return fmt.Sprintf("%02d", int(date.Month()))
+		case "{dd}":
+			return fmt.Sprintf("%02d", date.Day())
+		case "{d}":
+			return strconv.Itoa(date.Day())
+		default:
+			return strconv.Itoa(date.Year())
+		}
+	}), nil
+}
+
+// FormatNumber formats a number with the locale's grouping and decimal separators
+func FormatNumber(locale string, value interface{}, decimals int) (string, error) {
+	n, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	printer := message.NewPrinter(language.Make(locale))
+	return printer.Sprint(number.Decimal(n, number.MinFractionDigits(decimals), number.MaxFractionDigits(decimals))), nil
+}
+
+// FormatCurrency formats an amount in an ISO 4217 currency for the locale, e.g. KES 1,250.00
+func FormatCurrency(locale string, value interface{}, code string) (string, error) {
+	n, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return "", fmt.Errorf("unknown currency %q", code)
+	}
+	printer := message.NewPrinter(language.Make(locale))
+	return printer.Sprint(currency.Symbol(unit.Amount(n))), nil
+}
+
+func parseDate(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+			if date, err := time.Parse(layout, v); err == nil {
+				return date, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot read %q as a date, use YYYY-MM-DD or RFC 3339", v)
+	default:
+		return time.Time{}, fmt.Errorf("cannot read %v as a date", value)
+	}
+}
+
+func baseLanguage(locale string) string {
+	base, _, _ := strings.Cut(locale, "-")
+	return base
+}
+
+var htmlOpenTag = regexp.MustCompile(`(?i)<html\b[^>]*>`)
+var dirAttribute = regexp.MustCompile(`(?i)\sdir\s*=`)
+
+// ApplyTextDirection marks the <html> element dir="rtl" for right-to-left locales unless the template sets dir itself
+func ApplyTextDirection(document []byte, opts RenderOptions) []byte {
+	if TextDirection(RenderLocale(opts)) != "rtl" {
+		return document
+	}
+
+	location := htmlOpenTag.FindIndex(document)
+	if location == nil || dirAttribute.Match(document[location[0]:location[1]]) {
+		return document
+	}
+
+	insertAt := location[0] + len("<html")
+	directed := make([]byte, 0, len(document)+len(` dir="rtl"`))
+	directed = append(directed, document[:insertAt]...)
+	directed = append(directed, ` dir="rtl"`...)
+	return append(directed, document[insertAt:]...)
+}
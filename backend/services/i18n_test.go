@@ -0,0 +1,84 @@
+package services
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"example/pdfgenerator/models"
+)
+
+func TestFormatDateShortMonthKeepsWholeCharacters(t *testing.T) {
+	tests := []struct {
+		locale, date, want string
+	}{
+		{"fr", "2024-02-03", "3 fév 2024"},
+		{"fr-CA", "2024-08-15", "15 aoû 2024"},
+		{"en-US", "2024-12-01", "Dec 1, 2024"},
+		{"sw", "2024-05-09", "9 Mei 2024"},
+	}
+	for _, tt := range tests {
+		got, err := FormatDate(tt.locale, tt.date, "medium")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want || !utf8.ValidString(got) {
+			t.Errorf("%s %s: got %q, want %q", tt.locale, tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestLocaleChain(t *testing.T) {
+	t.Setenv("DEFAULT_LOCALE", "en")
+	chain, err := LocaleChain("fr-CA", []string{"sw"}, "ar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"fr-CA", "fr", "sw", "ar", "en"}
+	if len(chain) != len(want) {
+		t.Fatalf("got %v, want %v", chain, want)
+	}
+	for i := range want {
+		if chain[i] != want[i] {
+			t.Fatalf("got %v, want %v", chain, want)
+		}
+	}
+}
+
+func TestSaveTranslationsKeepsOneCatalogPerLocale(t *testing.T) {
+	db := useTestDB(t)
+
+	first, err := SaveTranslations(db, "T-1", "fr", map[string]string{"greeting": "Salut"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := SaveTranslations(db, "T-1", "fr", map[string]string{"greeting": "Bonjour {name}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID {
+		t.Errorf("saving again created catalog %s, want %s updated", second.ID, first.ID)
+	}
+
+	var count int64
+	db.Model(&models.TranslationCatalog{}).Where("template_id = ?", "T-1").Count(&count)
+	if count != 1 {
+		t.Errorf("got %d catalogs, want 1", count)
+	}
+
+	translations, err := TemplateTranslations(db, "T-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := RenderOptions{Locales: []string{"fr", "en"}, Translations: translations}
+	if got := Translate(opts, "greeting", "name", "Amina"); got != "Bonjour Amina" {
+		t.Errorf("got %q", got)
+	}
+	if got := Translate(opts, "missing"); got != "missing" {
+		t.Errorf("a missing key rendered as %q", got)
+	}
+
+	duplicate := models.TranslationCatalog{ID: "other", TemplateId: "T-1", Locale: "fr"}
+	if err := db.Create(&duplicate).Error; err == nil {
+		t.Error("stored a second catalog for the same locale")
+	}
+}
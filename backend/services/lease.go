@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// storageLease keeps the sweeper, manual runs and reconciliation, in every instance, from changing storage at the same time
+const storageLease = "storage"
+
+// leaseTTL is how long a lease outlives a holder that stopped renewing it
+const leaseTTL = 5 * time.Minute
+
+// ErrLeaseHeld is returned when another run holds the lease a run needs
+var ErrLeaseHeld = errors.New("another run is in progress")
+
+// acquireLease takes the named lease and renews it in the background until the returned release is called
+func acquireLease(db *gorm.DB, name string) (release func(), err error) {
+	holder := uuid.New().String()
+	now := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("name = ? AND expires_at < ?", name, now).Delete(&models.Lease{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Lease{Name: name, Holder: holder, ExpiresAt: now.Add(leaseTTL)}).Error
+	})
+	if err != nil {
+		// the insert fails on the primary key when another holder has the lease
+		var held int64
+		if countErr := db.Model(&models.Lease{}).Where("name = ?", name).Count(&held).Error; countErr == nil && held > 0 {
+			return nil, fmt.Errorf("%w: the %s lease is taken", ErrLeaseHeld, name)
+		}
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(leaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := db.Model(&models.Lease{}).Where("name = ? AND holder = ?", name, holder).Update("expires_at", time.Now().Add(leaseTTL)).Error; err != nil {
+					log.Printf("Error renewing the %s lease: %v", name, err)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		if err := db.Where("name = ? AND holder = ?", name, holder).Delete(&models.Lease{}).Error; err != nil {
+			log.Printf("Error releasing the %s lease, it expires on its own: %v", name, err)
+		}
+	}, nil
+}
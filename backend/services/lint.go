@@ -0,0 +1,237 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Lint severities, errors block an upload and warnings need force=true
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// defaultMaxImageKB is the largest embedded image accepted without a warning
+const defaultMaxImageKB = 500
+
+// LintIssue is one finding of the upload linter
+type LintIssue struct {
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+// LintReport lists everything the linter found in an uploaded template
+type LintReport struct {
+	Renderer string      `json:"renderer"`
+	Errors   int         `json:"errors"`
+	Warnings int         `json:"warnings"`
+	Issues   []LintIssue `json:"issues"`
+}
+
+// unsupportedCSS lists CSS the renderers cannot lay out, keyed by renderer.
+// wkhtmltopdf uses an old QtWebKit, so modern layout features are silently ignored.
+var unsupportedCSS = map[string][]struct {
+	pattern *regexp.Regexp
+	message string
+}{
+	"wkhtmltopdf": {
+		{regexp.MustCompile(`(?i)display\s*:\s*(inline-)?flex\b`), "display: flex is not supported by wkhtmltopdf, use display: -webkit-box or tables"},
+		{regexp.MustCompile(`(?i)display\s*:\s*(inline-)?grid\b|grid-template`), "CSS grid is not supported by wkhtmltopdf, use tables"},
+		{regexp.MustCompile(`(?i)var\(\s*--`), "CSS custom properties (var(--x)) are not supported by wkhtmltopdf"},
+		{regexp.MustCompile(`(?i)position\s*:\s*sticky`), "position: sticky is not supported by wkhtmltopdf"},
+		{regexp.MustCompile(`(?i)(^|[;{\s])(row-|column-)?gap\s*:`), "gap is not supported by wkhtmltopdf, use margins"},
+		{regexp.MustCompile(`(?i)\b(clamp|min|max)\(`), "clamp(), min() and max() are not supported by wkhtmltopdf"},
+		{regexp.MustCompile(`(?i)object-fit\s*:`), "object-fit is not supported by wkhtmltopdf"},
+		{regexp.MustCompile(`(?i)@supports\b`), "@supports is not supported by wkhtmltopdf"},
+	},
+}
+
+var (
+	templateErrorLine = regexp.MustCompile(`^template: [^:]*:(\d+):(?:(\d+):)?\s*(.*)$`)
+	quotedToken       = regexp.MustCompile(`"([^"]+)"`)
+	remoteResource    = regexp.MustCompile(`(?i)(?:\bsrc\s*=\s*["']?|<link\b[^>]*\bhref\s*=\s*["']?|url\(\s*["']?|@import\s+["'])((?:https?:)?//[^"')\s>]+)`)
+	imageTag          = regexp.MustCompile(`(?is)<img\b[^>]*>`)
+	altAttribute      = regexp.MustCompile(`(?i)\salt\s*=`)
+	markdownImage     = regexp.MustCompile(`!\[\s*\]\(`)
+	scriptTag         = regexp.MustCompile(`(?i)<script\b|\bjavascript:|\son(load|click|error|mouseover)\s*=`)
+	dataImage         = regexp.MustCompile(`data:image/[a-z0-9.+-]+;base64,([A-Za-z0-9+/=\s]+)`)
+	styleBlock        = regexp.MustCompile(`(?is)<style\b[^>]*>(.*?)</style>|\sstyle\s*=\s*"([^"]*)"`)
+)
+
+// TemplateRenderer is the engine that turns a template of the given format into a PDF
+func TemplateRenderer(format string) string {
+	switch format {
+	case FormatDocx:
+		return "docx"
+	case FormatPDFForm:
+		return "pdfform"
+	case FormatText:
+		return "text"
+	default:
+		return "wkhtmltopdf"
+	}
+}
+
+// LintTemplate checks an uploaded template before it is stored.
+// Syntax errors are reported with their line and column; risky content is reported as warnings.
+func LintTemplate(format string, content []byte, assets []BundleFile) LintReport {
+	report := LintReport{Renderer: TemplateRenderer(format), Issues: []LintIssue{}}
+
+	switch format {
+	case FormatDocx:
+		if err := ValidateDocx(content); err != nil {
+			report.add(LintIssue{Severity: LintError, Rule: "syntax", Message: err.Error()})
+		}
+		return report
+	case FormatPDFForm:
+		if _, err := FormFields(content); err != nil {
+			report.add(LintIssue{Severity: LintError, Rule: "syntax", Message: err.Error()})
+		}
+		return report
+	case FormatMarkdown:
+		if _, _, err := ParseFrontMatter(content); err != nil {
+			report.add(LintIssue{Severity: LintError, Rule: "front-matter", Message: err.Error(), Line: 1, Column: 1})
+		}
+	}
+
+	// parsed with the template functions so a misspelt function is caught here and not at generation time
+	source := string(content)
+	if _, err := texttemplate.New("upload").Funcs(texttemplate.FuncMap(TemplateFuncs(RenderOptions{}))).Parse(source); err != nil {
+		report.add(syntaxIssue(source, err))
+	}
+	if format == FormatText {
+		return report
+	}
+
+	report.lintMarkup("", source, format)
+	for _, asset := range assets {
+		switch {
+		case strings.HasPrefix(asset.ContentType, "text/css"):
+			report.lintCSS(asset.Path, string(asset.Data), 0)
+			report.lintRemote(asset.Path, string(asset.Data))
+		case strings.HasPrefix(asset.ContentType, "image/") && len(asset.Data) > maxImageBytes():
+			report.add(LintIssue{Severity: LintWarning, Rule: "image-size", File: asset.Path,
+				Message: fmt.Sprintf("image is %d KB, larger than %d KB", len(asset.Data)>>10, maxImageBytes()>>10)})
+		}
+	}
+
+	return report
+}
+
+func (r *LintReport) add(issue LintIssue) {
+	if issue.Severity == LintError {
+		r.Errors++
+	} else {
+		r.Warnings++
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+func (r *LintReport) lintMarkup(file, source, format string) {
+	r.lintRemote(file, source)
+
+	for _, tag := range imageTag.FindAllStringIndex(source, -1) {
+		if !altAttribute.MatchString(source[tag[0]:tag[1]]) {
+			r.addAt(LintWarning, "missing-alt", "image has no alt text", file, source, tag[0])
+		}
+	}
+	if format == FormatMarkdown {
+		for _, image := range markdownImage.FindAllStringIndex(source, -1) {
+			r.addAt(LintWarning, "missing-alt", "image has no alt text", file, source, image[0])
+		}
+	}
+
+	for _, script := range scriptTag.FindAllStringIndex(source, -1) {
+		r.addAt(LintWarning, "script", "scripts run while the PDF is rendered, keep documents static", file, source, script[0])
+	}
+
+	for _, image := range dataImage.FindAllStringSubmatchIndex(source, -1) {
+		size := (image[3] - image[2]) * 3 / 4
+		if size > maxImageBytes() {
+			r.addAt(LintWarning, "image-size", fmt.Sprintf("embedded image is %d KB, larger than %d KB", size>>10, maxImageBytes()>>10), file, source, image[0])
+		}
+	}
+
+	for _, style := range styleBlock.FindAllStringSubmatchIndex(source, -1) {
+		start, end := style[2], style[3]
+		if start < 0 {
+			start, end = style[4], style[5]
+		}
+		r.lintCSS(file, source[:end], start)
+	}
+}
+
+// lintCSS reports CSS the renderer ignores, in source[offset:], with positions relative to the whole source
+func (r *LintReport) lintCSS(file, source string, offset int) {
+	for _, rule := range unsupportedCSS[r.Renderer] {
+		for _, match := range rule.pattern.FindAllStringIndex(source[offset:], -1) {
+			r.addAt(LintWarning, "unsupported-css", rule.message, file, source, offset+match[0])
+		}
+	}
+}
+
+func (r *LintReport) lintRemote(file, source string) {
+	for _, match := range remoteResource.FindAllStringSubmatchIndex(source, -1) {
+		url := source[match[2]:match[3]]
+		r.addAt(LintWarning, "remote-resource", "remote resource "+url+" is fetched on every render, bundle it with the template instead", file, source, match[2])
+	}
+}
+
+func (r *LintReport) addAt(severity, rule, message, file, source string, offset int) {
+	line, column := position(source, offset)
+	r.add(LintIssue{Severity: severity, Rule: rule, Message: message, File: file, Line: line, Column: column})
+}
+
+// syntaxIssue turns a template parse error into an issue, locating the offending token on the reported line
+func syntaxIssue(source string, err error) LintIssue {
+	issue := LintIssue{Severity: LintError, Rule: "syntax", Message: err.Error()}
+
+	match := templateErrorLine.FindStringSubmatch(err.Error())
+	if match == nil {
+		return issue
+	}
+	issue.Message = match[3]
+	issue.Line, _ = strconv.Atoi(match[1])
+	if match[2] != "" {
+		issue.Column, _ = strconv.Atoi(match[2])
+		return issue
+	}
+
+	lines := strings.Split(source, "\n")
+	if issue.Line < 1 || issue.Line > len(lines) {
+		return issue
+	}
+	line := lines[issue.Line-1]
+	issue.Column = strings.Index(line, "{{") + 1
+	if token := quotedToken.FindStringSubmatch(match[3]); token != nil {
+		if i := strings.Index(line, token[1]); i >= 0 {
+			issue.Column = i + 1
+		}
+	}
+	if issue.Column == 0 {
+		issue.Column = 1
+	}
+	return issue
+}
+
+// position converts a byte offset into a 1-based line and column
+func position(source string, offset int) (int, int) {
+	line := strings.Count(source[:offset], "\n") + 1
+	column := offset - strings.LastIndex(source[:offset], "\n")
+	return line, column
+}
+
+func maxImageBytes() int {
+	if kb, err := strconv.Atoi(os.Getenv("LINT_MAX_IMAGE_KB")); err == nil && kb > 0 {
+		return kb << 10
+	}
+	return defaultMaxImageKB << 10
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+	"gopkg.in/yaml.v3"
+)
+
+// Template formats accepted by UploadTemplate
+const (
+	FormatHTML     = "html"
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+	FormatDocx     = "docx"
+)
+
+//go:embed themes/*.css
+var themeFiles embed.FS
+
+var markdownConverter = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	// raw HTML stays so charts, barcodes and hand-written markup survive the conversion
+	goldmark.WithRendererOptions(goldmarkhtml.WithUnsafe()),
+)
+
+var markdownDocument = template.Must(template.New("markdown").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}" dir="{{.Dir}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>{{.Stylesheet}}</style>
+</head>
+<body>
+{{.Body}}
+</body>
+</html>`))
+
+// PageOptions are the wkhtmltopdf page settings a Markdown template can set in its front matter
+type PageOptions struct {
+	Size         string `yaml:"pageSize"`
+	Orientation  string `yaml:"orientation"`
+	Margin       *uint  `yaml:"margin"`
+	MarginTop    *uint  `yaml:"marginTop"`
+	MarginBottom *uint  `yaml:"marginBottom"`
+	MarginLeft   *uint  `yaml:"marginLeft"`
+	MarginRight  *uint  `yaml:"marginRight"`
+}
+
+// FrontMatter is the YAML block between --- lines at the top of a Markdown template
+type FrontMatter struct {
+	Title       string `yaml:"title"`
+	Theme       string `yaml:"theme"`
+	PageOptions `yaml:",inline"`
+}
+
+// DetectTemplateFormat picks the template format from the explicit form value or the uploaded file name
+func DetectTemplateFormat(format, fileName string) (string, error) {
+	switch strings.ToLower(format) {
+	case FormatHTML, FormatMarkdown, FormatText, FormatDocx, FormatPDFForm:
+		return strings.ToLower(format), nil
+	case "md":
+		return FormatMarkdown, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown template format %q, use html, markdown, text, docx or pdfform", format)
+	}
+
+	switch strings.ToLower(path.Ext(fileName)) {
+	case ".md", ".markdown":
+		return FormatMarkdown, nil
+	case ".txt", ".tmpl":
+		return FormatText, nil
+	case ".docx":
+		return FormatDocx, nil
+	case ".pdf":
+		return FormatPDFForm, nil
+	default:
+		return FormatHTML, nil
+	}
+}
+
+// Themes lists the stylesheets a Markdown template can select
+func Themes() []string {
+	entries, _ := themeFiles.ReadDir("themes")
+	themes := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		themes = append(themes, strings.TrimSuffix(entry.Name(), ".css"))
+	}
+	sort.Strings(themes)
+	return themes
+}
+
+// ParseFrontMatter splits a Markdown template into its front matter and body
+func ParseFrontMatter(content []byte) (FrontMatter, []byte, error) {
+	var frontMatter FrontMatter
+
+	normalized := bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	normalized = bytes.ReplaceAll(normalized, []byte("\r\n"), []byte("\n"))
+	if !bytes.HasPrefix(normalized, []byte("---\n")) {
+		return frontMatter, content, frontMatter.validate()
+	}
+
+	rest := normalized[len("---\n"):]
+	end := bytes.Index(rest, []byte("\n---"))
+	if end < 0 {
+		return frontMatter, content, fmt.Errorf("front matter is not closed with ---")
+	}
+
+	if err := yaml.Unmarshal(rest[:end], &frontMatter); err != nil {
+		return frontMatter, content, fmt.Errorf("invalid front matter: %v", err)
+	}
+
+	body := rest[end+len("\n---"):]
+	if newline := bytes.IndexByte(body, '\n'); newline >= 0 {
+		body = body[newline+1:]
+	} else {
+		body = nil
+	}
+
+	return frontMatter, body, frontMatter.validate()
+}
+
+func (f FrontMatter) validate() error {
+	if f.Theme != "" {
+		if _, err := themeFiles.ReadFile("themes/" + f.Theme + ".css"); err != nil {
+			return fmt.Errorf("unknown theme %q, available themes are %s", f.Theme, strings.Join(Themes(), ", "))
+		}
+	}
+
+	switch strings.ToLower(f.Size) {
+	case "", "a3", "a4", "a5", "letter", "legal":
+	default:
+		return fmt.Errorf("unsupported pageSize %q, use A3, A4, A5, Letter or Legal", f.Size)
+	}
+
+	switch strings.ToLower(f.Orientation) {
+	case "", "portrait", "landscape":
+	default:
+		return fmt.Errorf("unsupported orientation %q, use portrait or landscape", f.Orientation)
+	}
+
+	return nil
+}
+
+// MarkdownToHTML converts filled Markdown into a complete HTML document styled with the selected theme
+func MarkdownToHTML(markdown []byte, frontMatter FrontMatter, opts RenderOptions) ([]byte, error) {
+	var body bytes.Buffer
+	if err := markdownConverter.Convert(markdown, &body); err != nil {
+		return nil, err
+	}
+
+	theme := frontMatter.Theme
+	if theme == "" {
+		theme = "default"
+	}
+	stylesheet, err := themeFiles.ReadFile("themes/" + theme + ".css")
+	if err != nil {
+		return nil, fmt.Errorf("unknown theme %q", theme)
+	}
+
+	locale := RenderLocale(opts)
+	var document bytes.Buffer
+	err = markdownDocument.Execute(&document, map[string]interface{}{
+		"Lang":       locale,
+		"Dir":        TextDirection(locale),
+		"Title":      frontMatter.Title,
+		"Stylesheet": template.CSS(stylesheet),
+		"Body":       template.HTML(body.String()),
+	})
+	return document.Bytes(), err
+}
@@ -1,46 +1,36 @@
 package services
 
 import (
-	"bytes"
-	"context"
-	"example/pdfgenerator/initializers"
 	"fmt"
-	"io"
-
-	"github.com/minio/minio-go/v7"
+	"time"
 )
 
 // DownloadFile downloads an object from MinIO and returns the data as a byte slice
 func DownloadFile(bucketName, objectName string) ([]byte, error) {
-	minioClient := initializers.MinioClient
-
-	// Download the object from MinIO
-	object, err := minioClient.GetObject(context.Background(), bucketName, objectName, minio.GetObjectOptions{})
-	if err != nil {
-		return nil, err
-	}
-	defer object.Close()
-
-	// Read the object data into a byte buffer
-	var buffer bytes.Buffer
-	_, err = io.Copy(&buffer, object)
-	if err != nil {
-		return nil, err
-	}
-
-	return buffer.Bytes(), nil
+	return objectStore().Get(bucketName, objectName)
 }
 
 // DeleteFile deletes an object from MinIO
 func DeleteFile(bucketName, objectName string) error {
-	minioClient := initializers.MinioClient
-
-	// Remove the object from MinIO
-	err := minioClient.RemoveObject(context.Background(), bucketName, objectName, minio.RemoveObjectOptions{})
-	if err != nil {
+	if err := objectStore().Remove(bucketName, objectName); err != nil {
 		return err
 	}
 	fmt.Println("Deleted the file from minio")
 
 	return nil
 }
+
+// MoveFile moves an object to another name within its bucket
+func MoveFile(bucketName, from, to string) error {
+	return objectStore().Move(bucketName, from, to)
+}
+
+// FileExists reports whether an object exists in a bucket
+func FileExists(bucketName, objectName string) (bool, error) {
+	return objectStore().Exists(bucketName, objectName)
+}
+
+// ListFiles lists every object of a bucket with the time it was last modified
+func ListFiles(bucketName string) (map[string]time.Time, error) {
+	return objectStore().List(bucketName)
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Actions of storage operations
+const (
+	StorageDelete = "delete"
+	StorageMove   = "move"
+)
+
+// compensationDelay is how long the undo step of an upload waits before the outbox worker may apply it,
+// long enough for the request that wrote it to commit its rows or compensate itself
+const compensationDelay = 10 * time.Minute
+
+// outboxBatch is how many due operations the worker applies per pass
+const outboxBatch = 100
+
+// ErrStorage wraps failures of object storage, as opposed to the database, in multi-step operations
+var ErrStorage = errors.New("object storage")
+
+// enqueueStorage writes a storage operation, due at once, in a transaction; apply it with applyStorage after the commit
+func enqueueStorage(tx *gorm.DB, operation *models.StorageOperation) error {
+	operation.ID = uuid.New().String()
+	operation.CreatedAt = time.Now()
+	if operation.DueAt.IsZero() {
+		operation.DueAt = operation.CreatedAt
+	}
+	return tx.Create(operation).Error
+}
+
+// applyStorage runs a storage operation and removes it from the outbox; a failed one stays there for the worker to retry
+func applyStorage(db *gorm.DB, operation models.StorageOperation) error {
+	var err error
+	switch operation.Action {
+	case StorageDelete:
+		err = DeleteFile(operation.Bucket, operation.ObjectName)
+	case StorageMove:
+		err = moveOnce(operation.Bucket, operation.ObjectName, operation.Target)
+	default:
+		err = fmt.Errorf("unknown storage action %q", operation.Action)
+	}
+	if err != nil {
+		// back off a minute per attempt, up to an hour
+		delay := min(time.Duration(operation.Attempts+1)*time.Minute, time.Hour)
+		if saveErr := db.Model(&operation).Updates(map[string]interface{}{
+			"attempts":   operation.Attempts + 1,
+			"last_error": err.Error(),
+			"due_at":     time.Now().Add(delay),
+		}).Error; saveErr != nil {
+			log.Printf("Failed to record storage operation %s: %v", operation.ID, saveErr)
+		}
+		return err
+	}
+	return db.Delete(&operation).Error
+}
+
+// applyAll applies operations after their transaction committed, counting those that succeeded
+func applyAll(db *gorm.DB, operations []models.StorageOperation) (int64, []error) {
+	var applied int64
+	var errs []error
+	for _, operation := range operations {
+		if err := applyStorage(db, operation); err != nil {
+			log.Printf("Storage operation %s %s/%s failed, the outbox will retry it: %v", operation.Action, operation.Bucket, operation.ObjectName, err)
+			errs = append(errs, fmt.Errorf("%w: %s %s: %v", ErrStorage, operation.Action, operation.ObjectName, err))
+			continue
+		}
+		applied++
+	}
+	return applied, errs
+}
+
+// moveOnce moves an object unless an earlier attempt already did
+func moveOnce(bucketName, from, to string) error {
+	err := MoveFile(bucketName, from, to)
+	if err == nil {
+		return nil
+	}
+	if exists, statErr := FileExists(bucketName, from); statErr != nil || exists {
+		return err
+	}
+	if exists, statErr := FileExists(bucketName, to); statErr == nil && exists {
+		return nil
+	}
+	return err
+}
+
+// storageSaga stores objects ahead of the rows that point to them. Before each step it writes the operation
+// that undoes it, due only after compensationDelay; committing the rows removes those operations in the same
+// transaction, and a failure applies them at once. If the process stops in between, the outbox worker undoes
+// the steps once they are due.
+type storageSaga struct {
+	db            *gorm.DB
+	compensations []models.StorageOperation
+}
+
+// step runs one storage change after recording how to undo it
+func (saga *storageSaga) step(do func() error, undo models.StorageOperation) error {
+	undo.DueAt = time.Now().Add(compensationDelay)
+	if err := enqueueStorage(saga.db, &undo); err != nil {
+		return err
+	}
+	saga.compensations = append(saga.compensations, undo)
+	if err := do(); err != nil {
+		return fmt.Errorf("%w: %v", ErrStorage, err)
+	}
+	return nil
+}
+
+// commit removes the undo steps, and any other pending operation on the same objects, within the rows' transaction
+func (saga *storageSaga) commit(tx *gorm.DB) error {
+	for _, undo := range saga.compensations {
+		if err := tx.Where("bucket = ? AND object_name = ?", undo.Bucket, undo.ObjectName).Delete(&models.StorageOperation{}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compensate undoes the steps taken so far, newest first; undo steps that fail stay in the outbox
+func (saga *storageSaga) compensate() {
+	for i := len(saga.compensations) - 1; i >= 0; i-- {
+		if err := applyStorage(saga.db, saga.compensations[i]); err != nil {
+			log.Printf("Failed to undo storage step on %s/%s, the outbox will retry it: %v", saga.compensations[i].Bucket, saga.compensations[i].ObjectName, err)
+		}
+	}
+}
+
+// StorageOperations lists the operations waiting in the outbox, oldest first
+func StorageOperations(db *gorm.DB, limit int) ([]models.StorageOperation, error) {
+	var operations []models.StorageOperation
+	err := db.Order("created_at").Limit(limit).Find(&operations).Error
+	return operations, err
+}
+
+// ProcessOutbox applies the storage operations that are due, returning how many succeeded and failed
+func ProcessOutbox(db *gorm.DB) (int, int, error) {
+	var operations []models.StorageOperation
+	if err := db.Where("due_at <= ?", time.Now()).Order("due_at").Limit(outboxBatch).Find(&operations).Error; err != nil {
+		return 0, 0, err
+	}
+	applied, errs := applyAll(db, operations)
+	return int(applied), len(errs), nil
+}
+
+// StartOutboxWorker applies due storage operations in the background every OUTBOX_INTERVAL (1m by default, 0 turns it off)
+func StartOutboxWorker(db *gorm.DB) {
+	interval := time.Minute
+	if value := os.Getenv("OUTBOX_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Invalid OUTBOX_INTERVAL %q, using %s: %v", value, interval, err)
+		} else {
+			interval = parsed
+		}
+	}
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, _, err := ProcessOutbox(db); err != nil {
+				log.Printf("Failed to process the storage outbox: %v", err)
+			}
+		}
+	}()
+}
+
+// StoreDocument uploads the PDF of a new document and saves its row, removing the PDF again if the row cannot be saved
+func StoreDocument(db *gorm.DB, document models.Document, pdfBytes []byte) error {
+	saga := storageSaga{db: db}
+	err := saga.step(func() error {
+		return UploadFile("pdfs", document.ID, bytes.NewReader(pdfBytes))
+	}, models.StorageOperation{Action: StorageDelete, Bucket: "pdfs", ObjectName: document.ID, Reason: "document.create"})
+	if err == nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&document).Error; err != nil {
+				return err
+			}
+			return saga.commit(tx)
+		})
+	}
+	if err != nil {
+		saga.compensate()
+	}
+	return err
+}
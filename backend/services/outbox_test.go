@@ -0,0 +1,82 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"example/pdfgenerator/models"
+)
+
+func TestStoreDocumentCommitsItsUndoStep(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+
+	if err := StoreDocument(db, models.Document{ID: "doc", RefNumber: "DOC-1", CreatedAt: time.Now()}, []byte("%PDF")); err != nil {
+		t.Fatal(err)
+	}
+	if !objects.Names("pdfs")["doc"] {
+		t.Error("PDF not uploaded")
+	}
+	if operations, _ := StorageOperations(db, MaxPageSize); len(operations) != 0 {
+		t.Errorf("undo step left in the outbox: %+v", operations)
+	}
+}
+
+func TestStoreDocumentCompensatesWhenTheRowFails(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	if err := db.Exec("DROP TABLE documents").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := StoreDocument(db, models.Document{ID: "doc", RefNumber: "DOC-1", CreatedAt: time.Now()}, []byte("%PDF")); err == nil {
+		t.Fatal("expected an error without a documents table")
+	}
+	if names := objects.Names("pdfs"); len(names) != 0 {
+		t.Errorf("uploaded PDF not removed: %v", names)
+	}
+	if operations, _ := StorageOperations(db, MaxPageSize); len(operations) != 0 {
+		t.Errorf("applied undo step left in the outbox: %+v", operations)
+	}
+}
+
+func TestOutboxRetriesFailedOperations(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	document := models.Document{ID: "doc", RefNumber: "DOC-1", CreatedAt: time.Now()}
+	if err := StoreDocument(db, document, []byte("%PDF")); err != nil {
+		t.Fatal(err)
+	}
+
+	unavailable := errors.New("storage unavailable")
+	objects.Fail = func(action, bucketName, objectName string) error { return unavailable }
+	if err := MoveDocumentToTrash(db, document); err != nil {
+		t.Fatalf("the row should go to the trash without storage: %v", err)
+	}
+	operations, err := StorageOperations(db, MaxPageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(operations) != 1 || operations[0].Attempts != 1 || operations[0].LastError == "" || !operations[0].DueAt.After(time.Now()) {
+		t.Fatalf("unexpected outbox %+v", operations)
+	}
+
+	// not due yet
+	if applied, failed, err := ProcessOutbox(db); err != nil || applied+failed != 0 {
+		t.Fatalf("processed %d and %d early, %v", applied, failed, err)
+	}
+	objects.Fail = nil
+	if err := db.Model(&operations[0]).Update("due_at", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if applied, failed, err := ProcessOutbox(db); err != nil || applied != 1 || failed != 0 {
+		t.Fatalf("applied %d, failed %d, %v", applied, failed, err)
+	}
+	if names := objects.Names("pdfs"); !names[trashPrefix+"doc"] || names["doc"] {
+		t.Errorf("PDF not moved by the retry: %v", names)
+	}
+	if operations, _ := StorageOperations(db, MaxPageSize); len(operations) != 0 {
+		t.Errorf("applied operation left in the outbox: %+v", operations)
+	}
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"example/pdfgenerator/repository"
+)
+
+// Page sizes of list endpoints
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Page describes the returned slice of a list
+type Page struct {
+	Total    int64  `json:"total"`
+	Limit    int    `json:"limit"`
+	Offset   int    `json:"offset"`
+	Sort     string `json:"sort"`
+	Next     string `json:"next,omitempty"`
+	Previous string `json:"previous,omitempty"`
+}
+
+// TemplateList is the list resource of the template list
+var TemplateList = repository.ListResource{
+	Sorts:       map[string]string{"createdAt": "created_at", "templateName": "name", "refNumber": "ref_number", "category": "category", "status": "status"},
+	Filters:     map[string]string{"refNumber": "ref_number", "format": "format"},
+	Search:      []string{"name", "description"},
+	DefaultSort: "createdAt",
+}
+
+// ParseListTime reads a date range bound as RFC 3339 or a plain date; a plain end date includes that whole day
+func ParseListTime(value string, end bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q, use YYYY-MM-DD or RFC 3339", value)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
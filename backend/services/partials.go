@@ -0,0 +1,336 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var partialNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.\-]*$`)
+
+// partialVersionAttempts is how often SavePartial picks the next version when concurrent uploads take it first
+const partialVersionAttempts = 5
+
+// ErrUnknownPartial is returned when a template uses a partial that is neither stored nor defined by the template
+var ErrUnknownPartial = errors.New("unknown partial")
+
+// PartialSource is a partial or layout ready to be parsed alongside a template
+type PartialSource struct {
+	Name    string
+	Content string
+}
+
+// ValidatePartialName checks a partial name can be referenced as {{template "name" .}}
+func ValidatePartialName(name string) error {
+	if !partialNamePattern.MatchString(name) {
+		return errors.New("partial name must start with a letter or digit and only contain letters, digits, '_', '-' and '.'")
+	}
+	return nil
+}
+
+// ParseTemplateTrees parses template source without checking functions, so it can be inspected before rendering
+func ParseTemplateTrees(name, content string) (map[string]*parse.Tree, error) {
+	tree := parse.New(name)
+	tree.Mode = parse.SkipFuncCheck | parse.ParseComments
+	trees := map[string]*parse.Tree{}
+	if _, err := tree.Parse(content, "", "", trees); err != nil {
+		return nil, err
+	}
+	return trees, nil
+}
+
+// TemplateReferences lists the names used in {{template "name"}} calls that the content does not define itself
+func TemplateReferences(content string) ([]string, error) {
+	trees, err := ParseTemplateTrees("upload", content)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var references []string
+	for _, tree := range trees {
+		walkTemplateNodes(tree.Root, func(node parse.Node) {
+			call, ok := node.(*parse.TemplateNode)
+			if !ok || seen[call.Name] {
+				return
+			}
+			seen[call.Name] = true
+			if _, defined := trees[call.Name]; !defined {
+				references = append(references, call.Name)
+			}
+		})
+	}
+
+	sort.Strings(references)
+	return references, nil
+}
+
+// walkTemplateNodes calls visit for every node below root
+func walkTemplateNodes(node parse.Node, visit func(parse.Node)) {
+	if node == nil {
+		return
+	}
+	visit(node)
+
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateNodes(child, visit)
+		}
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, visit)
+	}
+}
+
+func walkBranch(branch *parse.BranchNode, visit func(parse.Node)) {
+	if branch.List != nil {
+		walkTemplateNodes(branch.List, visit)
+	}
+	if branch.ElseList != nil {
+		walkTemplateNodes(branch.ElseList, visit)
+	}
+}
+
+// SavePartial stores a new version of a partial or layout and records the partials it uses
+func SavePartial(db *gorm.DB, name, kind string, content []byte) (models.Partial, error) {
+	partial := models.Partial{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Kind:      kind,
+		Version:   1,
+		CreatedAt: time.Now(),
+	}
+	partial.FileName = "partials/" + partial.ID
+
+	references, err := TemplateReferences(string(content))
+	if err != nil {
+		return partial, err
+	}
+
+	if err := UploadTemplate("templates", partial.FileName, bytes.NewReader(content)); err != nil {
+		return partial, err
+	}
+
+	// (name, version) is unique, a concurrent upload that took the version makes us pick the next one
+	for attempt := 1; ; attempt++ {
+		err = createPartialVersion(db, &partial)
+		if err == nil {
+			break
+		}
+		var taken int64
+		if countErr := db.Unscoped().Model(&models.Partial{}).Where("name = ? AND version = ?", name, partial.Version).Count(&taken).Error; countErr != nil || taken == 0 || attempt == partialVersionAttempts {
+			if deleteErr := DeleteFile("templates", partial.FileName); deleteErr != nil {
+				log.Printf("Failed to remove the file of unsaved partial %s: %v", partial.ID, deleteErr)
+			}
+			return partial, err
+		}
+	}
+
+	return partial, SaveDependencies(db, partial.ID, "partial", references)
+}
+
+// createPartialVersion saves a partial as the next version of its name
+func createPartialVersion(tx *gorm.DB, partial *models.Partial) error {
+	partial.Version = 1
+	var latest models.Partial
+	if err := tx.Unscoped().Where("name = ?", partial.Name).Order("version desc").First(&latest).Error; err == nil {
+		partial.Version = latest.Version + 1
+	}
+	return tx.Create(partial).Error
+}
+
+// SaveDependencies replaces the recorded partial references of a template or partial
+func SaveDependencies(db *gorm.DB, dependentId, dependentKind string, references []string) error {
+	if err := db.Where("dependent_id = ?", dependentId).Delete(&models.PartialDependency{}).Error; err != nil {
+		return err
+	}
+
+	for _, reference := range references {
+		name, _ := splitPartialVersion(reference)
+		if err := db.Create(&models.PartialDependency{
+			ID:            uuid.New().String(),
+			DependentId:   dependentId,
+			DependentKind: dependentKind,
+			PartialName:   name,
+			Reference:     reference,
+			CreatedAt:     time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindPartial returns the latest version of a partial, or a pinned one for references like "letterhead@2"
+func FindPartial(db *gorm.DB, reference string) (models.Partial, error) {
+	var partial models.Partial
+	name, version := splitPartialVersion(reference)
+
+	query := db.Where("name = ?", name)
+	if version > 0 {
+		query = query.Where("version = ?", version)
+	}
+	err := query.Order("version desc").First(&partial).Error
+	return partial, err
+}
+
+// ResolvePartials loads every partial and layout a template uses, following references between partials.
+// A reference that is neither a stored partial nor defined by the template or a loaded partial is an ErrUnknownPartial.
+func ResolvePartials(db *gorm.DB, content []byte) ([]PartialSource, error) {
+	trees, err := ParseTemplateTrees("upload", string(content))
+	if err != nil {
+		return nil, err
+	}
+	pending, err := TemplateReferences(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	// names defined by the template or a loaded partial, such as the blocks a layout calls
+	defined := map[string]bool{}
+	for name := range trees {
+		defined[name] = true
+	}
+
+	var sources []PartialSource
+	var unresolved []string
+	loaded := map[string]bool{}
+	for len(pending) > 0 {
+		reference := pending[0]
+		pending = pending[1:]
+		if loaded[reference] {
+			continue
+		}
+		loaded[reference] = true
+
+		partial, err := FindPartial(db, reference)
+		if err != nil {
+			unresolved = append(unresolved, reference)
+			continue
+		}
+
+		partialBytes, err := DownloadFile("templates", partial.FileName)
+		if err != nil {
+			return nil, fmt.Errorf("error fetching partial %s: %v", reference, err)
+		}
+
+		partialTrees, err := ParseTemplateTrees(reference, string(partialBytes))
+		if err != nil {
+			return nil, fmt.Errorf("partial %s: %v", reference, err)
+		}
+		for name := range partialTrees {
+			defined[name] = true
+		}
+		nested, err := TemplateReferences(string(partialBytes))
+		if err != nil {
+			return nil, fmt.Errorf("partial %s: %v", reference, err)
+		}
+		pending = append(pending, nested...)
+
+		sources = append(sources, PartialSource{Name: reference, Content: string(partialBytes)})
+	}
+
+	var missing []string
+	for _, reference := range unresolved {
+		if !defined[reference] {
+			missing = append(missing, reference)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPartial, strings.Join(missing, ", "))
+	}
+
+	return sources, nil
+}
+
+// CheckPartialReferences makes sure every partial a template of the given format uses can be resolved
+func CheckPartialReferences(db *gorm.DB, format string, content []byte) error {
+	if format == FormatDocx || format == FormatPDFForm {
+		return nil
+	}
+	_, err := ResolvePartials(db, content)
+	return err
+}
+
+// PartialDependents lists the templates and partials that use a partial, directly or through other partials
+func PartialDependents(db *gorm.DB, name string) ([]models.Template, []models.Partial, error) {
+	names := map[string]bool{name: true}
+	pending := []string{name}
+	var partials []models.Partial
+	var dependentIds []string
+
+	for len(pending) > 0 {
+		var dependencies []models.PartialDependency
+		if err := db.Where("partial_name IN ?", pending).Find(&dependencies).Error; err != nil {
+			return nil, nil, err
+		}
+		pending = nil
+
+		var partialIds []string
+		for _, dependency := range dependencies {
+			if dependency.DependentKind == "partial" {
+				partialIds = append(partialIds, dependency.DependentId)
+			} else {
+				dependentIds = append(dependentIds, dependency.DependentId)
+			}
+		}
+		if len(partialIds) == 0 {
+			break
+		}
+
+		var found []models.Partial
+		if err := db.Where("id IN ?", partialIds).Find(&found).Error; err != nil {
+			return nil, nil, err
+		}
+		for _, partial := range found {
+			if !names[partial.Name] {
+				names[partial.Name] = true
+				pending = append(pending, partial.Name)
+				partials = append(partials, partial)
+			}
+		}
+	}
+
+	var templates []models.Template
+	if len(dependentIds) > 0 {
+		if err := db.Where("id IN ?", dependentIds).Find(&templates).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return templates, partials, nil
+}
+
+// splitPartialVersion splits "letterhead@2" into its name and pinned version, 0 meaning latest
+func splitPartialVersion(reference string) (string, int) {
+	name, version, found := strings.Cut(reference, "@")
+	if !found {
+		return reference, 0
+	}
+	n, err := strconv.Atoi(version)
+	if err != nil || n <= 0 {
+		return reference, 0
+	}
+	return name, n
+}
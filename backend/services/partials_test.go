@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"example/pdfgenerator/models"
+)
+
+func TestSavePartialNumbersVersions(t *testing.T) {
+	db := useTestDB(t)
+	useTestObjects(t)
+
+	for want := 1; want <= 3; want++ {
+		partial, err := SavePartial(db, "footer", "partial", []byte(`<footer>{{.company}}</footer>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if partial.Version != want {
+			t.Errorf("got version %d, want %d", partial.Version, want)
+		}
+	}
+
+	// deleted versions keep their numbers, a new upload comes after them
+	if err := db.Where("name = ?", "footer").Delete(&models.Partial{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	partial, err := SavePartial(db, "footer", "partial", []byte(`<footer></footer>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if partial.Version != 4 {
+		t.Errorf("got version %d after deleting the partial, want 4", partial.Version)
+	}
+}
+
+func TestPartialVersionsAreUnique(t *testing.T) {
+	db := useTestDB(t)
+
+	rows := []models.Partial{{ID: "a", Name: "header", Version: 1}, {ID: "b", Name: "header", Version: 1}}
+	if err := db.Create(&rows[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&rows[1]).Error; err == nil {
+		t.Error("stored two partials with the same name and version")
+	}
+}
+
+func TestSavePartialRemovesFileWhenRowFails(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	if err := db.Exec("DROP TABLE partials").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SavePartial(db, "footer", "partial", []byte(`<footer></footer>`)); err == nil {
+		t.Fatal("expected an error without a partials table")
+	}
+	if names := objects.Names("templates"); len(names) != 0 {
+		t.Errorf("left files behind: %v", names)
+	}
+}
+
+func TestResolvePartials(t *testing.T) {
+	db := useTestDB(t)
+	useTestObjects(t)
+
+	if _, err := SavePartial(db, "layout", "layout", []byte(`<main>{{template "content" .}}</main>{{template "footer" .}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SavePartial(db, "footer", "partial", []byte(`<footer></footer>`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// "content" is a block the template defines for the layout
+	sources, err := ResolvePartials(db, []byte(`{{define "content"}}body{{end}}{{template "layout" .}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 2 || sources[0].Name != "layout" || sources[1].Name != "footer" {
+		t.Errorf("unexpected partials %+v", sources)
+	}
+
+	_, err = ResolvePartials(db, []byte(`{{template "layout" .}}{{template "missing" .}}{{template "footer@7" .}}`))
+	if !errors.Is(err, ErrUnknownPartial) {
+		t.Fatalf("got %v, want ErrUnknownPartial", err)
+	}
+	// the layout's "content" block is not defined by this template either
+	for _, name := range []string{"content", "footer@7", "missing"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not name %s", err, name)
+		}
+	}
+
+	if err := CheckPartialReferences(db, FormatDocx, []byte(`{{template "missing" .}}`)); err != nil {
+		t.Errorf("DOCX templates cannot use partials, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"example/pdfgenerator/models"
+
+	"gorm.io/gorm"
+)
+
+// diffResolution is the DPI pages are rasterized at for image diffs
+const diffResolution = 72
+
+// ErrNoPDFText is returned when pdftotext is not installed
+var ErrNoPDFText = errors.New("PDF text extraction needs pdftotext (poppler-utils), set PDFTOTEXT to its path")
+
+// PageDiff compares one page of two PDFs; pages only one side has are added or removed
+type PageDiff struct {
+	Page   int              `json:"page"`
+	Status string           `json:"status"`
+	Image  *ImageDiffReport `json:"image,omitempty"`
+}
+
+// DocumentDiffReport is the text and per page image diff of two PDFs
+type DocumentDiffReport struct {
+	Changed   bool           `json:"changed"`
+	Text      TextDiffReport `json:"text"`
+	PixelDiff bool           `json:"pixelDiff"`
+	Pages     []PageDiff     `json:"pages"`
+}
+
+// ComparePDFs diffs the extracted text of two PDFs and, when pdftoppm is installed, every page pixel by pixel
+func ComparePDFs(before, after []byte) (DocumentDiffReport, error) {
+	report := DocumentDiffReport{Pages: []PageDiff{}}
+
+	beforeText, err := PDFText(before)
+	if err != nil {
+		return report, err
+	}
+	afterText, err := PDFText(after)
+	if err != nil {
+		return report, err
+	}
+	report.Text = TextDiff(beforeText, afterText)
+	report.Changed = report.Text.Changed > 0
+
+	if _, err := exec.LookPath(popplerPath("PDFTOPPM", "pdftoppm")); err != nil {
+		return report, nil
+	}
+	report.PixelDiff = true
+
+	beforePages, err := PDFPageImages(before)
+	if err != nil {
+		return report, err
+	}
+	afterPages, err := PDFPageImages(after)
+	if err != nil {
+		return report, err
+	}
+
+	for i := 0; i < max(len(beforePages), len(afterPages)); i++ {
+		page := PageDiff{Page: i + 1}
+		switch {
+		case i >= len(beforePages):
+			page.Status = "added"
+		case i >= len(afterPages):
+			page.Status = "removed"
+		default:
+			image, err := ImageDiff(beforePages[i], afterPages[i])
+			if err != nil {
+				return report, fmt.Errorf("error comparing page %d: %v", i+1, err)
+			}
+			page.Status = "unchanged"
+			if image.ChangedPixels > 0 {
+				page.Status = "changed"
+				page.Image = &image
+			}
+		}
+		report.Changed = report.Changed || page.Status != "unchanged"
+		report.Pages = append(report.Pages, page)
+	}
+
+	return report, nil
+}
+
+// CompareRevisions renders two revisions of a template with the same payload and diffs the results.
+// Text templates are compared as text, every other format as PDF.
+func CompareRevisions(db *gorm.DB, template models.Template, from, to models.TemplateRevision, data map[string]interface{}, keyOrder KeyOrder, locales []string) (DocumentDiffReport, error) {
+	render := func(revision models.TemplateRevision) ([]byte, error) {
+		templateBytes, opts, err := LoadRevision(db, template, revision)
+		if err != nil {
+			return nil, err
+		}
+		opts.Locales = locales
+		opts.KeyOrder = keyOrder
+
+		if template.Format == FormatText {
+			text, err := GenerateText(templateBytes, data, opts)
+			return []byte(text), err
+		}
+		return GeneratePDF(templateBytes, data, opts)
+	}
+
+	before, err := render(from)
+	if err != nil {
+		return DocumentDiffReport{}, fmt.Errorf("error rendering revision %d: %v", from.Revision, err)
+	}
+	after, err := render(to)
+	if err != nil {
+		return DocumentDiffReport{}, fmt.Errorf("error rendering revision %d: %v", to.Revision, err)
+	}
+
+	if template.Format == FormatText {
+		report := DocumentDiffReport{Text: TextDiff(string(before), string(after)), Pages: []PageDiff{}}
+		report.Changed = report.Text.Changed > 0
+		return report, nil
+	}
+	return ComparePDFs(before, after)
+}
+
+// PDFText extracts the text of a PDF in reading order with pdftotext
+func PDFText(pdf []byte) (string, error) {
+	path := popplerPath("PDFTOTEXT", "pdftotext")
+	if _, err := exec.LookPath(path); err != nil {
+		return "", ErrNoPDFText
+	}
+
+	workDir, err := os.MkdirTemp("", "pdfdiff-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(workDir)
+
+	input := filepath.Join(workDir, "document.pdf")
+	if err := os.WriteFile(input, pdf, 0o600); err != nil {
+		return "", err
+	}
+	output := filepath.Join(workDir, "document.txt")
+	if err := runPoppler(path, "-enc", "UTF-8", input, output); err != nil {
+		return "", err
+	}
+
+	text, err := os.ReadFile(output)
+	if err != nil {
+		return "", err
+	}
+	// pages are separated by form feeds
+	return strings.ReplaceAll(string(text), "\f", "\n"), nil
+}
+
+// PDFPageImages rasterizes every page of a PDF to PNG with pdftoppm
+func PDFPageImages(pdf []byte) ([][]byte, error) {
+	workDir, err := os.MkdirTemp("", "pdfdiff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	input := filepath.Join(workDir, "document.pdf")
+	if err := os.WriteFile(input, pdf, 0o600); err != nil {
+		return nil, err
+	}
+	if err := runPoppler(popplerPath("PDFTOPPM", "pdftoppm"), "-png", "-r", strconv.Itoa(diffResolution), input, filepath.Join(workDir, "page")); err != nil {
+		return nil, err
+	}
+
+	// pages are written as page-1.png, or zero padded page-01.png for longer documents
+	files, err := filepath.Glob(filepath.Join(workDir, "page-*.png"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return pageNumber(files[i]) < pageNumber(files[j]) })
+
+	pages := make([][]byte, 0, len(files))
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, content)
+	}
+	return pages, nil
+}
+
+func runPoppler(path string, args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	if out, err := exec.CommandContext(ctx, path, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v: %s", filepath.Base(path), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func pageNumber(file string) int {
+	name := strings.TrimSuffix(filepath.Base(file), ".png")
+	n, _ := strconv.Atoi(name[strings.LastIndex(name, "-")+1:])
+	return n
+}
+
+func popplerPath(env, fallback string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	return fallback
+}
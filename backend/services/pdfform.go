@@ -0,0 +1,370 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// FormatPDFForm is the template format of uploaded fillable (AcroForm) PDFs
+const FormatPDFForm = "pdfform"
+
+// FormField describes one fillable field of a PDF form template, the schema of its request data
+type FormField struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Pages     []int    `json:"pages"`
+	Options   []string `json:"options,omitempty"`
+	Default   string   `json:"default,omitempty"`
+	Multiline bool     `json:"multiline,omitempty"`
+	Multi     bool     `json:"multi,omitempty"`
+	Locked    bool     `json:"locked,omitempty"`
+}
+
+// FormFields lists the fields of an AcroForm PDF
+func FormFields(pdf []byte) ([]FormField, error) {
+	group, err := api.ExportForm(bytes.NewReader(pdf), "template", nil)
+	if err != nil {
+		if errors.Is(err, api.ErrNoFormFieldsAffected) {
+			return nil, errors.New("PDF has no fillable form fields")
+		}
+		return nil, fmt.Errorf("invalid PDF form: %v", err)
+	}
+
+	var fields []FormField
+	for _, f := range group.Forms {
+		for _, field := range f.TextFields {
+			fields = append(fields, FormField{Name: formFieldName(field.Name, field.ID), Type: "text", Pages: field.Pages, Default: field.Default, Multiline: field.Multiline, Locked: field.Locked})
+		}
+		for _, field := range f.DateFields {
+			fields = append(fields, FormField{Name: formFieldName(field.Name, field.ID), Type: "date", Pages: field.Pages, Default: field.Default, Locked: field.Locked})
+		}
+		for _, field := range f.CheckBoxes {
+			fields = append(fields, FormField{Name: formFieldName(field.Name, field.ID), Type: "checkbox", Pages: field.Pages, Locked: field.Locked})
+		}
+		for _, field := range f.RadioButtonGroups {
+			fields = append(fields, FormField{Name: formFieldName(field.Name, field.ID), Type: "radio", Pages: field.Pages, Options: field.Options, Default: field.Default, Locked: field.Locked})
+		}
+		for _, field := range f.ComboBoxes {
+			fields = append(fields, FormField{Name: formFieldName(field.Name, field.ID), Type: "combobox", Pages: field.Pages, Options: field.Options, Default: field.Default, Locked: field.Locked})
+		}
+		for _, field := range f.ListBoxes {
+			fields = append(fields, FormField{Name: formFieldName(field.Name, field.ID), Type: "listbox", Pages: field.Pages, Options: field.Options, Multi: field.Multi, Locked: field.Locked})
+		}
+	}
+
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
+	return fields, nil
+}
+
+// FillPDFForm fills the fields of an AcroForm PDF from the request data, keyed by field name.
+// Dotted field names such as "applicant.name" are also looked up as nested objects.
+// A flattened result has the values drawn into the pages and no form fields left.
+func FillPDFForm(pdf []byte, data map[string]interface{}, flatten bool) ([]byte, error) {
+	group, err := api.ExportForm(bytes.NewReader(pdf), "template", nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PDF form: %v", err)
+	}
+
+	for _, f := range group.Forms {
+		for _, field := range f.TextFields {
+			if value, ok := formValue(data, formFieldName(field.Name, field.ID)); ok {
+				field.Value = formString(value)
+			}
+		}
+		for _, field := range f.DateFields {
+			if value, ok := formValue(data, formFieldName(field.Name, field.ID)); ok {
+				field.Value = formString(value)
+			}
+		}
+		for _, field := range f.CheckBoxes {
+			if value, ok := formValue(data, formFieldName(field.Name, field.ID)); ok {
+				field.Value = formChecked(value)
+			}
+		}
+		for _, field := range f.RadioButtonGroups {
+			if value, ok := formValue(data, formFieldName(field.Name, field.ID)); ok {
+				field.Value = formString(value)
+			}
+		}
+		for _, field := range f.ComboBoxes {
+			if value, ok := formValue(data, formFieldName(field.Name, field.ID)); ok {
+				field.Value = formString(value)
+			}
+		}
+		for _, field := range f.ListBoxes {
+			if value, ok := formValue(data, formFieldName(field.Name, field.ID)); ok {
+				field.Values = formStrings(value)
+			}
+		}
+	}
+
+	values, err := json.Marshal(group)
+	if err != nil {
+		return nil, err
+	}
+
+	var filled bytes.Buffer
+	if err := api.FillForm(bytes.NewReader(pdf), bytes.NewReader(values), &filled, nil); err != nil {
+		if errors.Is(err, api.ErrNoFormFieldsAffected) {
+			// nothing in the request matched a field, the form is returned as uploaded
+			filled.Reset()
+			filled.Write(pdf)
+		} else {
+			return nil, fmt.Errorf("error filling PDF form: %v", err)
+		}
+	}
+
+	if !flatten {
+		return filled.Bytes(), nil
+	}
+	return flattenPDFForm(filled.Bytes())
+}
+
+// flattenPDFForm draws every widget's appearance into its page and removes the form
+func flattenPDFForm(pdf []byte) ([]byte, error) {
+	ctx, err := api.ReadValidateAndOptimize(bytes.NewReader(pdf), model.NewDefaultConfiguration())
+	if err != nil {
+		return nil, err
+	}
+
+	// appearance streams without their own resources use the form's default resources, which go with the form
+	var formResources types.Object
+	if acroForm, err := ctx.DereferenceDict(ctx.RootDict["AcroForm"]); err == nil && acroForm != nil {
+		formResources = acroForm["DR"]
+	}
+
+	for pageNr := 1; pageNr <= ctx.PageCount; pageNr++ {
+		if err := flattenPage(ctx, pageNr, formResources); err != nil {
+			return nil, fmt.Errorf("error flattening page %d: %v", pageNr, err)
+		}
+	}
+	ctx.RootDict.Delete("AcroForm")
+
+	var flattened bytes.Buffer
+	if err := api.WriteContext(ctx, &flattened); err != nil {
+		return nil, err
+	}
+	return flattened.Bytes(), nil
+}
+
+func flattenPage(ctx *model.Context, pageNr int, formResources types.Object) error {
+	pageDict, _, _, err := ctx.PageDict(pageNr, true)
+	if err != nil {
+		return err
+	}
+	annots, err := ctx.DereferenceArray(pageDict["Annots"])
+	if err != nil || len(annots) == 0 {
+		return err
+	}
+
+	var kept types.Array
+	var content bytes.Buffer
+	xObjects := types.Dict{}
+	for i, ref := range annots {
+		annot, err := ctx.DereferenceDict(ref)
+		if err != nil {
+			return err
+		}
+		if subtype := annot.NameEntry("Subtype"); subtype == nil || *subtype != "Widget" {
+			kept = append(kept, ref)
+			continue
+		}
+
+		appearance, err := widgetAppearance(ctx, annot)
+		if err != nil {
+			return err
+		}
+		// hidden widgets and widgets without an appearance leave nothing on the page
+		if appearance == nil || annotationFlags(annot)&2 != 0 {
+			continue
+		}
+
+		stream, _, err := ctx.DereferenceStreamDict(*appearance)
+		if err != nil || stream == nil {
+			return err
+		}
+		stream.Dict["Type"] = types.Name("XObject")
+		stream.Dict["Subtype"] = types.Name("Form")
+		if _, ok := stream.Dict["Resources"]; !ok && formResources != nil {
+			stream.Dict["Resources"] = formResources
+		}
+
+		rect, ok := rectangle(ctx, annot["Rect"])
+		if !ok {
+			continue
+		}
+		bbox, ok := rectangle(ctx, stream.Dict["BBox"])
+		if !ok || bbox[2] == bbox[0] || bbox[3] == bbox[1] {
+			continue
+		}
+
+		scaleX := (rect[2] - rect[0]) / (bbox[2] - bbox[0])
+		scaleY := (rect[3] - rect[1]) / (bbox[3] - bbox[1])
+		name := fmt.Sprintf("FlatField%d", i)
+		xObjects[name] = *appearance
+		fmt.Fprintf(&content, "q %.4f 0 0 %.4f %.4f %.4f cm /%s Do Q\n",
+			scaleX, scaleY, rect[0]-bbox[0]*scaleX, rect[1]-bbox[1]*scaleY, name)
+	}
+
+	if len(kept) > 0 {
+		pageDict["Annots"] = kept
+	} else {
+		pageDict.Delete("Annots")
+	}
+	if content.Len() == 0 {
+		return nil
+	}
+
+	resources, err := ctx.DereferenceDict(pageDict["Resources"])
+	if err != nil {
+		return err
+	}
+	if resources == nil {
+		resources = types.Dict{}
+		pageDict["Resources"] = resources
+	}
+	pageXObjects, err := ctx.DereferenceDict(resources["XObject"])
+	if err != nil {
+		return err
+	}
+	if pageXObjects == nil {
+		pageXObjects = types.Dict{}
+		resources["XObject"] = pageXObjects
+	}
+	for name, ref := range xObjects {
+		pageXObjects[name] = ref
+	}
+
+	return ctx.AppendContent(pageDict, content.Bytes())
+}
+
+// widgetAppearance returns the normal appearance stream of a widget in its current state
+func widgetAppearance(ctx *model.Context, annot types.Dict) (*types.IndirectRef, error) {
+	ap, err := ctx.DereferenceDict(annot["AP"])
+	if err != nil || ap == nil {
+		return nil, err
+	}
+
+	normal := ap["N"]
+	if ref, ok := normal.(types.IndirectRef); ok {
+		object, err := ctx.Dereference(ref)
+		if err != nil {
+			return nil, err
+		}
+		if _, isStream := object.(types.StreamDict); isStream {
+			return &ref, nil
+		}
+		normal = object
+	}
+
+	// checkboxes and radio buttons keep one appearance per state, selected by /AS
+	states, ok := normal.(types.Dict)
+	state := annot.NameEntry("AS")
+	if !ok || state == nil {
+		return nil, nil
+	}
+	if ref, ok := states[*state].(types.IndirectRef); ok {
+		return &ref, nil
+	}
+	return nil, nil
+}
+
+func annotationFlags(annot types.Dict) int {
+	if flags := annot.IntEntry("F"); flags != nil {
+		return *flags
+	}
+	return 0
+}
+
+func rectangle(ctx *model.Context, o types.Object) ([4]float64, bool) {
+	var rect [4]float64
+	array, err := ctx.DereferenceArray(o)
+	if err != nil || len(array) != 4 {
+		return rect, false
+	}
+	for i, v := range array {
+		switch n := v.(type) {
+		case types.Integer:
+			rect[i] = float64(n)
+		case types.Float:
+			rect[i] = float64(n)
+		default:
+			return rect, false
+		}
+	}
+	if rect[0] > rect[2] {
+		rect[0], rect[2] = rect[2], rect[0]
+	}
+	if rect[1] > rect[3] {
+		rect[1], rect[3] = rect[3], rect[1]
+	}
+	return rect, true
+}
+
+func formFieldName(name, id string) string {
+	if name != "" {
+		return name
+	}
+	return id
+}
+
+// formValue finds the value of a field by its full name first, then by walking dotted names through nested objects
+func formValue(data map[string]interface{}, name string) (interface{}, bool) {
+	if value, ok := data[name]; ok {
+		return value, true
+	}
+
+	var current interface{} = data
+	for _, key := range strings.Split(name, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func formString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func formStrings(value interface{}) []string {
+	list, ok := value.([]interface{})
+	if !ok {
+		return []string{formString(value)}
+	}
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		values = append(values, formString(item))
+	}
+	return values
+}
+
+func formChecked(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case nil:
+		return false
+	default:
+		switch strings.ToLower(fmt.Sprint(v)) {
+		case "", "0", "false", "no", "off":
+			return false
+		}
+		return true
+	}
+}
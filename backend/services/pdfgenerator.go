@@ -3,27 +3,31 @@ package services
 import (
 	"bytes"
 	"errors"
-	"example/pdfgenerator/initializers"
 	"example/pdfgenerator/models"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
 
 	// "encoding/base64"
 	"html/template"
 
 	"github.com/SebastiaanKlippert/go-wkhtmltopdf"
+	"gorm.io/gorm"
 )
 
-func GeneratePDF2(templateBytes []byte, data map[string]interface{}) ([]byte, error) {
-	// Parse the HTML template
-	tmpl, err := template.New("upload").Parse(string(templateBytes))
-	if err != nil {
-		return nil, err
+func GeneratePDF2(templateBytes []byte, data map[string]interface{}, opts RenderOptions) ([]byte, error) {
+	if opts.Format == FormatDocx {
+		return nil, errors.New("DOCX templates have no HTML preview, use /generate-docx")
+	}
+	if opts.Format == FormatPDFForm {
+		return nil, errors.New("PDF form templates have no HTML preview")
 	}
 
-	// Create a buffer to store the filled template
-	var filledTemplate bytes.Buffer
-
-	// Execute the template with the JSON data, storing the result in the buffer
-	if err := tmpl.Execute(&filledTemplate, data); err != nil {
+	// Fill the template with the JSON data, converting Markdown templates to HTML
+	filled, _, err := fillTemplate(templateBytes, data, opts)
+	if err != nil {
 		return nil, err
 	}
 	//log out the output at this point
@@ -47,21 +51,26 @@ func GeneratePDF2(templateBytes []byte, data map[string]interface{}) ([]byte, er
 	// pdfBase64 := base64.StdEncoding.EncodeToString(pdfg.Bytes())
 	// pdfBase64 :=
 	// return pdfg.Bytes(), nil
-	return filledTemplate.Bytes(), nil
+	return filled, nil
 }
 
-func GeneratePDF(templateBytes []byte, data map[string]interface{}) ([]byte, error) {
-	// Parse the HTML template
-	tmpl, err := template.New("upload").Parse(string(templateBytes))
-	if err != nil {
-		return nil, err
+func GeneratePDF(templateBytes []byte, data map[string]interface{}, opts RenderOptions) ([]byte, error) {
+	// Word templates are merged in Go and converted by the configured local converter
+	if opts.Format == FormatDocx {
+		filled, err := FillDocx(templateBytes, data, opts)
+		if err != nil {
+			return nil, err
+		}
+		return ConvertDocxToPDF(filled)
+	}
+	// fillable PDF forms are filled field by field instead of being rendered
+	if opts.Format == FormatPDFForm {
+		return FillPDFForm(templateBytes, data, opts.Flatten)
 	}
 
-	// Create a buffer to store the filled template
-	var filledTemplate bytes.Buffer
-
-	// Execute the template with the JSON data, storing the result in the buffer
-	if err := tmpl.Execute(&filledTemplate, data); err != nil {
+	// Fill the template with the JSON data, converting Markdown templates to HTML
+	filled, pageOptions, err := fillTemplate(templateBytes, data, opts)
+	if err != nil {
 		return nil, err
 	}
 	//log out the output at this point
@@ -74,9 +83,21 @@ func GeneratePDF(templateBytes []byte, data map[string]interface{}) ([]byte, err
 	if err != nil {
 		return nil, err
 	}
+	applyPageOptions(pdfg, pageOptions)
+
+	// Bundled templates are rendered from a working directory so relative asset links resolve locally
+	if len(opts.Assets) > 0 {
+		workDir, err := writeBundleWorkDir(filled, opts.Assets)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(workDir)
 
-	// Add a new page to the PDF generator with the filled template content
-	pdfg.AddPage(wkhtmltopdf.NewPageReader(bytes.NewReader(filledTemplate.Bytes())))
+		pdfg.AddPage(bundlePage(workDir))
+	} else {
+		// Add a new page to the PDF generator with the filled template content
+		pdfg.AddPage(wkhtmltopdf.NewPageReader(bytes.NewReader(filled)))
+	}
 	if err := pdfg.Create(); err != nil {
 		return nil, err
 	}
@@ -87,44 +108,161 @@ func GeneratePDF(templateBytes []byte, data map[string]interface{}) ([]byte, err
 	return pdfg.Bytes(), nil
 }
 
-func DeleteDocumentByRefNumber(refNumber string) error {
+// parseTemplate parses the uploaded template after its partials and layouts,
+// so a {{define}} in the template overrides a {{block}} of the layout it uses
+func parseTemplate(templateBytes []byte, opts RenderOptions) (*template.Template, error) {
+	tmpl := template.New("upload").Funcs(TemplateFuncs(opts))
+	for _, partial := range opts.Partials {
+		if _, err := tmpl.New(partial.Name).Parse(partial.Content); err != nil {
+			return nil, fmt.Errorf("partial %s: %v", partial.Name, err)
+		}
+	}
+
+	return tmpl.Parse(string(templateBytes))
+}
+
+// fillTemplate executes the template with the request data and returns the HTML to render.
+// Markdown templates have their front matter removed first and are converted to a themed HTML document afterwards.
+func fillTemplate(templateBytes []byte, data map[string]interface{}, opts RenderOptions) ([]byte, PageOptions, error) {
+	var frontMatter FrontMatter
+	if opts.Format == FormatMarkdown {
+		var err error
+		if frontMatter, templateBytes, err = ParseFrontMatter(templateBytes); err != nil {
+			return nil, frontMatter.PageOptions, err
+		}
+	}
+
+	tmpl, err := parseTemplate(templateBytes, opts)
+	if err != nil {
+		return nil, frontMatter.PageOptions, err
+	}
+
+	var filledTemplate bytes.Buffer
+	if err := tmpl.Execute(&filledTemplate, data); err != nil {
+		return nil, frontMatter.PageOptions, err
+	}
+
+	filled := filledTemplate.Bytes()
+	if opts.Format == FormatMarkdown {
+		if filled, err = MarkdownToHTML(filled, frontMatter, opts); err != nil {
+			return nil, frontMatter.PageOptions, err
+		}
+	}
+
+	return ApplyTextDirection(filled, opts), frontMatter.PageOptions, nil
+}
+
+// applyPageOptions passes page size, orientation and margins from front matter to wkhtmltopdf
+func applyPageOptions(pdfg *wkhtmltopdf.PDFGenerator, page PageOptions) {
+	switch strings.ToLower(page.Size) {
+	case "a3":
+		pdfg.PageSize.Set(wkhtmltopdf.PageSizeA3)
+	case "a4":
+		pdfg.PageSize.Set(wkhtmltopdf.PageSizeA4)
+	case "a5":
+		pdfg.PageSize.Set(wkhtmltopdf.PageSizeA5)
+	case "letter":
+		pdfg.PageSize.Set(wkhtmltopdf.PageSizeLetter)
+	case "legal":
+		pdfg.PageSize.Set(wkhtmltopdf.PageSizeLegal)
+	}
+
+	switch strings.ToLower(page.Orientation) {
+	case "portrait":
+		pdfg.Orientation.Set(wkhtmltopdf.OrientationPortrait)
+	case "landscape":
+		pdfg.Orientation.Set(wkhtmltopdf.OrientationLandscape)
+	}
+
+	margins := []struct {
+		value  *uint
+		option interface{ Set(uint) }
+	}{
+		{page.MarginTop, &pdfg.MarginTop},
+		{page.MarginBottom, &pdfg.MarginBottom},
+		{page.MarginLeft, &pdfg.MarginLeft},
+		{page.MarginRight, &pdfg.MarginRight},
+	}
+	for _, margin := range margins {
+		if margin.value != nil {
+			margin.option.Set(*margin.value)
+		} else if page.Margin != nil {
+			margin.option.Set(*page.Margin)
+		}
+	}
+}
+
+// blackholeProxy is an address nothing listens on, bundle renders send their network requests there
+const blackholeProxy = "http://127.0.0.1:9"
+
+// bundlePage loads a bundle's index.html with file access limited to its work dir and no network access,
+// since bundle templates are user-supplied HTML
+func bundlePage(workDir string) *wkhtmltopdf.Page {
+	page := wkhtmltopdf.NewPage(filepath.Join(workDir, "index.html"))
+	page.DisableLocalFileAccess.Set(true)
+	page.Allow.Set(workDir)
+	page.Proxy.Set(blackholeProxy)
+	page.ProxyHostnameLookup.Set(true)
+	return page
+}
+
+// writeBundleWorkDir lays out the filled index.html and its assets in a temporary directory
+func writeBundleWorkDir(index []byte, assets map[string][]byte) (string, error) {
+	workDir, err := os.MkdirTemp("", "autodocs-bundle-")
+	if err != nil {
+		return "", err
+	}
+
+	for assetPath, content := range assets {
+		target := filepath.Join(workDir, filepath.FromSlash(path.Clean("/"+assetPath)))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			os.RemoveAll(workDir)
+			return "", err
+		}
+		if err := os.WriteFile(target, content, 0644); err != nil {
+			os.RemoveAll(workDir)
+			return "", err
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(workDir, "index.html"), index, 0644); err != nil {
+		os.RemoveAll(workDir)
+		return "", err
+	}
+
+	return workDir, nil
+}
+
+func DeleteDocumentByRefNumber(db *gorm.DB, refNumber string) error {
 	var document models.Document
 
 	// Find the document by refNumber
-	if err := initializers.DB.Where("ref_number = ?", refNumber).First(&document).Error; err != nil {
+	if err := db.Where("ref_number = ?", refNumber).First(&document).Error; err != nil {
 		return errors.New("document not found")
 	}
-
-	//delete the document from minio
-	err := DeleteFile("pdfs", document.ID)
-	if err != nil {
-		return errors.New("failed to delete document from storage: " + err.Error())
+	if document.LegalHold {
+		return ErrLegalHold
 	}
 
-	// Delete the document
-	if err := initializers.DB.Delete(&document).Error; err != nil {
-		return err
+	// move the document to the trash, it can be restored until the trash is purged
+	if err := MoveDocumentToTrash(db, document); err != nil {
+		return errors.New("failed to move document to trash: " + err.Error())
 	}
 
 	return nil
 }
 
-func DeleteTemplateByRefNumber(refNumber string) error {
+func DeleteTemplateByRefNumber(db *gorm.DB, refNumber string) error {
 	var template models.Template
 
 	// Find the document by refNumber
-	if err := initializers.DB.Where("ref_number = ?", refNumber).First(&template).Error; err != nil {
+	if err := db.Where("ref_number = ?", refNumber).First(&template).Error; err != nil {
 		return errors.New("template not found")
 	}
 
-	//delete the file from minio
-	err := DeleteFile("templates", template.ID)
-	if err != nil {
-		return errors.New("failed to delete template from storage: " + err.Error())
-	}
-	// Delete the document
-	if err := initializers.DB.Delete(&template).Error; err != nil {
-		return err
+	// move the template to the trash, it can be restored until the trash is purged
+	if err := MoveTemplateToTrash(db, template); err != nil {
+		return errors.New("failed to move template to trash: " + err.Error())
 	}
 
 	return nil
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundlePageIsSandboxed(t *testing.T) {
+	workDir := t.TempDir()
+	args := strings.Join(bundlePage(workDir).Args(), " ")
+
+	for _, want := range []string{"--disable-local-file-access", "--allow " + workDir, "--proxy " + blackholeProxy, "--proxy-hostname-lookup"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("page arguments %q are missing %q", args, want)
+		}
+	}
+	if strings.Contains(args, "--enable-local-file-access") {
+		t.Errorf("page arguments %q allow every local file", args)
+	}
+}
+
+func TestSnapshotIsSandboxed(t *testing.T) {
+	workDir := t.TempDir()
+	args := strings.Join(snapshotArgs(workDir, filepath.Join(workDir, "snapshot.png")), " ")
+
+	for _, want := range []string{"--disable-local-file-access", "--allow " + workDir, "--proxy " + blackholeProxy, "--proxy-hostname-lookup"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("wkhtmltoimage arguments %q are missing %q", args, want)
+		}
+	}
+	if strings.Contains(args, "--enable-local-file-access") {
+		t.Errorf("wkhtmltoimage arguments %q allow every local file", args)
+	}
+}
+
+func TestWriteBundleWorkDirStaysInside(t *testing.T) {
+	workDir, err := writeBundleWorkDir([]byte("<html></html>"), map[string][]byte{
+		"css/style.css":    []byte("body{}"),
+		"../../escape.txt": []byte("outside"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(workDir)
+
+	for _, name := range []string{"index.html", "css/style.css", "escape.txt"} {
+		if _, err := os.Stat(filepath.Join(workDir, name)); err != nil {
+			t.Errorf("%s not written inside the work dir: %v", name, err)
+		}
+	}
+}
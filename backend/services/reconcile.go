@@ -0,0 +1,311 @@
+package services
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Kinds of reconcile findings
+const (
+	OrphanObject    = "orphan_object"
+	MisplacedObject = "misplaced_object"
+	DanglingRow     = "dangling_row"
+)
+
+// What reconciling did about a finding
+const (
+	FixDeleted     = "deleted"
+	FixMoved       = "moved"
+	FixSoftDeleted = "soft_deleted"
+	FixReported    = "reported"
+)
+
+// ReconcileFinding is an object without a row, an object under the wrong name or a row without its object
+type ReconcileFinding struct {
+	Kind       string `json:"kind"`
+	Bucket     string `json:"bucket"`
+	ObjectName string `json:"objectName"`
+	Target     string `json:"target,omitempty"`
+	RefNumber  string `json:"refNumber,omitempty"`
+	Fix        string `json:"fix"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ReconcileReport is the report of a reconcile run
+type ReconcileReport struct {
+	models.ReconcileRun
+	Objects  int                `json:"objects"`
+	Rows     int                `json:"rows"`
+	Findings []ReconcileFinding `json:"findings"`
+}
+
+// reconcileFindings is the stored part of a report
+type reconcileFindings struct {
+	Objects  int                `json:"objects"`
+	Rows     int                `json:"rows"`
+	Findings []ReconcileFinding `json:"findings"`
+}
+
+// ownedPrefixes are the prefixes the service stores objects under, besides the UUIDs of documents and templates
+var ownedPrefixes = []string{"assets/", "revision-assets/", "partials/", "revisions/", "golden/"}
+
+// expectedObject is where a row expects an object, with the refNumber of the row
+type expectedObject struct {
+	refNumber string
+	createdAt time.Time
+}
+
+// ReconcileRuns lists the reconcile runs, newest first
+func ReconcileRuns(db *gorm.DB, limit int) ([]models.ReconcileRun, error) {
+	var runs []models.ReconcileRun
+	err := db.Order("started_at desc").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// ReconcileRunReport loads the report of a reconcile run
+func ReconcileRunReport(db *gorm.DB, id string) (ReconcileReport, error) {
+	var report ReconcileReport
+	if err := db.First(&report.ReconcileRun, "id = ?", id).Error; err != nil {
+		return report, err
+	}
+	if report.Report != "" {
+		var stored reconcileFindings
+		if err := json.Unmarshal([]byte(report.Report), &stored); err != nil {
+			return report, err
+		}
+		report.Objects, report.Rows, report.Findings = stored.Objects, stored.Rows, stored.Findings
+	}
+	return report, nil
+}
+
+// Reconcile compares the documents and templates with the pdfs and templates buckets and fixes what does not match:
+// objects no row points to are deleted, objects in or out of the trash against their row's state are moved,
+// and documents whose PDF is gone are soft-deleted. Templates missing objects, and objects under names the service
+// does not give, are only reported.
+// Objects and rows newer than the outbox's compensation delay, or with a pending storage operation, belong to
+// requests in flight and are skipped. A dry run reports without fixing. While a retention run holds the storage lease, it returns ErrLeaseHeld.
+func Reconcile(db *gorm.DB, trigger string, dryRun bool) (ReconcileReport, error) {
+	report := ReconcileReport{ReconcileRun: models.ReconcileRun{ID: uuid.New().String(), Trigger: trigger, DryRun: dryRun, StartedAt: time.Now()}, Findings: []ReconcileFinding{}}
+	release, err := acquireLease(db, storageLease)
+	if err != nil {
+		return report, err
+	}
+	defer release()
+
+	if err := db.Create(&report.ReconcileRun).Error; err != nil {
+		return report, err
+	}
+
+	err = reconcileDocuments(db, &report)
+	if err == nil {
+		err = reconcileTemplates(db, &report)
+	}
+
+	sort.Slice(report.Findings, func(i, j int) bool {
+		if report.Findings[i].Bucket != report.Findings[j].Bucket {
+			return report.Findings[i].Bucket < report.Findings[j].Bucket
+		}
+		return report.Findings[i].ObjectName < report.Findings[j].ObjectName
+	})
+	finished := time.Now()
+	report.FinishedAt = &finished
+	if err != nil {
+		report.Error = err.Error()
+	}
+	findings, _ := json.Marshal(reconcileFindings{Objects: report.Objects, Rows: report.Rows, Findings: report.Findings})
+	report.Report = string(findings)
+	if saveErr := db.Save(&report.ReconcileRun).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return report, err
+}
+
+// reconcileDocuments matches document rows with the pdfs bucket
+func reconcileDocuments(db *gorm.DB, report *ReconcileReport) error {
+	cutoff := report.StartedAt.Add(-compensationDelay)
+	pending, err := pendingObjects(db, "pdfs")
+	if err != nil {
+		return err
+	}
+	objects, err := ListFiles("pdfs")
+	if err != nil {
+		return err
+	}
+	report.Objects += len(objects)
+
+	// a live document's PDF is named after it, a deleted one's is in the trash
+	expected := map[string]expectedObject{}
+	var documents []models.Document
+	err = db.Unscoped().Select("id", "ref_number", "created_at", "deleted_at").FindInBatches(&documents, 500, func(tx *gorm.DB, batch int) error {
+		for _, document := range documents {
+			name := document.ID
+			if document.DeletedAt.Valid {
+				name = trashPrefix + document.ID
+			}
+			expected[name] = expectedObject{refNumber: document.RefNumber, createdAt: document.CreatedAt}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+	report.Rows += len(expected)
+
+	reconcileObjects(report, "pdfs", objects, expected, pending, cutoff)
+
+	for name, row := range expected {
+		if _, ok := objects[name]; ok || row.createdAt.After(cutoff) || pending[name] {
+			continue
+		}
+		if _, ok := objects[otherName(name)]; ok {
+			// moved into place by reconcileObjects
+			continue
+		}
+		finding := ReconcileFinding{Kind: DanglingRow, Bucket: "pdfs", ObjectName: name, RefNumber: row.refNumber, Fix: FixReported}
+		if !strings.HasPrefix(name, trashPrefix) {
+			// a live document without its PDF cannot be downloaded, it goes to the trash to be purged
+			finding.Fix = FixSoftDeleted
+			if !report.DryRun {
+				if err := db.Where("id = ?", name).Delete(&models.Document{}).Error; err != nil {
+					finding.Error = err.Error()
+				}
+			}
+		}
+		report.Findings = append(report.Findings, finding)
+	}
+	return nil
+}
+
+// reconcileTemplates matches templates and partials with the templates bucket
+func reconcileTemplates(db *gorm.DB, report *ReconcileReport) error {
+	cutoff := report.StartedAt.Add(-compensationDelay)
+	pending, err := pendingObjects(db, "templates")
+	if err != nil {
+		return err
+	}
+	objects, err := ListFiles("templates")
+	if err != nil {
+		return err
+	}
+	report.Objects += len(objects)
+
+	expected := map[string]expectedObject{}
+	var templates []models.Template
+	if err := db.Unscoped().Find(&templates).Error; err != nil {
+		return err
+	}
+	for _, template := range templates {
+		names, err := templateObjects(db, template)
+		if err != nil {
+			return err
+		}
+		prefix := ""
+		if template.DeletedAt.Valid {
+			prefix = trashPrefix
+		}
+		for _, name := range names {
+			expected[prefix+name] = expectedObject{refNumber: template.RefNumber, createdAt: template.CreatedAt}
+		}
+	}
+	// deleted partials keep their objects, as their rows stay to show past versions
+	var partials []models.Partial
+	if err := db.Unscoped().Find(&partials).Error; err != nil {
+		return err
+	}
+	for _, partial := range partials {
+		expected[partial.FileName] = expectedObject{refNumber: partial.Name, createdAt: partial.CreatedAt}
+	}
+	report.Rows += len(templates) + len(partials)
+
+	reconcileObjects(report, "templates", objects, expected, pending, cutoff)
+
+	for name, row := range expected {
+		if _, ok := objects[name]; ok || row.createdAt.After(cutoff) || pending[name] {
+			continue
+		}
+		if _, ok := objects[otherName(name)]; ok {
+			continue
+		}
+		report.Findings = append(report.Findings, ReconcileFinding{Kind: DanglingRow, Bucket: "templates", ObjectName: name, RefNumber: row.refNumber, Fix: FixReported})
+	}
+	return nil
+}
+
+// reconcileObjects deletes the objects of a bucket no row expects and moves those expected under their other name.
+// Objects the service does not own are reported and left alone.
+func reconcileObjects(report *ReconcileReport, bucketName string, objects map[string]time.Time, expected map[string]expectedObject, pending map[string]bool, cutoff time.Time) {
+	for name, modified := range objects {
+		if _, ok := expected[name]; ok || modified.After(cutoff) || pending[name] {
+			continue
+		}
+
+		finding := ReconcileFinding{Kind: OrphanObject, Bucket: bucketName, ObjectName: name, Fix: FixDeleted}
+		other := otherName(name)
+		if row, ok := expected[other]; ok {
+			finding.RefNumber = row.refNumber
+			if _, exists := objects[other]; !exists {
+				// in or out of the trash while its row is not
+				finding.Kind, finding.Target, finding.Fix = MisplacedObject, other, FixMoved
+			}
+		}
+		if finding.Fix == FixDeleted && !ownedObject(name) {
+			finding.Fix = FixReported
+		}
+		if !report.DryRun && finding.Fix != FixReported {
+			var err error
+			if finding.Fix == FixMoved {
+				err = MoveFile(bucketName, name, other)
+			} else {
+				err = DeleteFile(bucketName, name)
+			}
+			if err != nil {
+				finding.Error = err.Error()
+			}
+		}
+		report.Findings = append(report.Findings, finding)
+	}
+}
+
+// ownedObject reports whether the service could have stored an object under a name, in or out of the trash.
+// Reconciling never deletes objects something else put in the buckets.
+func ownedObject(name string) bool {
+	name = strings.TrimPrefix(name, trashPrefix)
+	for _, prefix := range ownedPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	_, err := uuid.Parse(name)
+	return err == nil && len(name) == 36
+}
+
+// otherName is the name of an object in the trash when it is out of it, and the other way round
+func otherName(name string) string {
+	if trimmed, ok := strings.CutPrefix(name, trashPrefix); ok {
+		return trimmed
+	}
+	return trashPrefix + name
+}
+
+// pendingObjects lists the objects of a bucket that storage operations in the outbox will still change
+func pendingObjects(db *gorm.DB, bucketName string) (map[string]bool, error) {
+	var operations []models.StorageOperation
+	if err := db.Where("bucket = ?", bucketName).Find(&operations).Error; err != nil {
+		return nil, err
+	}
+	pending := map[string]bool{}
+	for _, operation := range operations {
+		pending[operation.ObjectName] = true
+		if operation.Target != "" {
+			pending[operation.Target] = true
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository/memory"
+
+	"gorm.io/gorm"
+)
+
+// reconcileFixture stores an hour-old document missing its PDF, a template with its PDF in the wrong place,
+// an orphan PDF and an object the service does not own
+func reconcileFixture(t *testing.T, db *gorm.DB) *memory.Objects {
+	t.Helper()
+	objects := useTestObjects(t)
+	old := time.Now().Add(-time.Hour)
+	const (
+		documentId = "6f1c2a9e-5b1d-4d8e-9a51-2f3a4b5c6d7e"
+		templateId = "0b9e8d7c-6a5f-4e3d-8c2b-1a0f9e8d7c6b"
+		orphanId   = "3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f"
+	)
+	if err := db.Create(&models.Document{ID: documentId, RefNumber: "DOC-1", CreatedAt: old}).Error; err != nil {
+		t.Fatal(err)
+	}
+	createTestTemplate(t, db, models.Template{ID: templateId, RefNumber: "TPL-1", FileName: templateId, Format: FormatDocx, CreatedAt: old})
+
+	objects.Buckets = map[string]map[string]memory.Object{
+		"pdfs": {
+			orphanId:          {Modified: old},
+			"backups/old.pdf": {Modified: old},
+		},
+		"templates": {
+			trashPrefix + templateId: {Modified: old},
+		},
+	}
+	return objects
+}
+
+func TestReconcileReportsWithoutFixing(t *testing.T) {
+	db := useTestDB(t)
+	objects := reconcileFixture(t, db)
+
+	report, err := Reconcile(db, "test", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixes := map[string]string{}
+	for _, finding := range report.Findings {
+		fixes[finding.Kind+" "+finding.ObjectName] = finding.Fix
+	}
+	want := map[string]string{
+		OrphanObject + " 3c4d5e6f-7a8b-4c9d-8e0f-1a2b3c4d5e6f":                       FixDeleted,
+		OrphanObject + " backups/old.pdf":                                            FixReported,
+		DanglingRow + " 6f1c2a9e-5b1d-4d8e-9a51-2f3a4b5c6d7e":                        FixSoftDeleted,
+		MisplacedObject + " " + trashPrefix + "0b9e8d7c-6a5f-4e3d-8c2b-1a0f9e8d7c6b": FixMoved,
+	}
+	for finding, fix := range want {
+		if fixes[finding] != fix {
+			t.Errorf("%s: fix %q, want %q", finding, fixes[finding], fix)
+		}
+	}
+	if len(report.Findings) != len(want) {
+		t.Errorf("unexpected findings %+v", report.Findings)
+	}
+
+	if len(objects.Names("pdfs")) != 2 || len(objects.Names("templates")) != 1 {
+		t.Error("a dry run changed the buckets")
+	}
+	var count int64
+	db.Model(&models.Document{}).Count(&count)
+	if count != 1 {
+		t.Error("a dry run soft-deleted the document")
+	}
+}
+
+func TestReconcileFixesOnlyOwnedObjects(t *testing.T) {
+	db := useTestDB(t)
+	objects := reconcileFixture(t, db)
+
+	report, err := Reconcile(db, "test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, finding := range report.Findings {
+		if finding.Error != "" {
+			t.Errorf("%s failed: %s", finding.ObjectName, finding.Error)
+		}
+	}
+
+	if names := objects.Names("pdfs"); len(names) != 1 || !names["backups/old.pdf"] {
+		t.Errorf("pdfs left: %v", names)
+	}
+	if names := objects.Names("templates"); len(names) != 1 || !names["0b9e8d7c-6a5f-4e3d-8c2b-1a0f9e8d7c6b"] {
+		t.Errorf("templates left: %v", names)
+	}
+	var count int64
+	db.Model(&models.Document{}).Count(&count)
+	if count != 0 {
+		t.Error("the document without its PDF was not soft-deleted")
+	}
+
+	runs, err := ReconcileRuns(db, 10)
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("runs %+v, %v", runs, err)
+	}
+	stored, err := ReconcileRunReport(db, runs[0].ID)
+	if err != nil || len(stored.Findings) != len(report.Findings) {
+		t.Errorf("stored report %+v, %v", stored, err)
+	}
+}
+
+func TestOwnedObject(t *testing.T) {
+	for name, owned := range map[string]bool{
+		"6f1c2a9e-5b1d-4d8e-9a51-2f3a4b5c6d7e":               true,
+		trashPrefix + "6f1c2a9e-5b1d-4d8e-9a51-2f3a4b5c6d7e": true,
+		"assets/T-1/logo.png":                                true,
+		"revision-assets/R-1/logo.png":                       true,
+		"partials/P-1":                                       true,
+		"revisions/R-1":                                      true,
+		trashPrefix + "golden/S-1.png":                       true,
+		"backups/old.pdf":                                    false,
+		"{6f1c2a9e-5b1d-4d8e-9a51-2f3a4b5c6d7e}":             false,
+		trashPrefix + "notes.txt":                            false,
+	} {
+		if ownedObject(name) != owned {
+			t.Errorf("ownedObject(%q) = %v, want %v", name, !owned, owned)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Entities retention policies apply to
+const (
+	RetentionLogs              = "logs"
+	RetentionFailedGenerations = "failed_generations"
+	RetentionDocuments         = "documents"
+)
+
+// purgeBatch is how many documents a run removes between object deletions and row deletions
+const purgeBatch = 200
+
+// ErrLegalHold is returned when deleting a document under legal hold
+var ErrLegalHold = errors.New("document is under legal hold")
+
+// EntityPurge is what one policy removed in a run
+type EntityPurge struct {
+	Entity         string   `json:"entity"`
+	TemplateId     string   `json:"templateId,omitempty"`
+	RetainDays     int      `json:"retainDays"`
+	PurgeAfterDays int      `json:"purgeAfterDays"`
+	SoftDeleted    int64    `json:"softDeleted"`
+	HardDeleted    int64    `json:"hardDeleted"`
+	ObjectsDeleted int64    `json:"objectsDeleted"`
+	Held           int64    `json:"held"`
+	Errors         []string `json:"errors,omitempty"`
+}
+
+// PurgeReport is the report of a retention run
+type PurgeReport struct {
+	models.PurgeRun
+	Entities []EntityPurge `json:"entities"`
+}
+
+// ValidateRetentionPolicy checks the entity and periods of a policy; only document policies can name a template
+func ValidateRetentionPolicy(policy models.RetentionPolicy) error {
+	switch policy.Entity {
+	case RetentionLogs, RetentionFailedGenerations, RetentionDocuments:
+	default:
+		return fmt.Errorf("invalid entity %q, use logs, failed_generations or documents", policy.Entity)
+	}
+	if policy.TemplateId != "" && policy.Entity != RetentionDocuments {
+		return fmt.Errorf("only document policies can be set per template")
+	}
+	if policy.RetainDays < 1 {
+		return fmt.Errorf("retainDays must be at least 1")
+	}
+	return nil
+}
+
+// RetentionPolicies lists the retention policies, entity defaults first
+func RetentionPolicies(db *gorm.DB) ([]models.RetentionPolicy, error) {
+	var policies []models.RetentionPolicy
+	err := db.Order("entity, template_id").Find(&policies).Error
+	return policies, err
+}
+
+// SaveRetentionPolicy creates or replaces the policy of an entity, or of a template's documents
+func SaveRetentionPolicy(db *gorm.DB, policy models.RetentionPolicy) (models.RetentionPolicy, error) {
+	var existing models.RetentionPolicy
+	err := db.Where("entity = ? AND template_id = ?", policy.Entity, policy.TemplateId).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return policy, err
+	}
+	if err == nil {
+		policy.ID = existing.ID
+		policy.CreatedAt = existing.CreatedAt
+	} else {
+		policy.ID = uuid.New().String()
+		policy.CreatedAt = time.Now()
+	}
+	policy.UpdatedAt = time.Now()
+	return policy, db.Save(&policy).Error
+}
+
+// DeleteRetentionPolicy removes a policy, keeping its rows from then on
+func DeleteRetentionPolicy(db *gorm.DB, id string) error {
+	result := db.Where("id = ?", id).Delete(&models.RetentionPolicy{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// SetLegalHold places a document under legal hold, which exempts it from retention and deletion, or releases it
+func SetLegalHold(db *gorm.DB, document models.Document, hold bool, reason string) (models.Document, error) {
+	if !hold {
+		reason = ""
+	}
+	err := db.Model(&document).Updates(map[string]interface{}{"legal_hold": hold, "legal_hold_reason": reason}).Error
+	document.LegalHold = hold
+	document.LegalHoldReason = reason
+	return document, err
+}
+
+// PurgeRuns lists the retention runs, newest first
+func PurgeRuns(db *gorm.DB, limit int) ([]models.PurgeRun, error) {
+	var runs []models.PurgeRun
+	err := db.Order("started_at desc").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// PurgeRunReport loads the report of a retention run
+func PurgeRunReport(db *gorm.DB, id string) (PurgeReport, error) {
+	var report PurgeReport
+	if err := db.First(&report.PurgeRun, "id = ?", id).Error; err != nil {
+		return report, err
+	}
+	if report.Report != "" {
+		if err := json.Unmarshal([]byte(report.Report), &report.Entities); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// RunRetention applies every retention policy, empties the trash of items past their grace period and stores the report of the run.
+// A dry run counts what would be removed without removing anything. While another run or a reconciliation holds the storage lease, it returns ErrLeaseHeld.
+func RunRetention(db *gorm.DB, trigger string, dryRun bool) (PurgeReport, error) {
+	report := PurgeReport{PurgeRun: models.PurgeRun{ID: uuid.New().String(), Trigger: trigger, DryRun: dryRun, StartedAt: time.Now()}, Entities: []EntityPurge{}}
+	release, err := acquireLease(db, storageLease)
+	if err != nil {
+		return report, err
+	}
+	defer release()
+
+	if err := db.Create(&report.PurgeRun).Error; err != nil {
+		return report, err
+	}
+
+	policies, err := RetentionPolicies(db)
+	if err == nil {
+		// templates with their own document policy are left out of the default one
+		var ownPolicy []string
+		for _, policy := range policies {
+			if policy.Entity == RetentionDocuments && policy.TemplateId != "" {
+				ownPolicy = append(ownPolicy, policy.TemplateId)
+			}
+		}
+		for _, policy := range policies {
+			report.Entities = append(report.Entities, applyPolicy(db, policy, ownPolicy, report.StartedAt, dryRun))
+		}
+	}
+	report.Entities = append(report.Entities, purgeTrash(db, report.StartedAt, dryRun))
+
+	finished := time.Now()
+	report.FinishedAt = &finished
+	if err != nil {
+		report.Error = err.Error()
+	}
+	entities, _ := json.Marshal(report.Entities)
+	report.Report = string(entities)
+	if saveErr := db.Save(&report.PurgeRun).Error; saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return report, err
+}
+
+// StartRetentionSweeper runs the retention policies and trash purge in the background every RETENTION_SWEEP_INTERVAL (24h by default, 0 turns it off)
+func StartRetentionSweeper(db *gorm.DB) {
+	interval := 24 * time.Hour
+	if value := os.Getenv("RETENTION_SWEEP_INTERVAL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Printf("Invalid RETENTION_SWEEP_INTERVAL %q, using %s: %v", value, interval, err)
+		} else {
+			interval = parsed
+		}
+	}
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			report, err := RunRetention(db, "sweeper", false)
+			if errors.Is(err, ErrLeaseHeld) {
+				log.Printf("Retention sweep skipped: %v", err)
+			} else if err != nil {
+				log.Printf("Retention run %s failed: %v", report.ID, err)
+			}
+		}
+	}()
+}
+
+// applyPolicy soft-deletes (for documents, moves to the trash) the rows a policy no longer retains.
+// Failed generations soft-deleted longer than the trash grace period are hard-deleted; documents are left to purgeTrash.
+func applyPolicy(db *gorm.DB, policy models.RetentionPolicy, ownPolicy []string, now time.Time, dryRun bool) EntityPurge {
+	grace := TrashGraceDays()
+	purge := EntityPurge{Entity: policy.Entity, TemplateId: policy.TemplateId, RetainDays: policy.RetainDays, PurgeAfterDays: grace}
+	expired := now.AddDate(0, 0, -policy.RetainDays)
+	graceEnded := now.AddDate(0, 0, -grace)
+
+	var err error
+	switch policy.Entity {
+	case RetentionLogs:
+		// the audit log has no soft delete and is append-only, its retention policy is the one way events leave it
+		query := db.Set(models.AllowAuditPurge, true).Model(&models.AuditEvent{}).Where("created_at < ?", expired)
+		purge.HardDeleted, err = countOrDelete(query, &models.AuditEvent{}, dryRun)
+	case RetentionFailedGenerations:
+		soft := db.Model(&models.FailedGenerations{}).Where("created_at < ?", expired)
+		if purge.SoftDeleted, err = countOrDelete(soft, &models.FailedGenerations{}, dryRun); err == nil {
+			hard := db.Unscoped().Model(&models.FailedGenerations{}).Where("deleted_at < ?", graceEnded)
+			purge.HardDeleted, err = countOrDelete(hard, &models.FailedGenerations{}, dryRun)
+		}
+	case RetentionDocuments:
+		err = purgeDocuments(db, policy, ownPolicy, expired, dryRun, &purge)
+	}
+	if err != nil {
+		purge.Errors = append(purge.Errors, err.Error())
+	}
+	return purge
+}
+
+// purgeDocuments moves the documents a policy no longer retains to the trash; documents under legal hold are counted and kept
+func purgeDocuments(db *gorm.DB, policy models.RetentionPolicy, ownPolicy []string, expired time.Time, dryRun bool, purge *EntityPurge) error {
+	scope := func(query *gorm.DB) *gorm.DB {
+		if policy.TemplateId != "" {
+			return query.Where("template_id = ?", policy.TemplateId)
+		}
+		if len(ownPolicy) > 0 {
+			return query.Where("template_id NOT IN ?", ownPolicy)
+		}
+		return query
+	}
+
+	if err := scope(db.Model(&models.Document{})).Where("created_at < ? AND legal_hold = ?", expired, true).Count(&purge.Held).Error; err != nil {
+		return err
+	}
+
+	soft := scope(db.Model(&models.Document{})).Where("created_at < ? AND legal_hold = ?", expired, false)
+	if dryRun {
+		return soft.Count(&purge.SoftDeleted).Error
+	}
+	return trashDocuments(db, soft, purge)
+}
+
+// trashDocuments moves the documents a query matches to the trash, in batches
+func trashDocuments(db, query *gorm.DB, purge *EntityPurge) error {
+	for {
+		var documents []models.Document
+		if err := query.Session(&gorm.Session{}).Limit(purgeBatch).Find(&documents).Error; err != nil {
+			return err
+		}
+		if len(documents) == 0 {
+			return nil
+		}
+		// a document that cannot be deleted stays for the next run
+		trashed := 0
+		for _, document := range documents {
+			if err := MoveDocumentToTrash(db, document); err != nil {
+				purge.Errors = append(purge.Errors, "document "+document.RefNumber+": "+err.Error())
+				continue
+			}
+			trashed++
+		}
+		purge.SoftDeleted += int64(trashed)
+		if trashed < len(documents) {
+			return nil
+		}
+	}
+}
+
+// hardDeleteDocuments removes the soft-deleted documents a query matches for good, with their search entries,
+// and deletes their objects through the outbox once the rows are gone
+func hardDeleteDocuments(db, query *gorm.DB, purge *EntityPurge) error {
+	for {
+		var documents []models.Document
+		if err := query.Session(&gorm.Session{}).Limit(purgeBatch).Find(&documents).Error; err != nil {
+			return err
+		}
+		if len(documents) == 0 {
+			return nil
+		}
+		ids := make([]string, len(documents))
+		var deletes []models.StorageOperation
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for i, document := range documents {
+				ids[i] = document.ID
+				operation := models.StorageOperation{Action: StorageDelete, Bucket: "pdfs", ObjectName: trashPrefix + document.ID, Reason: "document.purge"}
+				if err := enqueueStorage(tx, &operation); err != nil {
+					return err
+				}
+				deletes = append(deletes, operation)
+			}
+			if err := tx.Where("document_id IN ?", ids).Delete(&models.DocumentSearch{}).Error; err != nil {
+				return err
+			}
+			result := tx.Unscoped().Where("id IN ?", ids).Delete(&models.Document{})
+			purge.HardDeleted += result.RowsAffected
+			return result.Error
+		})
+		if err != nil {
+			return err
+		}
+
+		deleted, errs := applyAll(db, deletes)
+		purge.ObjectsDeleted += deleted
+		for _, err := range errs {
+			purge.Errors = append(purge.Errors, err.Error())
+		}
+	}
+}
+
+// countOrDelete deletes the rows a query matches, or only counts them on a dry run
+func countOrDelete(query *gorm.DB, model interface{}, dryRun bool) (int64, error) {
+	if dryRun {
+		var count int64
+		err := query.Count(&count).Error
+		return count, err
+	}
+	result := query.Delete(model)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+
+	"gorm.io/gorm"
+)
+
+func TestAuditEventsOnlyLeaveThroughRetention(t *testing.T) {
+	db := useTestDB(t)
+	now := time.Now()
+	for _, event := range []models.AuditEvent{
+		{ID: "old", EventType: EventDocumentViewed, CreatedAt: now.AddDate(0, 0, -120)},
+		{ID: "new", EventType: EventDocumentViewed, CreatedAt: now.AddDate(0, 0, -1)},
+	} {
+		if err := db.Create(&event).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.Where("id = ?", "old").Delete(&models.AuditEvent{}).Error; !errors.Is(err, models.ErrAppendOnly) {
+		t.Fatalf("deleting an event gave %v, want ErrAppendOnly", err)
+	}
+	if err := db.Model(&models.AuditEvent{ID: "old"}).Update("actor", "someone").Error; !errors.Is(err, models.ErrAppendOnly) {
+		t.Fatalf("updating an event gave %v, want ErrAppendOnly", err)
+	}
+
+	if _, err := SaveRetentionPolicy(db, models.RetentionPolicy{Entity: RetentionLogs, RetainDays: 90}); err != nil {
+		t.Fatal(err)
+	}
+	report, err := RunRetention(db, "test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Entities[0].HardDeleted != 1 || len(report.Entities[0].Errors) != 0 {
+		t.Errorf("unexpected purge %+v", report.Entities[0])
+	}
+	var left []models.AuditEvent
+	if err := db.Find(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].ID != "new" {
+		t.Errorf("events left: %+v", left)
+	}
+}
+
+func TestRetentionLeavesTrashedDocumentsForTheGracePeriod(t *testing.T) {
+	t.Setenv("TRASH_GRACE_DAYS", "30")
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	now := time.Now()
+	deleted := func(days int) gorm.DeletedAt {
+		return gorm.DeletedAt{Time: now.AddDate(0, 0, -days), Valid: true}
+	}
+	for _, document := range []models.Document{
+		{ID: "expired", RefNumber: "DOC-EXPIRED"},
+		{ID: "trashed", RefNumber: "DOC-TRASHED", DeletedAt: deleted(10)},
+		{ID: "forgotten", RefNumber: "DOC-FORGOTTEN", DeletedAt: deleted(40)},
+	} {
+		document.CreatedAt = now.AddDate(0, 0, -100)
+		if err := db.Create(&document).Error; err != nil {
+			t.Fatal(err)
+		}
+		name := document.ID
+		if document.DeletedAt.Valid {
+			name = trashPrefix + name
+		}
+		if err := objects.Put("pdfs", name, strings.NewReader("%PDF"), "application/pdf"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := SaveRetentionPolicy(db, models.RetentionPolicy{Entity: RetentionDocuments, RetainDays: 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := RunRetention(db, "test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	documents, trash := report.Entities[0], report.Entities[1]
+	if documents.SoftDeleted != 1 || documents.HardDeleted != 0 || documents.PurgeAfterDays != 30 {
+		t.Errorf("unexpected document purge %+v", documents)
+	}
+	if trash.HardDeleted != 1 || trash.ObjectsDeleted != 1 {
+		t.Errorf("unexpected trash purge %+v", trash)
+	}
+
+	items, _, err := TrashItems(db, repository.ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("trash holds %+v, want the expired and the recently trashed document", items)
+	}
+	for _, item := range items {
+		if !item.PurgeAt.After(now) {
+			t.Errorf("%s is shown as purged at %s although it is still in the trash", item.RefNumber, item.PurgeAt)
+		}
+	}
+	if names := objects.Names("pdfs"); len(names) != 2 || !names[trashPrefix+"expired"] || !names[trashPrefix+"trashed"] {
+		t.Errorf("objects left: %v", names)
+	}
+}
+
+func TestStorageRunsShareALease(t *testing.T) {
+	db := useTestDB(t)
+	useTestObjects(t)
+	// another instance is purging
+	release, err := acquireLease(db, storageLease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RunRetention(db, "manual", false); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("retention during a run gave %v, want ErrLeaseHeld", err)
+	}
+	if _, err := Reconcile(db, "manual", true); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("reconciliation during a run gave %v, want ErrLeaseHeld", err)
+	}
+
+	release()
+	if _, err := RunRetention(db, "manual", true); err != nil {
+		t.Errorf("retention after the lease was released: %v", err)
+	}
+
+	// a holder that stopped without releasing
+	db.Create(&models.Lease{Name: storageLease, Holder: "crashed", ExpiresAt: time.Now().Add(-time.Minute)})
+	if _, err := Reconcile(db, "manual", true); err != nil {
+		t.Errorf("reconciliation after the lease expired: %v", err)
+	}
+}
@@ -1,7 +1,6 @@
 package services
 
 import (
-	"example/pdfgenerator/initializers"
 	"example/pdfgenerator/models"
 
 	"gorm.io/gorm"
@@ -9,12 +8,25 @@ import (
 
 var DB *gorm.DB // Assume this is initialized somewhere
 
-func SavePDF(pdf models.Document) error {
-	return initializers.DB.Create(&pdf).Error
+func SavePDF(db *gorm.DB, pdf models.Document) error {
+	return db.Create(&pdf).Error
 }
 
-func SaveTemplate(template *models.Template) error {
-	return initializers.DB.Create(template).Error
+// SaveTemplate stores a new template with its tags, partial references and first, draft revision in one transaction
+func SaveTemplate(db *gorm.DB, template *models.Template, references []string, actor string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(template).Error; err != nil {
+			return err
+		}
+		if err := SaveTemplateTags(tx, template.ID, template.Tags); err != nil {
+			return err
+		}
+		if err := SaveDependencies(tx, template.ID, "template", references); err != nil {
+			return err
+		}
+		_, err := createInitialRevision(tx, *template, actor)
+		return err
+	})
 }
 
 // func UpdateDbDocumentRecord(body models.Document) error {
@@ -24,5 +36,5 @@ func SaveTemplate(template *models.Template) error {
 // 	URL: body.URL,
 // }
 
-// return initializers.DB.
+// return db.
 // }
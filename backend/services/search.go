@@ -0,0 +1,361 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// searchSeparator joins the values of a document's searchable text
+const searchSeparator = " · "
+
+// searchWord matches the words search queries and highlights are made of
+var searchWord = regexp.MustCompile(`[\pL\pN]+`)
+
+// DocumentSearchList describes how document search results can be sorted and filtered
+var DocumentSearchList = repository.ListResource{
+	Sorts:       map[string]string{"rank": "rank", "createdAt": "documents.created_at"},
+	Filters:     map[string]string{"templateId": "document_searches.template_id"},
+	DefaultSort: "rank",
+}
+
+// DocumentMatch is a document found by a search, with its matches highlighted in <mark> tags
+type DocumentMatch struct {
+	models.Document
+	TemplateName string            `json:"templateName"`
+	Rank         float64           `json:"rank"`
+	Content      string            `json:"-"`
+	Highlights   map[string]string `json:"highlights" gorm:"-"`
+}
+
+// ValidateSearchPath checks a dot separated payload path such as customer.name or items.0.sku
+func ValidateSearchPath(path string) (string, error) {
+	path = strings.TrimSpace(path)
+	if path == "" {
+		return "", fmt.Errorf("search paths cannot be empty")
+	}
+	for _, segment := range strings.Split(path, ".") {
+		if strings.TrimSpace(segment) == "" {
+			return "", fmt.Errorf("invalid search path %q", path)
+		}
+	}
+	return path, nil
+}
+
+// SearchPaths lists the payload paths searched in a template's documents
+func SearchPaths(db *gorm.DB, templateId string) ([]string, error) {
+	var paths []models.TemplateSearchPath
+	if err := db.Where("template_id = ?", templateId).Order("path").Find(&paths).Error; err != nil {
+		return nil, err
+	}
+	result := make([]string, len(paths))
+	for i, path := range paths {
+		result[i] = path.Path
+	}
+	return result, nil
+}
+
+// SaveSearchPaths replaces the searched payload paths of a template and reindexes its documents, returning how many were indexed.
+// A template without search paths has every value of its payloads searched.
+func SaveSearchPaths(db *gorm.DB, templateId string, paths []string) (int, error) {
+	seen := map[string]bool{}
+	var valid []string
+	for _, path := range paths {
+		path, err := ValidateSearchPath(path)
+		if err != nil {
+			return 0, err
+		}
+		if !seen[path] {
+			seen[path] = true
+			valid = append(valid, path)
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := DeleteSearchPaths(tx, templateId); err != nil {
+			return err
+		}
+		for _, path := range valid {
+			if err := tx.Create(&models.TemplateSearchPath{ID: uuid.New().String(), TemplateId: templateId, Path: path, CreatedAt: time.Now()}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ReindexDocuments(db, templateId)
+}
+
+// DeleteSearchPaths removes the search paths of a template
+func DeleteSearchPaths(db *gorm.DB, templateId string) error {
+	return db.Where("template_id = ?", templateId).Delete(&models.TemplateSearchPath{}).Error
+}
+
+// IndexDocument stores the searchable text of a document
+func IndexDocument(db *gorm.DB, document models.Document) error {
+	paths, err := SearchPaths(db, document.TemplateId)
+	if err != nil {
+		return err
+	}
+	return db.Save(&models.DocumentSearch{
+		DocumentId: document.ID,
+		TemplateId: document.TemplateId,
+		Content:    searchContent(document, paths),
+		UpdatedAt:  time.Now(),
+	}).Error
+}
+
+// ReindexDocuments rebuilds the searchable text of a template's documents, or of every document when templateId is empty
+func ReindexDocuments(db *gorm.DB, templateId string) (int, error) {
+	query := db.Model(&models.Document{})
+	if templateId != "" {
+		query = query.Where("template_id = ?", templateId)
+	}
+	return indexDocuments(db, query)
+}
+
+// IndexMissingDocuments indexes the documents without searchable text, such as those stored before search existed
+func IndexMissingDocuments(db *gorm.DB) (int, error) {
+	return indexDocuments(db, db.Model(&models.Document{}).
+		Where("NOT EXISTS (SELECT 1 FROM document_searches WHERE document_searches.document_id = documents.id)"))
+}
+
+// StartSearchBackfill indexes the documents missing from the search index in the background
+func StartSearchBackfill(db *gorm.DB) {
+	go func() {
+		indexed, err := IndexMissingDocuments(db)
+		if err != nil {
+			log.Printf("Failed to index documents for search: %v", err)
+		}
+		if indexed > 0 {
+			log.Printf("Indexed %d documents for search", indexed)
+		}
+	}()
+}
+
+// indexDocuments stores the searchable text of the documents a query finds, in batches ordered by ID
+func indexDocuments(db, query *gorm.DB) (int, error) {
+	paths := map[string][]string{}
+	indexed := 0
+	var documents []models.Document
+	result := query.FindInBatches(&documents, 500, func(tx *gorm.DB, batch int) error {
+		for _, document := range documents {
+			templatePaths, ok := paths[document.TemplateId]
+			if !ok {
+				var err error
+				if templatePaths, err = SearchPaths(db, document.TemplateId); err != nil {
+					return err
+				}
+				paths[document.TemplateId] = templatePaths
+			}
+			if err := db.Save(&models.DocumentSearch{
+				DocumentId: document.ID,
+				TemplateId: document.TemplateId,
+				Content:    searchContent(document, templatePaths),
+				UpdatedAt:  time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+			indexed++
+		}
+		return nil
+	})
+	return indexed, result.Error
+}
+
+// SearchDocuments finds the documents whose description, searched payload values or template name match a query.
+// The query uses web search syntax: quoted phrases, or, and a leading - to exclude a word; SQLite only approximates it.
+func SearchDocuments(db *gorm.DB, search string, list repository.ListQuery) ([]DocumentMatch, int64, error) {
+	dialect := repository.For(db)
+	nameMatch, nameArgs := dialect.TextMatch("name", search)
+	matchingTemplates := db.Model(&models.Template{}).Select("id").Where(nameMatch, nameArgs...)
+
+	contentMatch, contentArgs := dialect.TextMatch("document_searches.content", search)
+	query := db.Table("document_searches").
+		Joins("JOIN documents ON documents.id = document_searches.document_id AND documents.deleted_at IS NULL").
+		Joins("LEFT JOIN templates ON templates.id = documents.template_id").
+		Where(contentMatch+" OR document_searches.template_id IN (?)", append(contentArgs, matchingTemplates)...)
+	for name, value := range list.Filters {
+		column, ok := DocumentSearchList.Filters[name]
+		if !ok {
+			return nil, 0, fmt.Errorf("cannot filter by %s", name)
+		}
+		query = query.Where(column+" = ?", value)
+	}
+	if list.From != nil {
+		query = query.Where("documents.created_at >= ?", *list.From)
+	}
+	if list.To != nil {
+		query = query.Where("documents.created_at < ?", *list.To)
+	}
+
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	column, ok := DocumentSearchList.Sorts[list.Sort]
+	if !ok {
+		column = DocumentSearchList.Sorts[DocumentSearchList.DefaultSort]
+	}
+	if list.Desc {
+		column += " desc"
+	}
+	rank, rankArgs := dialect.TextRank("document_searches.content", search)
+	query = query.Select("documents.*, templates.name AS template_name, document_searches.content AS content, "+rank+" AS rank", rankArgs...).
+		Order(column).Order("documents.id")
+	if list.Limit > 0 {
+		query = query.Limit(list.Limit).Offset(list.Offset)
+	}
+
+	var matches []DocumentMatch
+	if err := query.Scan(&matches).Error; err != nil {
+		return nil, 0, err
+	}
+	terms := searchTerms(search)
+	for i := range matches {
+		matches[i].Highlights = map[string]string{}
+		if content, ok := Highlight(matches[i].Content, terms); ok {
+			matches[i].Highlights["content"] = content
+		}
+		if name, ok := Highlight(matches[i].TemplateName, terms); ok {
+			matches[i].Highlights["templateName"] = name
+		}
+	}
+	return matches, total, nil
+}
+
+// Highlight escapes text for HTML and wraps the words matching terms in <mark> tags, reporting whether anything matched
+func Highlight(text string, terms []string) (string, bool) {
+	// the simple search configuration matches whole words regardless of case
+	wanted := map[string]bool{}
+	for _, term := range terms {
+		wanted[strings.ToLower(term)] = true
+	}
+
+	var highlighted strings.Builder
+	matched := false
+	last := 0
+	for _, word := range searchWord.FindAllStringIndex(text, -1) {
+		if !wanted[strings.ToLower(text[word[0]:word[1]])] {
+			continue
+		}
+		highlighted.WriteString(html.EscapeString(text[last:word[0]]))
+		highlighted.WriteString("<mark>" + html.EscapeString(text[word[0]:word[1]]) + "</mark>")
+		last = word[1]
+		matched = true
+	}
+	highlighted.WriteString(html.EscapeString(text[last:]))
+	return highlighted.String(), matched
+}
+
+// searchTerms returns the words of a web search query that a match must or may contain
+func searchTerms(search string) []string {
+	var terms []string
+	for _, word := range strings.Fields(strings.ReplaceAll(search, `"`, " ")) {
+		if strings.HasPrefix(word, "-") || strings.EqualFold(word, "or") {
+			continue
+		}
+		for _, term := range searchWord.FindAllString(word, -1) {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// searchContent joins a document's description with the values at its template's search paths, or every payload value without paths
+func searchContent(document models.Document, paths []string) string {
+	values := []string{}
+	if description := strings.TrimSpace(document.Description); description != "" {
+		values = append(values, description)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(document.JsonPayload)))
+	decoder.UseNumber()
+	var payload interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return strings.Join(values, searchSeparator)
+	}
+
+	if len(paths) == 0 {
+		values = payloadValues(payload, values)
+	}
+	for _, path := range paths {
+		for _, value := range lookupPath(payload, strings.Split(path, ".")) {
+			values = payloadValues(value, values)
+		}
+	}
+	return strings.Join(values, searchSeparator)
+}
+
+// lookupPath returns the values at a path, descending into every element of the arrays it passes
+func lookupPath(value interface{}, segments []string) []interface{} {
+	if len(segments) == 0 {
+		return []interface{}{value}
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if next, ok := value[segments[0]]; ok {
+			return lookupPath(next, segments[1:])
+		}
+	case []interface{}:
+		if index, err := strconv.Atoi(segments[0]); err == nil {
+			if index >= 0 && index < len(value) {
+				return lookupPath(value[index], segments[1:])
+			}
+			return nil
+		}
+		var found []interface{}
+		for _, element := range value {
+			found = append(found, lookupPath(element, segments)...)
+		}
+		return found
+	}
+	return nil
+}
+
+// payloadValues appends the text and number values found in a payload value
+func payloadValues(value interface{}, values []string) []string {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(value) {
+			values = payloadValues(value[key], values)
+		}
+	case []interface{}:
+		for _, element := range value {
+			values = payloadValues(element, values)
+		}
+	case string:
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	case json.Number:
+		values = append(values, value.String())
+	}
+	return values
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+)
+
+func TestIndexMissingDocuments(t *testing.T) {
+	db := useTestDB(t)
+	createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", Name: "Invoice"})
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i, payload := range []string{`{"customer":{"name":"Jane Doe"}}`, `{"customer":{"name":"John Roe"}}`} {
+		document := models.Document{ID: string(rune('a' + i)), RefNumber: "DOC-" + string(rune('A'+i)), TemplateId: "T-1", JsonPayload: models.JSONPayload(payload), CreatedAt: created}
+		if err := db.Create(&document).Error; err != nil {
+			t.Fatal(err)
+		}
+		// the second document was generated after search existed
+		if i == 1 {
+			if err := IndexDocument(db, document); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if matches, _, _ := SearchDocuments(db, "jane", repository.ListQuery{}); len(matches) != 0 {
+		t.Fatalf("unindexed document found: %+v", matches)
+	}
+
+	indexed, err := IndexMissingDocuments(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if indexed != 1 {
+		t.Errorf("indexed %d documents, want only the one missing", indexed)
+	}
+	matches, total, err := SearchDocuments(db, "jane", repository.ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || matches[0].RefNumber != "DOC-A" || matches[0].Highlights["content"] == "" {
+		t.Errorf("search found %d: %+v", total, matches)
+	}
+
+	if indexed, err = IndexMissingDocuments(db); err != nil || indexed != 0 {
+		t.Errorf("second backfill indexed %d, %v", indexed, err)
+	}
+}
+
+func TestSaveSearchPathsIsAtomic(t *testing.T) {
+	db := useTestDB(t)
+	createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", Name: "Invoice"})
+	if _, err := SaveSearchPaths(db, "T-1", []string{"customer.name"}); err != nil {
+		t.Fatal(err)
+	}
+	// the old paths are deleted before the second new one fails
+	if err := db.Exec("CREATE TRIGGER refuse_path BEFORE INSERT ON template_search_paths WHEN NEW.path = 'total' BEGIN SELECT RAISE(ABORT, 'refused'); END").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := SaveSearchPaths(db, "T-1", []string{"customer.email", "total"}); err == nil {
+		t.Fatal("expected saving to fail")
+	}
+	var paths []models.TemplateSearchPath
+	db.Find(&paths, "template_id = ?", "T-1")
+	if len(paths) != 1 || paths[0].Path != "customer.name" {
+		t.Errorf("paths changed by a failed save: %+v", paths)
+	}
+}
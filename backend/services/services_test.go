@@ -0,0 +1,45 @@
+package services
+
+import (
+	"testing"
+
+	"example/pdfgenerator/initializers"
+	"example/pdfgenerator/repository/memory"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// useTestDB returns a new in-memory SQLite database with every migration applied.
+// The migrations run on initializers.DB, which points at it for the rest of the test.
+func useTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := initializers.ConnectSQLite(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = db.Session(&gorm.Session{Logger: logger.Discard})
+
+	previous := initializers.DB
+	initializers.DB = db
+	t.Cleanup(func() {
+		initializers.DB = previous
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if _, err := initializers.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// useTestObjects keeps the files the services store in memory for the rest of the test
+func useTestObjects(t *testing.T) *memory.Objects {
+	t.Helper()
+	objects := &memory.Objects{}
+	Objects = objects
+	t.Cleanup(func() { Objects = nil })
+	return objects
+}
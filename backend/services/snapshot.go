@@ -0,0 +1,168 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// snapshotTimeout bounds rendering one snapshot image
+const snapshotTimeout = time.Minute
+
+// Snapshot is what a template produces for one payload, in a form that can be compared between revisions
+type Snapshot struct {
+	Text  string
+	Image []byte
+}
+
+// RenderSnapshot fills a template with a payload and captures its text and, for HTML based formats, an image of the page
+func RenderSnapshot(templateBytes []byte, data map[string]interface{}, opts RenderOptions) (Snapshot, error) {
+	var snapshot Snapshot
+
+	switch opts.Format {
+	case FormatText:
+		text, err := GenerateText(templateBytes, data, opts)
+		snapshot.Text = text
+		return snapshot, err
+	case FormatDocx:
+		filled, err := FillDocx(templateBytes, data, opts)
+		if err != nil {
+			return snapshot, err
+		}
+		snapshot.Text, err = DocxText(filled)
+		return snapshot, err
+	case FormatPDFForm:
+		filled, err := FillPDFForm(templateBytes, data, false)
+		if err != nil {
+			return snapshot, err
+		}
+		snapshot.Text, err = FormValuesText(filled)
+		return snapshot, err
+	}
+
+	filled, _, err := fillTemplate(templateBytes, data, opts)
+	if err != nil {
+		return snapshot, err
+	}
+	snapshot.Text = HTMLText(filled)
+	snapshot.Image, err = RenderHTMLImage(filled, opts.Assets)
+	return snapshot, err
+}
+
+// SnapshotImagesEnabled reports whether wkhtmltoimage is available for pixel comparisons
+func SnapshotImagesEnabled() bool {
+	_, err := exec.LookPath(wkhtmltoimagePath())
+	return err == nil
+}
+
+// RenderHTMLImage renders filled HTML to a PNG with wkhtmltoimage, nil when it is not installed
+func RenderHTMLImage(filled []byte, assets map[string][]byte) ([]byte, error) {
+	if !SnapshotImagesEnabled() {
+		return nil, nil
+	}
+
+	workDir, err := writeBundleWorkDir(filled, assets)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(workDir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+
+	output := filepath.Join(workDir, "snapshot.png")
+	cmd := exec.CommandContext(ctx, wkhtmltoimagePath(), snapshotArgs(workDir, output)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("wkhtmltoimage failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.ReadFile(output)
+}
+
+// snapshotArgs renders a work dir's index.html with the same sandbox as bundlePage: file access limited to
+// the work dir and network requests sent to a proxy nothing listens on
+func snapshotArgs(workDir, output string) []string {
+	return []string{"--quiet", "--disable-local-file-access", "--allow", workDir,
+		"--proxy", blackholeProxy, "--proxy-hostname-lookup", "--width", "794",
+		filepath.Join(workDir, "index.html"), output}
+}
+
+// DocxText extracts the text of a Word document, one line per paragraph
+func DocxText(docx []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(docx), int64(len(docx)))
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for _, file := range archive.File {
+		if !docxParts.MatchString(file.Name) {
+			continue
+		}
+		content, err := readZipFile(file)
+		if err != nil {
+			return "", err
+		}
+		_, err = mapElements(string(content), "p", func(paragraph string) string {
+			var text strings.Builder
+			for _, m := range docxText.FindAllStringSubmatch(paragraph, -1) {
+				text.WriteString(m[2])
+			}
+			if line := strings.TrimSpace(text.String()); line != "" {
+				lines = append(lines, line)
+			}
+			return paragraph
+		})
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", file.Name, err)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// FormValuesText lists the filled values of a PDF form as name=value lines
+func FormValuesText(pdf []byte) (string, error) {
+	group, err := api.ExportForm(bytes.NewReader(pdf), "snapshot", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var lines []string
+	for _, f := range group.Forms {
+		for _, field := range f.TextFields {
+			lines = append(lines, formFieldName(field.Name, field.ID)+"="+field.Value)
+		}
+		for _, field := range f.DateFields {
+			lines = append(lines, formFieldName(field.Name, field.ID)+"="+field.Value)
+		}
+		for _, field := range f.CheckBoxes {
+			lines = append(lines, fmt.Sprintf("%s=%t", formFieldName(field.Name, field.ID), field.Value))
+		}
+		for _, field := range f.RadioButtonGroups {
+			lines = append(lines, formFieldName(field.Name, field.ID)+"="+field.Value)
+		}
+		for _, field := range f.ComboBoxes {
+			lines = append(lines, formFieldName(field.Name, field.ID)+"="+field.Value)
+		}
+		for _, field := range f.ListBoxes {
+			lines = append(lines, formFieldName(field.Name, field.ID)+"="+strings.Join(field.Values, ","))
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n"), nil
+}
+
+func wkhtmltoimagePath() string {
+	if path := os.Getenv("WKHTMLTOIMAGE"); path != "" {
+		return path
+	}
+	return "wkhtmltoimage"
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxBundleSize caps the total uncompressed size of an uploaded template bundle
+const maxBundleSize = 50 << 20
+
+// BundleFile is one asset extracted from a template bundle
+type BundleFile struct {
+	Path        string
+	ContentType string
+	Data        []byte
+}
+
+// TemplateBundle is an uploaded ZIP holding index.html and the assets it references
+type TemplateBundle struct {
+	Index  []byte
+	Assets []BundleFile
+}
+
+// IsZipArchive reports whether an uploaded template is a ZIP bundle rather than a single HTML file
+func IsZipArchive(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// ReadTemplateBundle extracts index.html and its assets from a ZIP bundle.
+// A bundle zipped from a folder is accepted too, the common top-level directory is dropped.
+func ReadTemplateBundle(data []byte) (TemplateBundle, error) {
+	var bundle TemplateBundle
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return bundle, fmt.Errorf("invalid ZIP bundle: %v", err)
+	}
+
+	root := bundleRoot(archive.File)
+	var total int64
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+
+		name := strings.TrimPrefix(file.Name, root)
+		if strings.HasPrefix(path.Base(name), ".") || strings.HasPrefix(name, "__MACOSX/") {
+			continue
+		}
+		cleaned := path.Clean(name)
+		if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+			return bundle, fmt.Errorf("bundle entry %q points outside the bundle", file.Name)
+		}
+
+		total += int64(file.UncompressedSize64)
+		if total > maxBundleSize {
+			return bundle, fmt.Errorf("bundle is larger than %d MB once extracted", maxBundleSize>>20)
+		}
+
+		content, err := readZipFile(file)
+		if err != nil {
+			return bundle, fmt.Errorf("error reading %q from bundle: %v", file.Name, err)
+		}
+
+		if cleaned == "index.html" {
+			bundle.Index = content
+			continue
+		}
+
+		bundle.Assets = append(bundle.Assets, BundleFile{
+			Path:        cleaned,
+			ContentType: assetContentType(cleaned),
+			Data:        content,
+		})
+	}
+
+	if bundle.Index == nil {
+		return bundle, errors.New("bundle must contain an index.html")
+	}
+
+	return bundle, nil
+}
+
+// AssetObjectName is where a bundle asset is stored in the templates bucket
+func AssetObjectName(templateId, assetPath string) string {
+	return "assets/" + templateId + "/" + assetPath
+}
+
+// SaveTemplateAssets uploads bundle assets to MinIO and records them in the asset manifest
+func SaveTemplateAssets(db *gorm.DB, templateId string, assets []BundleFile) error {
+	for _, asset := range assets {
+		objectName := AssetObjectName(templateId, asset.Path)
+		if err := UploadAsset("templates", objectName, bytes.NewReader(asset.Data), asset.ContentType); err != nil {
+			return err
+		}
+
+		if err := db.Create(&models.TemplateAsset{
+			ID:          uuid.New().String(),
+			TemplateId:  templateId,
+			Path:        asset.Path,
+			ObjectName:  objectName,
+			ContentType: asset.ContentType,
+			Size:        int64(len(asset.Data)),
+			CreatedAt:   time.Now(),
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DiscardTemplateUpload removes the file and the assets stored for a template whose upload failed
+func DiscardTemplateUpload(db *gorm.DB, templateId, objectName string) {
+	if err := DeleteTemplateAssets(db, templateId); err != nil {
+		log.Printf("Failed to remove the assets of discarded template %s: %v", templateId, err)
+	}
+	if err := DeleteFile("templates", objectName); err != nil {
+		log.Printf("Failed to remove the file of discarded template %s: %v", templateId, err)
+	}
+}
+
+// TemplateAssets returns the asset manifest of a template, empty for single-file templates
+func TemplateAssets(db *gorm.DB, templateId string) ([]models.TemplateAsset, error) {
+	var assets []models.TemplateAsset
+	err := db.Where("template_id = ?", templateId).Order("path").Find(&assets).Error
+	return assets, err
+}
+
+// RevisionAssetObjectName is where an asset that comes with an imported revision is stored until the revision is published
+func RevisionAssetObjectName(revisionId, assetPath string) string {
+	return "revision-assets/" + revisionId + "/" + assetPath
+}
+
+// pendingChanges returns the changes of a revision that are not published yet, nil when it has none.
+// Once published they are the template's own, and the objects they named may be replaced by later imports.
+func pendingChanges(revision models.TemplateRevision) *models.RevisionChanges {
+	if revision.Status == RevisionPublished || revision.Status == RevisionSuperseded {
+		return nil
+	}
+	return revision.Changes
+}
+
+// RevisionAssets returns the asset manifest a revision renders with: the assets it brings, otherwise the template's
+func RevisionAssets(db *gorm.DB, template models.Template, revision models.TemplateRevision) ([]models.TemplateAsset, error) {
+	if changes := pendingChanges(revision); changes != nil {
+		return changes.Assets, nil
+	}
+	return TemplateAssets(db, template.ID)
+}
+
+// LoadTemplate downloads a template's HTML together with the bundle assets and partials it needs to render
+func LoadTemplate(db *gorm.DB, template models.Template) ([]byte, RenderOptions, error) {
+	return LoadRevision(db, template, models.TemplateRevision{TemplateId: template.ID, FileName: template.FileName})
+}
+
+// LoadRevision downloads the content of one revision of a template together with what it needs to render.
+// A revision that comes with its own assets and translations renders with those instead of the template's.
+func LoadRevision(db *gorm.DB, template models.Template, revision models.TemplateRevision) ([]byte, RenderOptions, error) {
+	opts := RenderOptions{Format: template.Format}
+
+	templateBytes, err := DownloadFile("templates", revision.FileName)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	manifest, err := RevisionAssets(db, template, revision)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	opts.Assets = make(map[string][]byte, len(manifest))
+	for _, asset := range manifest {
+		content, err := DownloadFile("templates", asset.ObjectName)
+		if err != nil {
+			return nil, opts, fmt.Errorf("error fetching asset %s: %v", asset.Path, err)
+		}
+		opts.Assets[asset.Path] = content
+	}
+
+	// Word and PDF form templates are not parsed as text, they cannot include partials
+	if template.Format != FormatDocx && template.Format != FormatPDFForm {
+		opts.Partials, err = ResolvePartials(db, templateBytes)
+		if err != nil {
+			return nil, opts, err
+		}
+	}
+
+	if changes := pendingChanges(revision); changes != nil {
+		opts.Translations = changes.Translations
+		return templateBytes, opts, nil
+	}
+	opts.Translations, err = TemplateTranslations(db, template.ID)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	return templateBytes, opts, nil
+}
+
+// DeleteTemplateAssets removes a template's bundle assets from MinIO and the manifest
+func DeleteTemplateAssets(db *gorm.DB, templateId string) error {
+	manifest, err := TemplateAssets(db, templateId)
+	if err != nil {
+		return err
+	}
+
+	for _, asset := range manifest {
+		if err := DeleteFile("templates", asset.ObjectName); err != nil {
+			return err
+		}
+	}
+
+	return deleteAssetManifest(db, templateId)
+}
+
+func deleteAssetManifest(tx *gorm.DB, templateId string) error {
+	return tx.Where("template_id = ?", templateId).Delete(&models.TemplateAsset{}).Error
+}
+
+func bundleRoot(files []*zip.File) string {
+	root := ""
+	found := false
+	for _, file := range files {
+		if path.Base(file.Name) != "index.html" || file.FileInfo().IsDir() {
+			continue
+		}
+		dir := strings.TrimSuffix(file.Name, "index.html")
+		if !found || strings.Count(dir, "/") < strings.Count(root, "/") {
+			root, found = dir, true
+		}
+	}
+	return root
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(io.LimitReader(reader, maxBundleSize+1))
+}
+
+func assetContentType(assetPath string) string {
+	if contentType := mime.TypeByExtension(path.Ext(assetPath)); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
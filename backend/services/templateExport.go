@@ -0,0 +1,638 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// exportVersion is the manifest version written by ExportTemplates and accepted by ImportTemplates
+const exportVersion = 1
+
+// maxImportSize caps the total uncompressed size of an imported archive
+const maxImportSize = 200 << 20
+
+// Conflict policies of an import for templates whose refNumber already exists
+const (
+	ConflictFail   = "fail"
+	ConflictSkip   = "skip"
+	ConflictUpdate = "update"
+)
+
+// ErrImportRejected is returned when an import has conflicts or invalid templates; nothing is written
+var ErrImportRejected = errors.New("import rejected, nothing was imported")
+
+// ExportManifest is manifest.json of an export archive, the files it names are stored next to it
+type ExportManifest struct {
+	Version    int              `json:"version"`
+	ExportedAt time.Time        `json:"exportedAt"`
+	Templates  []TemplateExport `json:"templates"`
+	Partials   []PartialExport  `json:"partials"`
+}
+
+// TemplateExport is everything needed to recreate a template in another environment
+type TemplateExport struct {
+	RefNumber     string                       `json:"refNumber"`
+	Name          string                       `json:"templateName"`
+	Format        string                       `json:"format"`
+	DefaultLocale string                       `json:"defaultLocale"`
+	Description   string                       `json:"description"`
+	Category      string                       `json:"category"`
+	Owner         string                       `json:"owner"`
+	Status        string                       `json:"status"`
+	Tags          []string                     `json:"tags"`
+	Metadata      map[string]string            `json:"metadata"`
+	Content       string                       `json:"content"`
+	Assets        []AssetExport                `json:"assets"`
+	Translations  map[string]map[string]string `json:"translations"`
+	Samples       []SampleExport               `json:"samples"`
+
+	content []byte
+	assets  []BundleFile
+}
+
+// AssetExport is one bundle asset of an exported template
+type AssetExport struct {
+	Path        string `json:"path"`
+	ContentType string `json:"contentType"`
+	File        string `json:"file"`
+}
+
+// SampleExport is one sample payload of an exported template, without its golden
+type SampleExport struct {
+	Name   string          `json:"name"`
+	Locale string          `json:"locale"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// PartialExport is a partial or layout used by the exported templates
+type PartialExport struct {
+	Name    string `json:"name"`
+	Kind    string `json:"kind"`
+	Version int    `json:"version"`
+	File    string `json:"file"`
+
+	content []byte
+}
+
+// ImportItem is the planned or applied outcome for one template or partial of an import.
+// Updated templates name the draft revision holding the changes and the outcome of its golden check.
+type ImportItem struct {
+	RefNumber string `json:"refNumber,omitempty"`
+	Name      string `json:"name"`
+	Action    string `json:"action"`
+	Revision  int    `json:"revision,omitempty"`
+	Check     string `json:"check,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ImportReport lists what an import did, or would do in a dry run
+type ImportReport struct {
+	DryRun    bool         `json:"dryRun"`
+	Conflict  string       `json:"conflict"`
+	Templates []ImportItem `json:"templates"`
+	Partials  []ImportItem `json:"partials"`
+}
+
+// ExportTemplate collects the current content, assets, metadata, translations and samples of a template
+func ExportTemplate(db *gorm.DB, template models.Template) (TemplateExport, error) {
+	templates := []models.Template{template}
+	if err := LoadTemplateMetadata(db, templates); err != nil {
+		return TemplateExport{}, err
+	}
+	template = templates[0]
+
+	export := TemplateExport{
+		RefNumber:     template.RefNumber,
+		Name:          template.Name,
+		Format:        template.Format,
+		DefaultLocale: template.DefaultLocale,
+		Description:   template.Description,
+		Category:      template.Category,
+		Owner:         template.Owner,
+		Status:        template.Status,
+		Tags:          template.Tags,
+		Metadata:      template.Metadata,
+		Content:       "templates/" + template.RefNumber + "/content",
+		Assets:        []AssetExport{},
+		Samples:       []SampleExport{},
+	}
+
+	var err error
+	if export.content, err = DownloadFile("templates", template.FileName); err != nil {
+		return export, fmt.Errorf("error fetching template %s: %v", template.RefNumber, err)
+	}
+
+	manifest, err := TemplateAssets(db, template.ID)
+	if err != nil {
+		return export, err
+	}
+	for _, asset := range manifest {
+		content, err := DownloadFile("templates", asset.ObjectName)
+		if err != nil {
+			return export, fmt.Errorf("error fetching asset %s: %v", asset.Path, err)
+		}
+		export.assets = append(export.assets, BundleFile{Path: asset.Path, ContentType: asset.ContentType, Data: content})
+		export.Assets = append(export.Assets, AssetExport{
+			Path:        asset.Path,
+			ContentType: asset.ContentType,
+			File:        "templates/" + template.RefNumber + "/assets/" + asset.Path,
+		})
+	}
+
+	if export.Translations, err = TemplateTranslations(db, template.ID); err != nil {
+		return export, err
+	}
+
+	samples, err := TemplateSamples(db, template.ID)
+	if err != nil {
+		return export, err
+	}
+	for _, sample := range samples {
+		export.Samples = append(export.Samples, SampleExport{Name: sample.Name, Locale: sample.Locale, Data: json.RawMessage(sample.Data)})
+	}
+
+	return export, nil
+}
+
+// ExportTemplates writes a ZIP archive of templates and every partial they use, for ImportTemplates in another environment
+func ExportTemplates(db *gorm.DB, templates []models.Template) ([]byte, error) {
+	manifest := ExportManifest{Version: exportVersion, ExportedAt: time.Now(), Templates: []TemplateExport{}, Partials: []PartialExport{}}
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	write := func(name string, content []byte) error {
+		w, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	}
+
+	exported := map[string]bool{}
+	for _, template := range templates {
+		export, err := ExportTemplate(db, template)
+		if err != nil {
+			return nil, err
+		}
+		if err := write(export.Content, export.content); err != nil {
+			return nil, err
+		}
+		for i, asset := range export.Assets {
+			if err := write(asset.File, export.assets[i].Data); err != nil {
+				return nil, err
+			}
+		}
+		manifest.Templates = append(manifest.Templates, export)
+
+		if template.Format == FormatDocx || template.Format == FormatPDFForm {
+			continue
+		}
+		sources, err := ResolvePartials(db, export.content)
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range sources {
+			partial, err := FindPartial(db, source.Name)
+			if err != nil || exported[partial.ID] {
+				continue
+			}
+			exported[partial.ID] = true
+
+			file := fmt.Sprintf("partials/%s@%d", partial.Name, partial.Version)
+			if err := write(file, []byte(source.Content)); err != nil {
+				return nil, err
+			}
+			manifest.Partials = append(manifest.Partials, PartialExport{Name: partial.Name, Kind: partial.Kind, Version: partial.Version, File: file})
+		}
+	}
+
+	encoded, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := write("manifest.json", encoded); err != nil {
+		return nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// ReadExportArchive parses an export archive and loads the files its manifest names
+func ReadExportArchive(data []byte) (ExportManifest, error) {
+	var manifest ExportManifest
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return manifest, fmt.Errorf("invalid export archive: %v", err)
+	}
+
+	files := map[string][]byte{}
+	var total int64
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		total += int64(file.UncompressedSize64)
+		if total > maxImportSize {
+			return manifest, fmt.Errorf("archive is larger than %d MB once extracted", maxImportSize>>20)
+		}
+		if files[file.Name], err = readZipFile(file); err != nil {
+			return manifest, fmt.Errorf("error reading %q from archive: %v", file.Name, err)
+		}
+	}
+
+	encoded, ok := files["manifest.json"]
+	if !ok {
+		return manifest, errors.New("archive has no manifest.json")
+	}
+	if err := json.Unmarshal(encoded, &manifest); err != nil {
+		return manifest, fmt.Errorf("invalid manifest.json: %v", err)
+	}
+	if manifest.Version != exportVersion {
+		return manifest, fmt.Errorf("unsupported export version %d", manifest.Version)
+	}
+
+	for i := range manifest.Templates {
+		template := &manifest.Templates[i]
+		if template.RefNumber == "" {
+			return manifest, errors.New("template without refNumber in manifest.json")
+		}
+		if template.content, ok = files[template.Content]; !ok {
+			return manifest, fmt.Errorf("template %s: %s is missing from the archive", template.RefNumber, template.Content)
+		}
+		for _, asset := range template.Assets {
+			cleaned := path.Clean(asset.Path)
+			if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+				return manifest, fmt.Errorf("template %s: asset %q points outside the bundle", template.RefNumber, asset.Path)
+			}
+			content, ok := files[asset.File]
+			if !ok {
+				return manifest, fmt.Errorf("template %s: %s is missing from the archive", template.RefNumber, asset.File)
+			}
+			template.assets = append(template.assets, BundleFile{Path: cleaned, ContentType: asset.ContentType, Data: content})
+		}
+	}
+	for i := range manifest.Partials {
+		partial := &manifest.Partials[i]
+		if err := ValidatePartialName(partial.Name); err != nil {
+			return manifest, err
+		}
+		if partial.content, ok = files[partial.File]; !ok {
+			return manifest, fmt.Errorf("partial %s: %s is missing from the archive", partial.Name, partial.File)
+		}
+	}
+
+	return manifest, nil
+}
+
+// ImportTemplates recreates the templates of an export archive, keeping their refNumbers.
+// Existing templates fail the import, are skipped or get a draft revision, depending on conflict; the draft holds the
+// content and everything else the archive changes, which take effect when the revision is published.
+// The whole archive is checked first, so a rejected import writes nothing; a dry run only returns the plan.
+// Objects are stored first and the rows of the whole archive written in one transaction, removing the objects
+// again if it fails.
+func ImportTemplates(db *gorm.DB, data []byte, conflict string, dryRun bool, actor string) (ImportReport, error) {
+	report := ImportReport{DryRun: dryRun, Conflict: conflict, Templates: []ImportItem{}, Partials: []ImportItem{}}
+	switch conflict {
+	case ConflictFail, ConflictSkip, ConflictUpdate:
+	default:
+		return report, fmt.Errorf("invalid conflict policy %q, use fail, skip or update", conflict)
+	}
+
+	manifest, err := ReadExportArchive(data)
+	if err != nil {
+		return report, err
+	}
+
+	rejected := false
+	seen := map[string]bool{}
+	existing := make([]*models.Template, len(manifest.Templates))
+	for i, export := range manifest.Templates {
+		item := ImportItem{RefNumber: export.RefNumber, Name: export.Name, Action: "create"}
+
+		var template models.Template
+		if seen[export.RefNumber] {
+			item.Error = "template " + export.RefNumber + " appears twice in the archive"
+		} else if err := db.Where("ref_number = ?", export.RefNumber).First(&template).Error; err == nil {
+			existing[i] = &template
+			switch conflict {
+			case ConflictSkip:
+				item.Action = "skip"
+			case ConflictUpdate:
+				item.Action = "update"
+				if template.Format != export.Format {
+					item.Error = fmt.Sprintf("template is %s, the archive has %s", template.Format, export.Format)
+				}
+			default:
+				item.Action = "conflict"
+				item.Error = "template " + export.RefNumber + " already exists"
+			}
+		}
+
+		if item.Action != "skip" && item.Error == "" {
+			if lint := LintTemplate(export.Format, export.content, export.assets); lint.Errors > 0 {
+				item.Error = "template has lint errors"
+				for _, issue := range lint.Issues {
+					if issue.Severity == LintError {
+						item.Error += fmt.Sprintf("; line %d: %s", issue.Line, issue.Message)
+					}
+				}
+			}
+		}
+
+		seen[export.RefNumber] = true
+		rejected = rejected || item.Error != ""
+		report.Templates = append(report.Templates, item)
+	}
+
+	for _, partial := range manifest.Partials {
+		item := ImportItem{Name: partial.Name, Action: "create"}
+		if latest, err := FindPartial(db, partial.Name); err == nil {
+			item.Action = "new version"
+			if current, err := DownloadFile("templates", latest.FileName); err == nil && bytes.Equal(current, partial.content) {
+				item.Action = "unchanged"
+			}
+		}
+		report.Partials = append(report.Partials, item)
+	}
+
+	if rejected {
+		return report, ErrImportRejected
+	}
+	if dryRun {
+		return report, nil
+	}
+
+	saga := storageSaga{db: db}
+	partials := make([]stagedPartial, len(manifest.Partials))
+	templates := make([]stagedTemplate, len(manifest.Templates))
+	err = func() error {
+		for i, partial := range manifest.Partials {
+			if report.Partials[i].Action == "unchanged" {
+				continue
+			}
+			if partials[i], err = stagePartial(&saga, partial); err != nil {
+				return fmt.Errorf("error importing partial %s: %v", partial.Name, err)
+			}
+		}
+		for i, export := range manifest.Templates {
+			switch report.Templates[i].Action {
+			case "create":
+				templates[i], err = stageTemplate(&saga, export, newImportedTemplate(export, export.RefNumber), nil, actor)
+			case "update":
+				templates[i], err = stageTemplate(&saga, export, *existing[i], newImportedRevision(*existing[i], actor), actor)
+			default:
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("error importing template %s: %v", export.RefNumber, err)
+			}
+		}
+
+		return db.Transaction(func(tx *gorm.DB) error {
+			for i := range partials {
+				if partials[i].partial.ID == "" {
+					continue
+				}
+				if err := partials[i].save(tx); err != nil {
+					return fmt.Errorf("error importing partial %s: %v", partials[i].partial.Name, err)
+				}
+			}
+			for i := range templates {
+				if templates[i].template.ID == "" {
+					continue
+				}
+				if err := templates[i].save(tx); err != nil {
+					return fmt.Errorf("error importing template %s: %v", templates[i].template.RefNumber, err)
+				}
+			}
+			return saga.commit(tx)
+		})
+	}()
+	if err != nil {
+		saga.compensate()
+		return report, err
+	}
+
+	// the goldens are compared once the partials the drafts may use are stored
+	for i := range templates {
+		if templates[i].revision == nil {
+			continue
+		}
+		revision := *templates[i].revision
+		report.Templates[i].Revision = revision.Revision
+		report.Templates[i].Check = revision.Check
+		if _, err := CheckRevision(db, templates[i].template, &revision); err != nil {
+			log.Printf("Failed to check imported revision %d of template %s: %v", revision.Revision, templates[i].template.RefNumber, err)
+			continue
+		}
+		report.Templates[i].Check = revision.Check
+	}
+
+	return report, nil
+}
+
+// CloneTemplate copies a template's current content, assets, metadata, translations and samples into a new draft template
+func CloneTemplate(db *gorm.DB, template models.Template, name, actor string) (models.Template, error) {
+	export, err := ExportTemplate(db, template)
+	if err != nil {
+		return models.Template{}, err
+	}
+	export.Name = name
+	if export.Name == "" {
+		export.Name = "Copy of " + template.Name
+	}
+	return CreateTemplateFromExport(db, export, GenerateReferenceNumber(), actor)
+}
+
+// CreateTemplateFromExport stores an exported template as a new draft template under the given refNumber
+func CreateTemplateFromExport(db *gorm.DB, export TemplateExport, refNumber, actor string) (models.Template, error) {
+	saga := storageSaga{db: db}
+	staged, err := stageTemplate(&saga, export, newImportedTemplate(export, refNumber), nil, actor)
+	if err == nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := staged.save(tx); err != nil {
+				return err
+			}
+			return saga.commit(tx)
+		})
+	}
+	if err != nil {
+		saga.compensate()
+	}
+	return staged.template, err
+}
+
+// stagedPartial is a partial of an archive whose content is stored, waiting for its row
+type stagedPartial struct {
+	partial    models.Partial
+	references []string
+}
+
+// stagePartial stores the content of an exported partial as its next version
+func stagePartial(saga *storageSaga, export PartialExport) (stagedPartial, error) {
+	references, err := TemplateReferences(string(export.content))
+	if err != nil {
+		return stagedPartial{}, err
+	}
+	staged := stagedPartial{
+		partial:    models.Partial{ID: uuid.New().String(), Name: export.Name, Kind: export.Kind, CreatedAt: time.Now()},
+		references: references,
+	}
+	staged.partial.FileName = "partials/" + staged.partial.ID
+
+	err = saga.step(func() error {
+		return UploadTemplate("templates", staged.partial.FileName, bytes.NewReader(export.content))
+	}, models.StorageOperation{Action: StorageDelete, Bucket: "templates", ObjectName: staged.partial.FileName, Reason: "template.import"})
+	return staged, err
+}
+
+func (staged *stagedPartial) save(tx *gorm.DB) error {
+	if err := createPartialVersion(tx, &staged.partial); err != nil {
+		return err
+	}
+	return SaveDependencies(tx, staged.partial.ID, "partial", staged.references)
+}
+
+// stagedTemplate is a template of an archive whose content and assets are stored, waiting for its rows.
+// A new template gets the archive's details at once, an existing one through a draft revision.
+type stagedTemplate struct {
+	template   models.Template
+	revision   *models.TemplateRevision
+	changes    models.RevisionChanges
+	references []string
+	actor      string
+}
+
+// newImportedTemplate is the row of a template created from an export
+func newImportedTemplate(export TemplateExport, refNumber string) models.Template {
+	template := models.Template{
+		ID:            uuid.New().String(),
+		Name:          export.Name,
+		RefNumber:     refNumber,
+		DefaultLocale: export.DefaultLocale,
+		Format:        export.Format,
+		Description:   export.Description,
+		Category:      export.Category,
+		Owner:         export.Owner,
+		Status:        TemplateDraft,
+		CreatedAt:     time.Now(),
+	}
+	template.FileName = template.ID
+	return template
+}
+
+// newImportedRevision is the draft revision that brings an export's changes to an existing template
+func newImportedRevision(template models.Template, actor string) *models.TemplateRevision {
+	revision := &models.TemplateRevision{
+		ID:         uuid.New().String(),
+		TemplateId: template.ID,
+		Status:     RevisionDraft,
+		Check:      CheckUnchecked,
+		CreatedBy:  actor,
+		CreatedAt:  time.Now(),
+	}
+	revision.FileName = "revisions/" + revision.ID
+	return revision
+}
+
+// stageTemplate stores the content and assets of an exported template, for a new template or a draft revision
+func stageTemplate(saga *storageSaga, export TemplateExport, template models.Template, revision *models.TemplateRevision, actor string) (stagedTemplate, error) {
+	staged := stagedTemplate{template: template, revision: revision, actor: actor}
+	staged.changes = models.RevisionChanges{
+		Name:          export.Name,
+		DefaultLocale: export.DefaultLocale,
+		Description:   export.Description,
+		Category:      export.Category,
+		Owner:         export.Owner,
+		Tags:          export.Tags,
+		Metadata:      export.Metadata,
+		Assets:        []models.TemplateAsset{},
+		Translations:  export.Translations,
+	}
+	for _, sample := range export.Samples {
+		staged.changes.Samples = append(staged.changes.Samples, models.RevisionSample{Name: sample.Name, Locale: sample.Locale, Data: sample.Data})
+	}
+
+	if template.Format != FormatDocx && template.Format != FormatPDFForm {
+		var err error
+		if staged.references, err = TemplateReferences(string(export.content)); err != nil {
+			return staged, err
+		}
+	}
+
+	contentName := template.FileName
+	assetName := func(assetPath string) string { return AssetObjectName(template.ID, assetPath) }
+	if revision != nil {
+		contentName = revision.FileName
+		assetName = func(assetPath string) string { return RevisionAssetObjectName(revision.ID, assetPath) }
+	}
+
+	store := func(objectName string, content []byte, contentType string) error {
+		return saga.step(func() error {
+			return UploadAsset("templates", objectName, bytes.NewReader(content), contentType)
+		}, models.StorageOperation{Action: StorageDelete, Bucket: "templates", ObjectName: objectName, Reason: "template.import"})
+	}
+	if err := store(contentName, export.content, "text/html"); err != nil {
+		return staged, err
+	}
+	for _, asset := range export.assets {
+		objectName := assetName(asset.Path)
+		if err := store(objectName, asset.Data, asset.ContentType); err != nil {
+			return staged, err
+		}
+		staged.changes.Assets = append(staged.changes.Assets, models.TemplateAsset{
+			Path:        asset.Path,
+			ObjectName:  objectName,
+			ContentType: asset.ContentType,
+			Size:        int64(len(asset.Data)),
+			CreatedAt:   time.Now(),
+		})
+	}
+	return staged, nil
+}
+
+// save writes the rows of a staged template: a new template with its details and first revision,
+// or the next draft revision of an existing template
+func (staged *stagedTemplate) save(tx *gorm.DB) error {
+	if staged.revision != nil {
+		var latest models.TemplateRevision
+		if err := tx.Where("template_id = ?", staged.template.ID).Order("revision desc").First(&latest).Error; err != nil {
+			return err
+		}
+		staged.revision.Revision = latest.Revision + 1
+		staged.revision.Changes = &staged.changes
+		if err := tx.Create(staged.revision).Error; err != nil {
+			return err
+		}
+		return recordTransition(tx, *staged.revision, "", RevisionDraft, staged.actor, "revision imported")
+	}
+
+	if err := tx.Create(&staged.template).Error; err != nil {
+		return err
+	}
+	if _, err := applyRevisionChanges(tx, &staged.template, staged.changes); err != nil {
+		return err
+	}
+	if staged.template.Format != FormatDocx && staged.template.Format != FormatPDFForm {
+		if err := SaveDependencies(tx, staged.template.ID, "template", staged.references); err != nil {
+			return err
+		}
+	}
+	_, err := createInitialRevision(tx, staged.template, staged.actor)
+	return err
+}
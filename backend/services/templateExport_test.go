@@ -0,0 +1,227 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository/memory"
+
+	"gorm.io/gorm"
+)
+
+// exportedTemplate stores a published text template with an asset, translations and a sample, and exports it
+func exportedTemplate(t *testing.T, db *gorm.DB) (models.Template, []byte) {
+	t.Helper()
+	template := createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", Name: "Invoice", Format: FormatText, FileName: "T-1", Status: TemplateActive})
+	createTestRevision(t, db, models.TemplateRevision{TemplateId: "T-1", Revision: 1, FileName: "T-1", Status: RevisionPublished, Check: CheckUnchecked}, "Hello {{.name}}")
+	if err := SaveTemplateAssets(db, "T-1", []BundleFile{{Path: "logo.txt", ContentType: "text/plain", Data: []byte("new logo")}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SaveTranslations(db, "T-1", "en", map[string]string{"greeting": "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SaveSample(db, "T-1", "basic", []byte(`{"name":"Ada"}`), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTemplateTags(db, "T-1", []string{"billing"}); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := ExportTemplates(db, []models.Template{template})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return template, archive
+}
+
+func assetContents(t *testing.T, db *gorm.DB, objects *memory.Objects, templateId string) map[string]string {
+	t.Helper()
+	assets, err := TemplateAssets(db, templateId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := map[string]string{}
+	for _, asset := range assets {
+		contents[asset.Path] = string(objects.Buckets["templates"][asset.ObjectName].Content)
+	}
+	return contents
+}
+
+func TestImportUpdateWaitsForPublish(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	template, archive := exportedTemplate(t, db)
+
+	// the target environment has an older version of the template
+	if _, err := UpdateTemplateMetadata(db, template, TemplatePatch{Name: stringPointer("Old invoice")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteTemplateAssets(db, "T-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTemplateAssets(db, "T-1", []BundleFile{{Path: "logo.txt", Data: []byte("old logo")}, {Path: "old.txt", Data: []byte("unused")}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SaveTranslations(db, "T-1", "fr", map[string]string{"greeting": "Bonjour"}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := ImportTemplates(db, archive, ConflictUpdate, false, "importer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item := report.Templates[0]; item.Action != "update" || item.Revision != 2 || item.Check != CheckUnchecked {
+		t.Fatalf("unexpected report %+v", item)
+	}
+
+	// nothing changes until the draft is published
+	var live models.Template
+	db.First(&live, "id = ?", "T-1")
+	translations, _ := TemplateTranslations(db, "T-1")
+	if live.Name != "Old invoice" || live.FileName != "T-1" || len(translations) != 2 {
+		t.Errorf("live template changed by the import: %+v, translations %v", live, translations)
+	}
+	if assets := assetContents(t, db, objects, "T-1"); len(assets) != 2 || assets["logo.txt"] != "old logo" {
+		t.Errorf("live assets changed by the import: %v", assets)
+	}
+
+	var draft models.TemplateRevision
+	if err := db.First(&draft, "template_id = ? AND revision = ?", "T-1", 2).Error; err != nil {
+		t.Fatal(err)
+	}
+	if draft.Status != RevisionDraft || draft.Changes == nil || draft.Changes.Name != "Invoice" {
+		t.Fatalf("unexpected draft %+v", draft)
+	}
+	content, opts, err := LoadRevision(db, live, draft)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "Hello {{.name}}" || string(opts.Assets["logo.txt"]) != "new logo" || len(opts.Translations) != 1 {
+		t.Errorf("draft renders with %q, assets %v, translations %v", content, opts.Assets, opts.Translations)
+	}
+
+	draft, err = SubmitRevision(db, draft, "importer", "")
+	if err == nil {
+		draft, err = ReviewRevision(db, draft, true, "reviewer", "")
+	}
+	if err == nil {
+		live, err = PublishRevision(db, live, draft, false, "reviewer", "")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	translations, _ = TemplateTranslations(db, "T-1")
+	if live.Name != "Invoice" || len(translations) != 1 || translations["en"]["greeting"] != "Hello" {
+		t.Errorf("published template %+v, translations %v", live, translations)
+	}
+	if assets := assetContents(t, db, objects, "T-1"); len(assets) != 1 || assets["logo.txt"] != "new logo" {
+		t.Errorf("published assets %v, want the archive's logo only", assets)
+	}
+	names := objects.Names("templates")
+	if names[AssetObjectName("T-1", "logo.txt")] || names[AssetObjectName("T-1", "old.txt")] {
+		t.Errorf("replaced asset objects not deleted: %v", names)
+	}
+	var pending int64
+	db.Model(&models.StorageOperation{}).Count(&pending)
+	if pending != 0 {
+		t.Errorf("%d storage operations left in the outbox", pending)
+	}
+}
+
+func TestImportCreatesTemplates(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	_, archive := exportedTemplate(t, db)
+
+	report, err := ImportTemplates(db, archive, ConflictFail, false, "importer")
+	if !errors.Is(err, ErrImportRejected) || report.Templates[0].Action != "conflict" {
+		t.Fatalf("existing refNumber: got %v and %+v, want a rejected conflict", err, report.Templates)
+	}
+	if report, err = ImportTemplates(db, archive, ConflictSkip, false, "importer"); err != nil || report.Templates[0].Action != "skip" {
+		t.Fatalf("skip: got %v and %+v", err, report.Templates)
+	}
+
+	// in an environment without the template
+	db = useTestDB(t)
+	if report, err = ImportTemplates(db, archive, ConflictFail, true, "importer"); err != nil || report.Templates[0].Action != "create" {
+		t.Fatalf("dry run: got %v and %+v", err, report.Templates)
+	}
+	var count int64
+	if db.Model(&models.Template{}).Count(&count); count != 0 {
+		t.Fatalf("dry run created %d templates", count)
+	}
+
+	if _, err := ImportTemplates(db, archive, ConflictFail, false, "importer"); err != nil {
+		t.Fatal(err)
+	}
+	var imported models.Template
+	if err := db.First(&imported, "ref_number = ?", "TPL-1").Error; err != nil {
+		t.Fatal(err)
+	}
+	templates := []models.Template{imported}
+	LoadTemplateMetadata(db, templates)
+	translations, _ := TemplateTranslations(db, imported.ID)
+	samples, _ := TemplateSamples(db, imported.ID)
+	if imported.Name != "Invoice" || imported.Status != TemplateDraft || len(templates[0].Tags) != 1 || len(translations) != 1 || len(samples) != 1 {
+		t.Errorf("imported %+v with tags %v, translations %v and samples %v", imported, templates[0].Tags, translations, samples)
+	}
+	if assets := assetContents(t, db, objects, imported.ID); assets["logo.txt"] != "new logo" {
+		t.Errorf("imported assets %v", assets)
+	}
+	revisions, _ := TemplateRevisions(db, imported.ID)
+	if len(revisions) != 1 || revisions[0].Status != RevisionDraft || revisions[0].Changes != nil {
+		t.Errorf("imported revisions %+v, want one draft", revisions)
+	}
+}
+
+func TestImportIsAtomic(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	_, archive := exportedTemplate(t, db)
+
+	db = useTestDB(t)
+	before := objects.Names("templates")
+	// the template row is written before its first revision fails
+	if err := db.Exec("DROP TABLE workflow_transitions").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ImportTemplates(db, archive, ConflictFail, false, "importer"); err == nil {
+		t.Fatal("expected the import to fail")
+	}
+
+	var count int64
+	if db.Model(&models.Template{}).Count(&count); count != 0 {
+		t.Errorf("%d templates left by a failed import", count)
+	}
+	if after := objects.Names("templates"); len(after) != len(before) {
+		t.Errorf("objects of a failed import kept: before %v, after %v", before, after)
+	}
+	if db.Model(&models.StorageOperation{}).Count(&count); count != 0 {
+		t.Errorf("%d storage operations left in the outbox", count)
+	}
+}
+
+func TestCloneTemplate(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	template, _ := exportedTemplate(t, db)
+
+	clone, err := CloneTemplate(db, template, "", "cloner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clone.ID == template.ID || clone.RefNumber == template.RefNumber || !strings.HasPrefix(clone.Name, "Copy of") || clone.Status != TemplateDraft {
+		t.Errorf("unexpected clone %+v", clone)
+	}
+	if assets := assetContents(t, db, objects, clone.ID); assets["logo.txt"] != "new logo" {
+		t.Errorf("cloned assets %v", assets)
+	}
+	content, _, err := LoadTemplate(db, clone)
+	if err != nil || string(content) != "Hello {{.name}}" {
+		t.Errorf("cloned content %q, %v", content, err)
+	}
+}
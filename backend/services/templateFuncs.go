@@ -0,0 +1,106 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"path"
+	"strings"
+)
+
+// RenderOptions carries per-document values that template functions can use
+type RenderOptions struct {
+	VerificationToken string
+	// Assets holds the files of a ZIP template bundle keyed by their path relative to index.html
+	Assets map[string][]byte
+	// Partials are the shared snippets and layouts the template references
+	Partials []PartialSource
+	// Locales is the fallback chain used for translations and formatting, most specific first
+	Locales []string
+	// Translations holds the template's catalogs keyed by locale, then by message key
+	Translations map[string]map[string]string
+	// Format is the template format, html when empty
+	Format string
+	// Flatten bakes filled PDF form fields into the pages
+	Flatten bool
+	// KeyOrder is the key order of the request data, so charts keep object entries in input order
+	KeyOrder KeyOrder
+}
+
+// TemplateFuncs returns the functions available inside uploaded templates
+func TemplateFuncs(opts RenderOptions) template.FuncMap {
+	return template.FuncMap{
+		// verifyQR renders a QR code linking to the public verification page for this document
+		"verifyQR": func(size ...int) (template.URL, error) {
+			return QRCodeDataURI(VerificationURL(opts.VerificationToken), sizeOrDefault(size, 150))
+		},
+		"verifyURL": func() string {
+			return VerificationURL(opts.VerificationToken)
+		},
+		// asset inlines a bundle file as a data URI, e.g. <img src="{{asset "images/logo.png"}}">
+		"asset": func(assetPath string) (template.URL, error) {
+			content, ok := opts.Assets[path.Clean(assetPath)]
+			if !ok {
+				return "", fmt.Errorf("asset %q is not part of the template bundle", assetPath)
+			}
+			mediaType, _, _ := strings.Cut(assetContentType(assetPath), ";")
+			return template.URL("data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(content)), nil
+		},
+		// t translates a catalog key, e.g. {{t "greeting" "name" .customer}} fills {name} in the message
+		"t": func(key string, args ...interface{}) string {
+			return Translate(opts, key, args...)
+		},
+		"lang": func() string {
+			return RenderLocale(opts)
+		},
+		// dir is "rtl" for Arabic and other right-to-left locales, for <html dir="{{dir}}">
+		"dir": func() string {
+			return TextDirection(RenderLocale(opts))
+		},
+		"formatDate": func(value interface{}, style ...string) (string, error) {
+			dateStyle := "medium"
+			if len(style) > 0 {
+				dateStyle = style[0]
+			}
+			return FormatDate(RenderLocale(opts), value, dateStyle)
+		},
+		"formatNumber": func(value interface{}, decimals ...int) (string, error) {
+			return FormatNumber(RenderLocale(opts), value, sizeOrDefault(decimals, 0))
+		},
+		"formatCurrency": func(value interface{}, code string) (string, error) {
+			return FormatCurrency(RenderLocale(opts), value, code)
+		},
+		// barcode renders an inline SVG, e.g. {{barcode "code128" .trackingNumber "width=300" "text=true"}}
+		"barcode": func(kind string, content interface{}, options ...string) (template.HTML, error) {
+			barcodeOpts, err := ParseBarcodeOptions(kind, options)
+			if err != nil {
+				return "", err
+			}
+			return BarcodeSVG(kind, fmt.Sprint(content), barcodeOpts)
+		},
+		// barcodeURI renders a PNG data URI for an img src, e.g. <img src="{{barcodeURI "qr" .url "size=200" "ec=H"}}">
+		"barcodeURI": func(kind string, content interface{}, options ...string) (template.URL, error) {
+			barcodeOpts, err := ParseBarcodeOptions(kind, options)
+			if err != nil {
+				return "", err
+			}
+			return BarcodePNG(kind, fmt.Sprint(content), barcodeOpts)
+		},
+		// chart renders an inline SVG chart, e.g. {{chart "bar" .monthly "label=month" "series=revenue,cost" "title=Revenue"}}
+		"chart": func(kind string, data interface{}, options ...string) (template.HTML, error) {
+			chartOpts, err := ParseChartOptions(options)
+			if err != nil {
+				return "", err
+			}
+			chartOpts.KeyOrder = opts.KeyOrder
+			return ChartSVG(kind, data, chartOpts)
+		},
+	}
+}
+
+func sizeOrDefault(size []int, fallback int) int {
+	if len(size) > 0 && size[0] > 0 {
+		return size[0]
+	}
+	return fallback
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Template statuses
+const (
+	TemplateDraft    = "draft"
+	TemplateActive   = "active"
+	TemplateArchived = "archived"
+)
+
+// TemplateFilter narrows the template list; empty fields match everything and every tag and metadata pair must match
+type TemplateFilter struct {
+	Category string
+	Owner    string
+	Status   string
+	Tags     []string
+	Metadata map[string]string
+}
+
+// TemplatePatch is a partial update of a template's metadata; nil fields are left unchanged.
+// Tags replace the current tags, metadata keys are merged and a null value removes the key.
+type TemplatePatch struct {
+	Name        *string            `json:"templateName"`
+	Description *string            `json:"description"`
+	Category    *string            `json:"category"`
+	Owner       *string            `json:"owner"`
+	Status      *string            `json:"status"`
+	Tags        *[]string          `json:"tags"`
+	Metadata    map[string]*string `json:"metadata"`
+}
+
+// ValidateTemplateStatus checks a template status and defaults an empty one to active
+func ValidateTemplateStatus(status string) (string, error) {
+	switch status = strings.ToLower(strings.TrimSpace(status)); status {
+	case "":
+		return TemplateActive, nil
+	case TemplateDraft, TemplateActive, TemplateArchived:
+		return status, nil
+	}
+	return "", fmt.Errorf("invalid status %q, use draft, active or archived", status)
+}
+
+// NormalizeTags trims and lower-cases tags, dropping empty and repeated ones
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// ListTemplates returns a page of the templates matching a filter with their tags and metadata, and the number of matches
+func ListTemplates(db *gorm.DB, filter TemplateFilter, list repository.ListQuery) ([]models.Template, int64, error) {
+	query := db.Model(&models.Template{})
+	if filter.Category != "" {
+		query = query.Where("category = ?", filter.Category)
+	}
+	if filter.Owner != "" {
+		query = query.Where("owner = ?", filter.Owner)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	for _, tag := range NormalizeTags(filter.Tags) {
+		query = query.Where("id IN (?)", db.Model(&models.TemplateTag{}).Select("template_id").Where("tag = ?", tag))
+	}
+	for key, value := range filter.Metadata {
+		query = query.Where("id IN (?)", db.Model(&models.TemplateMetadata{}).Select("template_id").Where("key = ? AND value = ?", key, value))
+	}
+
+	var templates []models.Template
+	total, err := repository.Paginate(query, TemplateList, list, &templates)
+	if err != nil {
+		return nil, 0, err
+	}
+	return templates, total, LoadTemplateMetadata(db, templates)
+}
+
+// LoadTemplateMetadata fills in the tags and metadata of templates
+func LoadTemplateMetadata(db *gorm.DB, templates []models.Template) error {
+	if len(templates) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(templates))
+	index := make(map[string]int, len(templates))
+	for i := range templates {
+		ids[i] = templates[i].ID
+		index[templates[i].ID] = i
+		templates[i].Tags = []string{}
+		templates[i].Metadata = map[string]string{}
+	}
+
+	var tags []models.TemplateTag
+	if err := db.Where("template_id IN ?", ids).Order("tag").Find(&tags).Error; err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		i := index[tag.TemplateId]
+		templates[i].Tags = append(templates[i].Tags, tag.Tag)
+	}
+
+	var metadata []models.TemplateMetadata
+	if err := db.Where("template_id IN ?", ids).Find(&metadata).Error; err != nil {
+		return err
+	}
+	for _, entry := range metadata {
+		templates[index[entry.TemplateId]].Metadata[entry.Key] = entry.Value
+	}
+	return nil
+}
+
+// SaveTemplateTags replaces the tags of a template
+func SaveTemplateTags(db *gorm.DB, templateId string, tags []string) error {
+	if err := db.Where("template_id = ?", templateId).Delete(&models.TemplateTag{}).Error; err != nil {
+		return err
+	}
+	for _, tag := range NormalizeTags(tags) {
+		if err := db.Create(&models.TemplateTag{ID: uuid.New().String(), TemplateId: templateId, Tag: tag}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateTemplateMetadata applies a patch to a template in one transaction and returns it with its tags and metadata
+func UpdateTemplateMetadata(db *gorm.DB, template models.Template, patch TemplatePatch) (models.Template, error) {
+	updates := map[string]interface{}{}
+	if patch.Name != nil {
+		name := strings.TrimSpace(*patch.Name)
+		if name == "" {
+			return template, fmt.Errorf("template name cannot be empty")
+		}
+		updates["name"] = name
+	}
+	if patch.Description != nil {
+		updates["description"] = *patch.Description
+	}
+	if patch.Category != nil {
+		updates["category"] = strings.TrimSpace(*patch.Category)
+	}
+	if patch.Owner != nil {
+		updates["owner"] = strings.TrimSpace(*patch.Owner)
+	}
+	if patch.Status != nil {
+		status, err := ValidateTemplateStatus(*patch.Status)
+		if err != nil {
+			return template, err
+		}
+		// archiving is a free choice, draft and active follow from the publish workflow
+		if status != TemplateArchived {
+			published, err := HasPublishedRevision(db, template)
+			if err != nil {
+				return template, err
+			}
+			if status == TemplateActive && !published {
+				return template, fmt.Errorf("template %s has no published revision, publish one to make it active", template.RefNumber)
+			}
+			if status == TemplateDraft && published {
+				return template, fmt.Errorf("template %s has a published revision, it can only be active or archived", template.RefNumber)
+			}
+		}
+		updates["status"] = status
+	}
+	for key := range patch.Metadata {
+		if strings.TrimSpace(key) == "" {
+			return template, fmt.Errorf("metadata keys cannot be empty")
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(&template).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if patch.Tags != nil {
+			if err := SaveTemplateTags(tx, template.ID, *patch.Tags); err != nil {
+				return err
+			}
+		}
+		for key, value := range patch.Metadata {
+			if err := tx.Where("template_id = ? AND key = ?", template.ID, key).Delete(&models.TemplateMetadata{}).Error; err != nil {
+				return err
+			}
+			if value == nil {
+				continue
+			}
+			if err := tx.Create(&models.TemplateMetadata{ID: uuid.New().String(), TemplateId: template.ID, Key: key, Value: *value}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return template, err
+	}
+
+	templates := []models.Template{{}}
+	if err := db.First(&templates[0], "id = ?", template.ID).Error; err != nil {
+		return template, err
+	}
+	if err := LoadTemplateMetadata(db, templates); err != nil {
+		return template, err
+	}
+	return templates[0], nil
+}
+
+// deleteTemplateMetadata removes the tags and metadata of a purged template
+func deleteTemplateMetadata(tx *gorm.DB, templateId string) error {
+	if err := tx.Where("template_id = ?", templateId).Delete(&models.TemplateTag{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("template_id = ?", templateId).Delete(&models.TemplateMetadata{}).Error
+}
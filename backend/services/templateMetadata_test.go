@@ -0,0 +1,141 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+
+	"gorm.io/gorm"
+)
+
+func createTestTemplate(t *testing.T, db *gorm.DB, template models.Template) models.Template {
+	t.Helper()
+	if template.CreatedAt.IsZero() {
+		template.CreatedAt = time.Now()
+	}
+	if err := db.Create(&template).Error; err != nil {
+		t.Fatal(err)
+	}
+	return template
+}
+
+func stringPointer(s string) *string {
+	return &s
+}
+
+func TestUpdateTemplateMetadata(t *testing.T) {
+	db := useTestDB(t)
+	template := createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", Name: "Invoice"})
+
+	tags := []string{"Finance", " billing ", "finance"}
+	updated, err := UpdateTemplateMetadata(db, template, TemplatePatch{
+		Name:     stringPointer("  Invoice v2 "),
+		Category: stringPointer("billing"),
+		Tags:     &tags,
+		Metadata: map[string]*string{"region": stringPointer("EU"), "unused": nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Name != "Invoice v2" || updated.Category != "billing" {
+		t.Errorf("unexpected template %+v", updated)
+	}
+	if len(updated.Tags) != 2 || updated.Tags[0] != "billing" || updated.Tags[1] != "finance" {
+		t.Errorf("tags %v, want [billing finance]", updated.Tags)
+	}
+	if len(updated.Metadata) != 1 || updated.Metadata["region"] != "EU" {
+		t.Errorf("metadata %v, want region=EU", updated.Metadata)
+	}
+
+	// a null value removes the key
+	updated, err = UpdateTemplateMetadata(db, updated, TemplatePatch{Metadata: map[string]*string{"region": nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(updated.Metadata) != 0 || len(updated.Tags) != 2 {
+		t.Errorf("metadata %v and tags %v after removing region", updated.Metadata, updated.Tags)
+	}
+}
+
+func TestUpdateTemplateMetadataRejectsEmptyName(t *testing.T) {
+	db := useTestDB(t)
+	template := createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", Name: "Invoice"})
+
+	for _, name := range []string{"", "   "} {
+		if _, err := UpdateTemplateMetadata(db, template, TemplatePatch{Name: stringPointer(name)}); err == nil {
+			t.Errorf("name %q accepted", name)
+		}
+	}
+	if _, err := UpdateTemplateMetadata(db, template, TemplatePatch{Metadata: map[string]*string{" ": stringPointer("x")}}); err == nil {
+		t.Error("empty metadata key accepted")
+	}
+
+	var stored models.Template
+	db.First(&stored, "id = ?", "T-1")
+	if stored.Name != "Invoice" {
+		t.Errorf("name changed to %q", stored.Name)
+	}
+}
+
+func TestUpdateTemplateMetadataIsAtomic(t *testing.T) {
+	db := useTestDB(t)
+	template := createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", Name: "Invoice"})
+	if err := SaveTemplateTags(db, template.ID, []string{"finance"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("DROP TABLE template_metadata").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tags := []string{"legal"}
+	_, err := UpdateTemplateMetadata(db, template, TemplatePatch{Name: stringPointer("Renamed"), Tags: &tags, Metadata: map[string]*string{"region": stringPointer("EU")}})
+	if err == nil {
+		t.Fatal("expected the metadata write to fail")
+	}
+
+	var stored models.Template
+	db.First(&stored, "id = ?", "T-1")
+	var storedTags []models.TemplateTag
+	db.Where("template_id = ?", "T-1").Find(&storedTags)
+	if stored.Name != "Invoice" || len(storedTags) != 1 || storedTags[0].Tag != "finance" {
+		t.Errorf("partial update kept: name %q, tags %+v", stored.Name, storedTags)
+	}
+}
+
+func TestListTemplatesFiltersAndPages(t *testing.T) {
+	db := useTestDB(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, category := range []string{"billing", "billing", "legal", "billing"} {
+		template := createTestTemplate(t, db, models.Template{
+			ID: string(rune('a' + i)), RefNumber: "TPL-" + string(rune('A'+i)), Name: "Template " + string(rune('A'+i)),
+			Category: category, CreatedAt: start.Add(time.Duration(i) * time.Hour),
+		})
+		if i != 1 {
+			if err := SaveTemplateTags(db, template.ID, []string{"finance"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	filter := TemplateFilter{Category: "billing", Tags: []string{"Finance"}}
+	templates, total, err := ListTemplates(db, filter, repository.ListQuery{Limit: 1, Sort: "createdAt", Desc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(templates) != 1 || templates[0].ID != "d" {
+		t.Fatalf("got %d of %d, first %+v; want d of 2", len(templates), total, templates)
+	}
+	if len(templates[0].Tags) != 1 {
+		t.Errorf("tags not loaded: %+v", templates[0])
+	}
+
+	templates, _, err = ListTemplates(db, filter, repository.ListQuery{Limit: 1, Offset: 1, Sort: "createdAt", Desc: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 1 || templates[0].ID != "a" {
+		t.Errorf("second page %+v, want a", templates)
+	}
+}
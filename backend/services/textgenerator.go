@@ -0,0 +1,35 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	texttemplate "text/template"
+)
+
+// GenerateText fills a template as plain text, for SMS and email bodies.
+// Nothing is HTML-escaped and Markdown templates are returned as filled Markdown without their front matter.
+func GenerateText(templateBytes []byte, data map[string]interface{}, opts RenderOptions) (string, error) {
+	if opts.Format == FormatMarkdown {
+		var err error
+		if _, templateBytes, err = ParseFrontMatter(templateBytes); err != nil {
+			return "", err
+		}
+	}
+
+	tmpl := texttemplate.New("upload").Funcs(texttemplate.FuncMap(TemplateFuncs(opts)))
+	for _, partial := range opts.Partials {
+		if _, err := tmpl.New(partial.Name).Parse(partial.Content); err != nil {
+			return "", fmt.Errorf("partial %s: %v", partial.Name, err)
+		}
+	}
+	if _, err := tmpl.Parse(string(templateBytes)); err != nil {
+		return "", err
+	}
+
+	var filled bytes.Buffer
+	if err := tmpl.Execute(&filled, data); err != nil {
+		return "", err
+	}
+
+	return filled.String(), nil
+}
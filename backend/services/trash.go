@@ -0,0 +1,342 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+
+	"gorm.io/gorm"
+)
+
+// trashPrefix is where the objects of deleted templates and documents wait in their bucket until the trash is purged
+const trashPrefix = "trash/"
+
+// Kinds of trash items
+const (
+	TrashDocument = "document"
+	TrashTemplate = "template"
+)
+
+// ErrNotInTrash is returned when restoring a refNumber that is not in the trash
+var ErrNotInTrash = errors.New("nothing in the trash with that refNumber")
+
+// ErrNotRestorable is returned when restoring an item deleted before the trash existed, whose objects were never kept
+var ErrNotRestorable = errors.New("deleted before the trash existed, its objects were not kept")
+
+// TrashItem is a deleted template or document, restorable when its objects were moved to the trash
+type TrashItem struct {
+	Type       string    `json:"type"`
+	ID         string    `json:"id"`
+	RefNumber  string    `json:"refNumber"`
+	Name       string    `json:"name"`
+	TemplateId string    `json:"templateId"`
+	CreatedAt  time.Time `json:"created_at"`
+	DeletedAt  time.Time `json:"deleted_at"`
+	PurgeAt    time.Time `json:"purge_at" gorm:"-"`
+	Restorable bool      `json:"restorable"`
+}
+
+// TrashList is the list resource of the trash
+var TrashList = repository.ListResource{
+	Sorts:       map[string]string{"deletedAt": "deleted_at", "createdAt": "created_at", "name": "name", "refNumber": "ref_number"},
+	Filters:     map[string]string{"type": "type", "templateId": "template_id", "refNumber": "ref_number"},
+	Search:      []string{"name", "ref_number"},
+	DefaultSort: "deletedAt",
+}
+
+// TrashGraceDays is how long deleted items stay restorable, from TRASH_GRACE_DAYS (30 by default)
+func TrashGraceDays() int {
+	days := 30
+	if value := os.Getenv("TRASH_GRACE_DAYS"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			log.Printf("Invalid TRASH_GRACE_DAYS %q, using %d", value, days)
+		} else {
+			days = parsed
+		}
+	}
+	return days
+}
+
+// TrashItems lists the deleted templates and documents
+func TrashItems(db *gorm.DB, list repository.ListQuery) ([]TrashItem, int64, error) {
+	documents := db.Unscoped().Model(&models.Document{}).
+		Select("'" + TrashDocument + "' AS type, id, ref_number, document_name AS name, template_id, created_at, deleted_at, in_trash AS restorable").
+		Where("deleted_at IS NOT NULL")
+	templates := db.Unscoped().Model(&models.Template{}).
+		Select("'" + TrashTemplate + "' AS type, id, ref_number, name, id AS template_id, created_at, deleted_at, in_trash AS restorable").
+		Where("deleted_at IS NOT NULL")
+
+	var items []TrashItem
+	total, err := repository.Paginate(db.Table("(? UNION ALL ?) AS trash", documents, templates), TrashList, list, &items)
+	grace := TrashGraceDays()
+	for i := range items {
+		items[i].PurgeAt = items[i].DeletedAt.AddDate(0, 0, grace)
+	}
+	return items, total, err
+}
+
+// MoveDocumentToTrash soft-deletes a document and moves its PDF to the trash once the row is committed
+func MoveDocumentToTrash(db *gorm.DB, document models.Document) error {
+	move := models.StorageOperation{Action: StorageMove, Bucket: "pdfs", ObjectName: document.ID, Target: trashPrefix + document.ID, Reason: "document.delete"}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&document).Update("in_trash", true).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&document).Error; err != nil {
+			return err
+		}
+		return enqueueStorage(tx, &move)
+	})
+	if err != nil {
+		return err
+	}
+	// the row is gone either way, a move that fails is retried by the outbox worker
+	applyAll(db, []models.StorageOperation{move})
+	return nil
+}
+
+// MoveTemplateToTrash soft-deletes a template and moves its objects to the trash once the row is committed.
+// Its revisions, samples, metadata and search paths are kept for a restore; only its partial dependencies are dropped.
+func MoveTemplateToTrash(db *gorm.DB, template models.Template) error {
+	objects, err := templateObjects(db, template)
+	if err != nil {
+		return err
+	}
+	moves := make([]models.StorageOperation, len(objects))
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("dependent_id = ?", template.ID).Delete(&models.PartialDependency{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&template).Update("in_trash", true).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&template).Error; err != nil {
+			return err
+		}
+		for i, object := range objects {
+			moves[i] = models.StorageOperation{Action: StorageMove, Bucket: "templates", ObjectName: object, Target: trashPrefix + object, Reason: "template.delete"}
+			if err := enqueueStorage(tx, &moves[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	applyAll(db, moves)
+	return nil
+}
+
+// RestoreFromTrash brings back the deleted document or template with a refNumber and its objects.
+// Objects are moved back before the row is restored, and moved to the trash again if that fails.
+// Items deleted before the trash existed have no objects there and give ErrNotRestorable.
+func RestoreFromTrash(db *gorm.DB, refNumber string) (TrashItem, error) {
+	var document models.Document
+	err := db.Unscoped().Where("ref_number = ? AND deleted_at IS NOT NULL", refNumber).First(&document).Error
+	if err == nil {
+		item := TrashItem{Type: TrashDocument, ID: document.ID, RefNumber: document.RefNumber, Name: document.DocumentName, TemplateId: document.TemplateId, CreatedAt: document.CreatedAt, Restorable: document.InTrash}
+		if !document.InTrash {
+			return item, ErrNotRestorable
+		}
+		return item, restoreObjects(db, "pdfs", []string{document.ID}, "document.restore", func(tx *gorm.DB) error {
+			return tx.Unscoped().Model(&document).Updates(map[string]interface{}{"deleted_at": nil, "in_trash": false}).Error
+		})
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return TrashItem{}, err
+	}
+
+	var template models.Template
+	err = db.Unscoped().Where("ref_number = ? AND deleted_at IS NOT NULL", refNumber).First(&template).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return TrashItem{}, ErrNotInTrash
+	}
+	if err != nil {
+		return TrashItem{}, err
+	}
+	item := TrashItem{Type: TrashTemplate, ID: template.ID, RefNumber: template.RefNumber, Name: template.Name, TemplateId: template.ID, CreatedAt: template.CreatedAt, Restorable: template.InTrash}
+	if !template.InTrash {
+		return item, ErrNotRestorable
+	}
+
+	objects, err := templateObjects(db, template)
+	if err != nil {
+		return item, err
+	}
+	err = restoreObjects(db, "templates", objects, "template.restore", func(tx *gorm.DB) error {
+		return tx.Unscoped().Model(&template).Updates(map[string]interface{}{"deleted_at": nil, "in_trash": false}).Error
+	})
+	if err != nil || template.Format == FormatDocx || template.Format == FormatPDFForm {
+		return item, err
+	}
+
+	content, err := DownloadFile("templates", template.FileName)
+	if err != nil {
+		return item, err
+	}
+	references, err := TemplateReferences(string(content))
+	if err != nil {
+		return item, err
+	}
+	return item, SaveDependencies(db, template.ID, "template", references)
+}
+
+// restoreObjects moves objects out of the trash, then runs restore in the transaction that keeps them there
+func restoreObjects(db *gorm.DB, bucketName string, objects []string, reason string, restore func(tx *gorm.DB) error) error {
+	saga := storageSaga{db: db}
+	var err error
+	for _, object := range objects {
+		name := object
+		err = saga.step(func() error {
+			return moveOnce(bucketName, trashPrefix+name, name)
+		}, models.StorageOperation{Action: StorageMove, Bucket: bucketName, ObjectName: name, Target: trashPrefix + name, Reason: reason})
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := restore(tx); err != nil {
+				return err
+			}
+			return saga.commit(tx)
+		})
+	}
+	if err != nil {
+		saga.compensate()
+	}
+	return err
+}
+
+// purgeTrash hard-deletes the templates and documents that have been in the trash longer than the grace period
+func purgeTrash(db *gorm.DB, now time.Time, dryRun bool) EntityPurge {
+	grace := TrashGraceDays()
+	purge := EntityPurge{Entity: "trash", PurgeAfterDays: grace}
+	graceEnded := now.AddDate(0, 0, -grace)
+
+	documents := db.Unscoped().Model(&models.Document{}).Where("deleted_at < ? AND legal_hold = ?", graceEnded, false)
+	var err error
+	if dryRun {
+		err = documents.Count(&purge.HardDeleted).Error
+	} else {
+		err = hardDeleteDocuments(db, documents, &purge)
+	}
+	if err != nil {
+		purge.Errors = append(purge.Errors, err.Error())
+	}
+
+	var templates []models.Template
+	if err := db.Unscoped().Where("deleted_at < ?", graceEnded).Find(&templates).Error; err != nil {
+		purge.Errors = append(purge.Errors, err.Error())
+		return purge
+	}
+	for _, template := range templates {
+		if dryRun {
+			purge.HardDeleted++
+			continue
+		}
+		objects, err := purgeTemplate(db, template)
+		purge.ObjectsDeleted += objects
+		if err != nil {
+			purge.Errors = append(purge.Errors, "template "+template.RefNumber+": "+err.Error())
+		}
+		// objects that could not be removed yet are left to the outbox, the template itself is gone
+		if err == nil || errors.Is(err, ErrStorage) {
+			purge.HardDeleted++
+		}
+	}
+	return purge
+}
+
+// purgeTemplate removes a trashed template for good, with its objects and every row kept for a restore
+func purgeTemplate(db *gorm.DB, template models.Template) (int64, error) {
+	objects, err := templateObjects(db, template)
+	if err != nil {
+		return 0, err
+	}
+
+	// every row goes with the template or none does; the objects are all in the trash and deleted once it commits
+	deletes := make([]models.StorageOperation, len(objects))
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := deleteAssetManifest(tx, template.ID); err != nil {
+			return err
+		}
+		if err := deleteRevisionsAndSamples(tx, template.ID); err != nil {
+			return err
+		}
+		if err := deleteTemplateMetadata(tx, template.ID); err != nil {
+			return err
+		}
+		if err := DeleteSearchPaths(tx, template.ID); err != nil {
+			return err
+		}
+		if err := tx.Where("template_id = ?", template.ID).Delete(&models.TranslationCatalog{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&template).Error; err != nil {
+			return err
+		}
+		for i, object := range objects {
+			deletes[i] = models.StorageOperation{Action: StorageDelete, Bucket: "templates", ObjectName: trashPrefix + object, Reason: "template.purge"}
+			if err := enqueueStorage(tx, &deletes[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	deleted, errs := applyAll(db, deletes)
+	return deleted, errors.Join(errs...)
+}
+
+// templateObjects lists the objects of a template in the templates bucket: its content, revisions and the assets of
+// unpublished imported revisions, bundle assets and golden images
+func templateObjects(db *gorm.DB, template models.Template) ([]string, error) {
+	seen := map[string]bool{}
+	var objects []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			objects = append(objects, name)
+		}
+	}
+	add(template.ID)
+	add(template.FileName)
+
+	revisions, err := TemplateRevisions(db, template.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, revision := range revisions {
+		add(revision.FileName)
+		if changes := pendingChanges(revision); changes != nil {
+			for _, asset := range changes.Assets {
+				add(asset.ObjectName)
+			}
+		}
+	}
+	assets, err := TemplateAssets(db, template.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, asset := range assets {
+		add(asset.ObjectName)
+	}
+	samples, err := TemplateSamples(db, template.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, sample := range samples {
+		add(sample.GoldenImage)
+	}
+	return objects, nil
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"example/pdfgenerator/models"
+	"example/pdfgenerator/repository"
+
+	"gorm.io/gorm"
+)
+
+func TestTrashRestoresDocuments(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	document := models.Document{ID: "doc", RefNumber: "DOC-1", DocumentName: "Invoice", CreatedAt: time.Now()}
+	if err := db.Create(&document).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := objects.Put("pdfs", "doc", strings.NewReader("%PDF"), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MoveDocumentToTrash(db, document); err != nil {
+		t.Fatal(err)
+	}
+	if names := objects.Names("pdfs"); !names[trashPrefix+"doc"] || names["doc"] {
+		t.Fatalf("PDF not moved to the trash: %v", names)
+	}
+	items, total, err := TrashItems(db, repository.ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || !items[0].Restorable || items[0].Type != TrashDocument {
+		t.Fatalf("unexpected trash %+v", items)
+	}
+
+	item, err := RestoreFromTrash(db, "DOC-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.ID != "doc" || !item.Restorable {
+		t.Errorf("unexpected restored item %+v", item)
+	}
+	if names := objects.Names("pdfs"); !names["doc"] || names[trashPrefix+"doc"] {
+		t.Errorf("PDF not moved back: %v", names)
+	}
+	var restored models.Document
+	if err := db.First(&restored, "id = ?", "doc").Error; err != nil || restored.InTrash {
+		t.Errorf("restored document %+v, %v", restored, err)
+	}
+	if _, err := RestoreFromTrash(db, "DOC-1"); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("second restore gave %v, want ErrNotInTrash", err)
+	}
+}
+
+func TestTrashRestoresTemplates(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	template := createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", Name: "Invoice", FileName: "T-1", Format: FormatDocx})
+	if err := objects.Put("templates", "T-1", strings.NewReader("docx"), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MoveTemplateToTrash(db, template); err != nil {
+		t.Fatal(err)
+	}
+	if names := objects.Names("templates"); !names[trashPrefix+"T-1"] || names["T-1"] {
+		t.Fatalf("template not moved to the trash: %v", names)
+	}
+	if _, err := RestoreFromTrash(db, "TPL-1"); err != nil {
+		t.Fatal(err)
+	}
+	if names := objects.Names("templates"); !names["T-1"] {
+		t.Errorf("template not moved back: %v", names)
+	}
+	var restored models.Template
+	if err := db.First(&restored, "id = ?", "T-1").Error; err != nil || restored.InTrash {
+		t.Errorf("restored template %+v, %v", restored, err)
+	}
+}
+
+func TestTrashKeepsItemsDeletedBeforeItExisted(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	deleted := gorm.DeletedAt{Time: time.Now().AddDate(0, 0, -1), Valid: true}
+	document := models.Document{ID: "doc", RefNumber: "DOC-OLD", CreatedAt: time.Now(), DeletedAt: deleted}
+	if err := db.Create(&document).Error; err != nil {
+		t.Fatal(err)
+	}
+	createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-OLD", FileName: "T-1", DeletedAt: deleted})
+
+	items, total, err := TrashItems(db, repository.ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 {
+		t.Fatalf("trash holds %d items, want 2", total)
+	}
+	for _, item := range items {
+		if item.Restorable {
+			t.Errorf("%s is shown as restorable", item.RefNumber)
+		}
+	}
+
+	for _, refNumber := range []string{"DOC-OLD", "TPL-OLD"} {
+		if _, err := RestoreFromTrash(db, refNumber); !errors.Is(err, ErrNotRestorable) {
+			t.Errorf("restoring %s gave %v, want ErrNotRestorable", refNumber, err)
+		}
+	}
+	if len(objects.Names("pdfs"))+len(objects.Names("templates")) != 0 {
+		t.Error("a refused restore touched the object store")
+	}
+	var count int64
+	db.Model(&models.Document{}).Count(&count)
+	if count != 0 {
+		t.Error("a refused restore brought the document back")
+	}
+}
+
+func TestPurgeTemplateIsAtomic(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	template := createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", FileName: "T-1", Format: FormatDocx})
+	if err := objects.Put("templates", "T-1", strings.NewReader("docx"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTemplateTags(db, "T-1", []string{"billing"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveTemplateToTrash(db, template); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("DROP TABLE translation_catalogs").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := purgeTemplate(db, template); err == nil {
+		t.Fatal("expected an error without a translation_catalogs table")
+	}
+	var tags int64
+	db.Model(&models.TemplateTag{}).Count(&tags)
+	if tags != 1 {
+		t.Error("the template's tags were deleted although the purge failed")
+	}
+	if names := objects.Names("templates"); !names[trashPrefix+"T-1"] {
+		t.Errorf("objects deleted although the purge failed: %v", names)
+	}
+	if operations, _ := StorageOperations(db, MaxPageSize); len(operations) != 0 {
+		t.Errorf("deletes of a failed purge left in the outbox: %+v", operations)
+	}
+}
+
+func TestPurgeTemplateRemovesEverything(t *testing.T) {
+	db := useTestDB(t)
+	objects := useTestObjects(t)
+	template := createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", FileName: "T-1", Format: FormatDocx})
+	if err := objects.Put("templates", "T-1", strings.NewReader("docx"), ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveTemplateTags(db, "T-1", []string{"billing"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SaveTranslations(db, "T-1", "en", map[string]string{"title": "Invoice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveTemplateToTrash(db, template); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := purgeTemplate(db, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 || len(objects.Names("templates")) != 0 {
+		t.Errorf("deleted %d objects, left %v", deleted, objects.Names("templates"))
+	}
+	for _, model := range []interface{}{&models.TemplateTag{}, &models.TranslationCatalog{}} {
+		var count int64
+		db.Model(model).Count(&count)
+		if count != 0 {
+			t.Errorf("%T rows left after the purge", model)
+		}
+	}
+	var count int64
+	db.Unscoped().Model(&models.Template{}).Count(&count)
+	if count != 0 {
+		t.Error("template row left after the purge")
+	}
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strings"
+)
+
+// GenerateVerificationToken returns a random token used in public verification links
+func GenerateVerificationToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// HashPDF returns the hex encoded SHA-256 of a rendered document
+func HashPDF(pdfBytes []byte) string {
+	sum := sha256.Sum256(pdfBytes)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerificationURL builds the public link a QR code on a document points to
+func VerificationURL(token string) string {
+	baseURL := strings.TrimSuffix(os.Getenv("PUBLIC_BASE_URL"), "/")
+	return baseURL + "/verify/" + token
+}
+
+// DocumentIssuer returns the issuer name shown on the public verification page
+func DocumentIssuer() string {
+	issuer := os.Getenv("DOCUMENT_ISSUER")
+	if issuer == "" {
+		return "Autodocs"
+	}
+	return issuer
+}
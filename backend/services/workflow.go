@@ -0,0 +1,394 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"example/pdfgenerator/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Revision statuses of the publish workflow: draft -> in_review -> approved or rejected, approved -> published -> superseded
+const (
+	RevisionDraft      = "draft"
+	RevisionInReview   = "in_review"
+	RevisionApproved   = "approved"
+	RevisionRejected   = "rejected"
+	RevisionPublished  = "published"
+	RevisionSuperseded = "superseded"
+)
+
+// revisionNumberAttempts is how often CreateRevision picks the next number when concurrent uploads take it first
+const revisionNumberAttempts = 5
+
+// revisionTransitions lists the statuses each status can move to
+var revisionTransitions = map[string][]string{
+	RevisionDraft:     {RevisionInReview},
+	RevisionInReview:  {RevisionApproved, RevisionRejected},
+	RevisionApproved:  {RevisionPublished},
+	RevisionPublished: {RevisionSuperseded},
+}
+
+var (
+	// ErrInvalidTransition is returned for a workflow step the revision's status does not allow
+	ErrInvalidTransition = errors.New("invalid workflow transition")
+	// ErrSelfApproval is returned when the submitter of a revision tries to approve it
+	ErrSelfApproval = errors.New("a revision cannot be approved by the person who submitted it")
+	// ErrTemplateNotPublished is returned when generating from a template without a published revision
+	ErrTemplateNotPublished = errors.New("template is not published")
+)
+
+// CurrentRevision returns the revision whose content the template serves.
+// Templates stored before revisions existed had theirs recorded by a migration.
+func CurrentRevision(db *gorm.DB, template models.Template) (models.TemplateRevision, error) {
+	var revision models.TemplateRevision
+	err := db.Where("template_id = ? AND file_name = ?", template.ID, template.FileName).Order("revision desc").First(&revision).Error
+	return revision, err
+}
+
+// createInitialRevision records the content of a newly uploaded template as its first, draft revision
+func createInitialRevision(tx *gorm.DB, template models.Template, actor string) (models.TemplateRevision, error) {
+	revision := models.TemplateRevision{
+		ID:         uuid.New().String(),
+		TemplateId: template.ID,
+		Revision:   1,
+		FileName:   template.FileName,
+		Status:     RevisionDraft,
+		Check:      CheckUnchecked,
+		CreatedBy:  actor,
+		CreatedAt:  template.CreatedAt,
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		return revision, err
+	}
+	return revision, recordTransition(tx, revision, "", RevisionDraft, actor, "template uploaded")
+}
+
+// TemplateRevisions lists the revisions of a template, newest first
+func TemplateRevisions(db *gorm.DB, templateId string) ([]models.TemplateRevision, error) {
+	var revisions []models.TemplateRevision
+	err := db.Where("template_id = ?", templateId).Order("revision desc").Find(&revisions).Error
+	return revisions, err
+}
+
+// CreateRevision stores new content for a template as a draft and checks it against the sample goldens.
+// The revision is not used for generation until it is approved and published.
+func CreateRevision(db *gorm.DB, template models.Template, content []byte, actor string) (models.TemplateRevision, GoldenReport, error) {
+	revision := models.TemplateRevision{
+		ID:         uuid.New().String(),
+		TemplateId: template.ID,
+		Status:     RevisionDraft,
+		CreatedBy:  actor,
+		CreatedAt:  time.Now(),
+	}
+	revision.FileName = "revisions/" + revision.ID
+
+	if err := UploadTemplate("templates", revision.FileName, bytes.NewReader(content)); err != nil {
+		return revision, GoldenReport{}, err
+	}
+
+	report, err := checkRevision(db, template, &revision)
+	if err != nil {
+		discardRevisionUpload(revision)
+		return revision, report, err
+	}
+
+	// (template_id, revision) is unique, a concurrent upload that took the number makes us pick the next one
+	for attempt := 1; ; attempt++ {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			return createRevisionNumber(tx, &revision, &report)
+		})
+		if err == nil {
+			return revision, report, nil
+		}
+		var taken int64
+		if countErr := db.Model(&models.TemplateRevision{}).Where("template_id = ? AND revision = ?", template.ID, revision.Revision).Count(&taken).Error; countErr != nil || taken == 0 || attempt == revisionNumberAttempts {
+			discardRevisionUpload(revision)
+			return revision, report, err
+		}
+	}
+}
+
+// createRevisionNumber saves a revision as the next one of its template, with its first workflow transition
+func createRevisionNumber(tx *gorm.DB, revision *models.TemplateRevision, report *GoldenReport) error {
+	var latest models.TemplateRevision
+	if err := tx.Where("template_id = ?", revision.TemplateId).Order("revision desc").First(&latest).Error; err != nil {
+		return err
+	}
+	revision.Revision = latest.Revision + 1
+	if err := setRevisionReport(revision, report); err != nil {
+		return err
+	}
+	if err := tx.Create(revision).Error; err != nil {
+		return err
+	}
+	return recordTransition(tx, *revision, "", RevisionDraft, revision.CreatedBy, "revision uploaded")
+}
+
+// discardRevisionUpload removes the stored content of a revision that could not be saved
+func discardRevisionUpload(revision models.TemplateRevision) {
+	if err := DeleteFile("templates", revision.FileName); err != nil {
+		log.Printf("Failed to remove the file of unsaved revision %s: %v", revision.ID, err)
+	}
+}
+
+// SubmitRevision sends a draft revision to review
+func SubmitRevision(db *gorm.DB, revision models.TemplateRevision, actor, comment string) (models.TemplateRevision, error) {
+	revision.SubmittedBy = actor
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return transition(tx, &revision, RevisionInReview, actor, comment)
+	})
+	return revision, err
+}
+
+// ReviewRevision approves or rejects a revision in review; the submitter cannot approve their own revision
+func ReviewRevision(db *gorm.DB, revision models.TemplateRevision, approve bool, actor, comment string) (models.TemplateRevision, error) {
+	to := RevisionRejected
+	if approve {
+		if actor == revision.SubmittedBy {
+			return revision, ErrSelfApproval
+		}
+		to = RevisionApproved
+	}
+	revision.ReviewedBy = actor
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return transition(tx, &revision, to, actor, comment)
+	})
+	return revision, err
+}
+
+// PublishRevision makes an approved revision the content used for generation and the template active,
+// applying the name, metadata, assets, translations and samples an imported revision comes with.
+// A revision that failed the golden comparison is refused unless acceptChanges is set, which also re-records the goldens.
+func PublishRevision(db *gorm.DB, template models.Template, revision models.TemplateRevision, acceptChanges bool, actor, comment string) (models.Template, error) {
+	if revision.Status != RevisionApproved {
+		return template, fmt.Errorf("%w: revision %d is %s, only approved revisions can be published", ErrInvalidTransition, revision.Revision, revision.Status)
+	}
+	if revision.Check == CheckFailed && !acceptChanges {
+		return template, ErrRevisionBlocked
+	}
+
+	templateBytes, err := DownloadFile("templates", revision.FileName)
+	if err != nil {
+		return template, err
+	}
+	var references []string
+	if template.Format != FormatDocx && template.Format != FormatPDFForm {
+		if references, err = TemplateReferences(string(templateBytes)); err != nil {
+			return template, err
+		}
+	}
+
+	// the superseded revision, the published one and the template change together or not at all
+	published := revision
+	updated := template
+	var deletes []models.StorageOperation
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if updated.Format != FormatDocx && updated.Format != FormatPDFForm {
+			if err := SaveDependencies(tx, updated.ID, "template", references); err != nil {
+				return err
+			}
+		}
+
+		var superseded []models.TemplateRevision
+		if err := tx.Where("template_id = ? AND status = ?", updated.ID, RevisionPublished).Find(&superseded).Error; err != nil {
+			return err
+		}
+		for i := range superseded {
+			if err := transition(tx, &superseded[i], RevisionSuperseded, actor, fmt.Sprintf("superseded by revision %d", published.Revision)); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		published.ActivatedAt = &now
+		if err := transition(tx, &published, RevisionPublished, actor, comment); err != nil {
+			return err
+		}
+
+		if published.Changes != nil {
+			var err error
+			if deletes, err = applyRevisionChanges(tx, &updated, *published.Changes); err != nil {
+				return err
+			}
+		}
+
+		// an archived template stays archived, a draft becomes usable for generation
+		updates := map[string]interface{}{"file_name": published.FileName}
+		if updated.Status != TemplateArchived {
+			updates["status"] = TemplateActive
+		}
+		if err := tx.Model(&updated).Updates(updates).Error; err != nil {
+			return err
+		}
+		updated.FileName = published.FileName
+		if status, ok := updates["status"].(string); ok {
+			updated.Status = status
+		}
+		return nil
+	})
+	if err != nil {
+		return template, err
+	}
+	template = updated
+	// assets the changes replaced; those that fail stay in the outbox
+	applyAll(db, deletes)
+
+	if acceptChanges {
+		samples, err := TemplateSamples(db, template.ID)
+		if err != nil {
+			return template, err
+		}
+		if _, err := RecordGoldens(db, template, samples); err != nil {
+			return template, err
+		}
+	}
+
+	return template, nil
+}
+
+// applyRevisionChanges replaces a template's details with those that come with a revision: translations and assets
+// the revision does not have are removed, samples are added or updated. It returns the operations, enqueued in tx,
+// that delete the objects of replaced assets.
+func applyRevisionChanges(tx *gorm.DB, template *models.Template, changes models.RevisionChanges) ([]models.StorageOperation, error) {
+	updates := map[string]interface{}{
+		"name":           changes.Name,
+		"default_locale": changes.DefaultLocale,
+		"description":    changes.Description,
+		"category":       changes.Category,
+		"owner":          changes.Owner,
+	}
+	if err := tx.Model(template).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	template.Name, template.DefaultLocale = changes.Name, changes.DefaultLocale
+	template.Description, template.Category, template.Owner = changes.Description, changes.Category, changes.Owner
+
+	if err := SaveTemplateTags(tx, template.ID, changes.Tags); err != nil {
+		return nil, err
+	}
+	if err := tx.Where("template_id = ?", template.ID).Delete(&models.TemplateMetadata{}).Error; err != nil {
+		return nil, err
+	}
+	for key, value := range changes.Metadata {
+		if err := tx.Create(&models.TemplateMetadata{ID: uuid.New().String(), TemplateId: template.ID, Key: key, Value: value}).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var replaced []models.TemplateAsset
+	if err := tx.Where("template_id = ?", template.ID).Find(&replaced).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("template_id = ?", template.ID).Delete(&models.TemplateAsset{}).Error; err != nil {
+		return nil, err
+	}
+	kept := map[string]bool{}
+	for _, asset := range changes.Assets {
+		asset.ID = uuid.New().String()
+		asset.TemplateId = template.ID
+		if err := tx.Create(&asset).Error; err != nil {
+			return nil, err
+		}
+		kept[asset.ObjectName] = true
+	}
+	var deletes []models.StorageOperation
+	for _, asset := range replaced {
+		if kept[asset.ObjectName] {
+			continue
+		}
+		operation := models.StorageOperation{Action: StorageDelete, Bucket: "templates", ObjectName: asset.ObjectName, Reason: "revision.publish"}
+		if err := enqueueStorage(tx, &operation); err != nil {
+			return nil, err
+		}
+		deletes = append(deletes, operation)
+	}
+
+	locales := make([]string, 0, len(changes.Translations))
+	for locale, entries := range changes.Translations {
+		if _, err := SaveTranslations(tx, template.ID, locale, entries); err != nil {
+			return nil, err
+		}
+		locales = append(locales, locale)
+	}
+	removed := tx.Where("template_id = ?", template.ID)
+	if len(locales) > 0 {
+		removed = removed.Where("locale NOT IN ?", locales)
+	}
+	if err := removed.Delete(&models.TranslationCatalog{}).Error; err != nil {
+		return nil, err
+	}
+
+	for _, sample := range changes.Samples {
+		if _, err := SaveSample(tx, template.ID, sample.Name, sample.Data, sample.Locale); err != nil {
+			return nil, fmt.Errorf("sample %s has invalid data: %v", sample.Name, err)
+		}
+	}
+	return deletes, nil
+}
+
+// HasPublishedRevision reports whether a template has a revision that can be used for generation
+func HasPublishedRevision(db *gorm.DB, template models.Template) (bool, error) {
+	var count int64
+	err := db.Model(&models.TemplateRevision{}).Where("template_id = ? AND status = ?", template.ID, RevisionPublished).Count(&count).Error
+	return count > 0, err
+}
+
+// GenerationAllowed refuses generation from draft and archived templates, which can still be previewed
+func GenerationAllowed(template models.Template) error {
+	switch template.Status {
+	case TemplateDraft:
+		return fmt.Errorf("%w: template %s is a draft, publish an approved revision to generate documents", ErrTemplateNotPublished, template.RefNumber)
+	case TemplateArchived:
+		return fmt.Errorf("%w: template %s is archived", ErrTemplateNotPublished, template.RefNumber)
+	}
+	return nil
+}
+
+// TemplateTransitions returns the workflow audit trail of a template, oldest first
+func TemplateTransitions(db *gorm.DB, templateId string) ([]models.WorkflowTransition, error) {
+	var transitions []models.WorkflowTransition
+	err := db.Where("template_id = ?", templateId).Order("created_at").Find(&transitions).Error
+	return transitions, err
+}
+
+// transition moves a revision to another status if the workflow allows it and records the change
+func transition(tx *gorm.DB, revision *models.TemplateRevision, to, actor, comment string) error {
+	allowed := false
+	for _, next := range revisionTransitions[revision.Status] {
+		allowed = allowed || next == to
+	}
+	if !allowed {
+		return fmt.Errorf("%w: revision %d is %s and cannot become %s", ErrInvalidTransition, revision.Revision, revision.Status, to)
+	}
+
+	// the status is compared and set in one update, so of two concurrent steps from the same status only one succeeds
+	from := revision.Status
+	revision.Status = to
+	result := tx.Model(revision).Where("status = ?", from).Select("*").Updates(revision)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: revision %d is no longer %s", ErrInvalidTransition, revision.Revision, from)
+	}
+	return recordTransition(tx, *revision, from, to, actor, comment)
+}
+
+func recordTransition(tx *gorm.DB, revision models.TemplateRevision, from, to, actor, comment string) error {
+	return tx.Create(&models.WorkflowTransition{
+		ID:         uuid.New().String(),
+		TemplateId: revision.TemplateId,
+		Revision:   revision.Revision,
+		FromStatus: from,
+		ToStatus:   to,
+		Actor:      actor,
+		Comment:    comment,
+		CreatedAt:  time.Now(),
+	}).Error
+}
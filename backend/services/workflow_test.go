@@ -0,0 +1,288 @@
+package services
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"example/pdfgenerator/initializers"
+	"example/pdfgenerator/models"
+
+	"gorm.io/gorm"
+)
+
+// createTestRevision stores a revision of a template and its content
+func createTestRevision(t *testing.T, db *gorm.DB, revision models.TemplateRevision, content string) models.TemplateRevision {
+	t.Helper()
+	if revision.ID == "" {
+		revision.ID = revision.TemplateId + "-" + revision.FileName
+	}
+	if revision.CreatedAt.IsZero() {
+		revision.CreatedAt = time.Now()
+	}
+	if err := db.Create(&revision).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := UploadTemplate("templates", revision.FileName, strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+	return revision
+}
+
+// publishedTemplate stores a template whose first revision is published, and a draft second revision
+func publishedTemplate(t *testing.T, db *gorm.DB) (models.Template, models.TemplateRevision) {
+	t.Helper()
+	useTestObjects(t)
+	template := createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", Name: "Invoice", Format: FormatText, FileName: "T-1", Status: TemplateActive})
+	createTestRevision(t, db, models.TemplateRevision{TemplateId: "T-1", Revision: 1, FileName: "T-1", Status: RevisionPublished, Check: CheckUnchecked}, "Total {{.total}}")
+	draft := createTestRevision(t, db, models.TemplateRevision{TemplateId: "T-1", Revision: 2, FileName: "revisions/2", Status: RevisionDraft, Check: CheckPassed}, "Amount {{.total}}")
+	return template, draft
+}
+
+func TestRevisionWorkflow(t *testing.T) {
+	db := useTestDB(t)
+	template, revision := publishedTemplate(t, db)
+
+	if _, err := ReviewRevision(db, revision, true, "bob", ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("reviewing a draft: got %v, want ErrInvalidTransition", err)
+	}
+	if _, err := PublishRevision(db, template, revision, false, "bob", ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("publishing a draft: got %v, want ErrInvalidTransition", err)
+	}
+
+	revision, err := SubmitRevision(db, revision, "alice", "new wording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReviewRevision(db, revision, true, "alice", ""); !errors.Is(err, ErrSelfApproval) {
+		t.Fatalf("self approval: got %v, want ErrSelfApproval", err)
+	}
+	if revision, err = ReviewRevision(db, revision, true, "bob", "looks good"); err != nil {
+		t.Fatal(err)
+	}
+	if revision.Status != RevisionApproved || revision.SubmittedBy != "alice" || revision.ReviewedBy != "bob" {
+		t.Fatalf("unexpected revision %+v", revision)
+	}
+
+	template, err = PublishRevision(db, template, revision, false, "bob", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.FileName != "revisions/2" || template.Status != TemplateActive {
+		t.Errorf("template serves %q with status %q", template.FileName, template.Status)
+	}
+	current, err := CurrentRevision(db, template)
+	if err != nil || current.Revision != 2 || current.Status != RevisionPublished || current.ActivatedAt == nil {
+		t.Errorf("current revision %+v, %v", current, err)
+	}
+	revisions, _ := TemplateRevisions(db, template.ID)
+	if len(revisions) != 2 || revisions[1].Status != RevisionSuperseded {
+		t.Errorf("revision 1 not superseded: %+v", revisions)
+	}
+
+	transitions, err := TemplateTransitions(db, template.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var steps []string
+	for _, transition := range transitions {
+		steps = append(steps, transition.FromStatus+">"+transition.ToStatus+":"+transition.Actor)
+	}
+	sort.Strings(steps)
+	if want := "approved>published:bob draft>in_review:alice in_review>approved:bob published>superseded:bob"; strings.Join(steps, " ") != want {
+		t.Errorf("transitions %v, want %s", steps, want)
+	}
+}
+
+func TestTransitionsCompareStatus(t *testing.T) {
+	db := useTestDB(t)
+	template, draft := publishedTemplate(t, db)
+
+	submitted, err := SubmitRevision(db, draft, "alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second request that read the revision before the first changed it
+	if _, err := SubmitRevision(db, draft, "carol", ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("second submit gave %v, want ErrInvalidTransition", err)
+	}
+	approved, err := ReviewRevision(db, submitted, true, "bob", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReviewRevision(db, submitted, false, "dave", ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("concurrent rejection gave %v, want ErrInvalidTransition", err)
+	}
+	if _, err := PublishRevision(db, template, approved, false, "bob", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PublishRevision(db, template, approved, false, "bob", ""); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("second publish gave %v, want ErrInvalidTransition", err)
+	}
+
+	var transitions int64
+	db.Model(&models.WorkflowTransition{}).Where("revision = ?", draft.Revision).Count(&transitions)
+	if transitions != 3 {
+		t.Errorf("%d transitions recorded for revision %d, want 3", transitions, draft.Revision)
+	}
+}
+
+func TestCreateRevisionNumbersAreUnique(t *testing.T) {
+	db := useTestDB(t)
+	template, _ := publishedTemplate(t, db)
+
+	revision, _, err := CreateRevision(db, template, []byte("Sum {{.total}}"), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revision.Revision != 3 || revision.Check != CheckUnchecked {
+		t.Errorf("created revision %d with check %q, want 3 unchecked", revision.Revision, revision.Check)
+	}
+	duplicate := models.TemplateRevision{ID: "duplicate", TemplateId: template.ID, Revision: 3, Status: RevisionDraft}
+	if err := db.Create(&duplicate).Error; err == nil {
+		t.Error("a second revision 3 was stored")
+	}
+}
+
+func TestPublishRevisionRefusesFailedCheck(t *testing.T) {
+	db := useTestDB(t)
+	template, revision := publishedTemplate(t, db)
+	revision.Status = RevisionApproved
+	revision.Check = CheckFailed
+	db.Save(&revision)
+
+	if _, err := PublishRevision(db, template, revision, false, "bob", ""); !errors.Is(err, ErrRevisionBlocked) {
+		t.Errorf("got %v, want ErrRevisionBlocked", err)
+	}
+}
+
+func TestPublishRevisionIsAtomic(t *testing.T) {
+	db := useTestDB(t)
+	template, revision := publishedTemplate(t, db)
+	revision.Status = RevisionApproved
+	db.Save(&revision)
+	// the first transition is saved before its audit trail entry fails
+	if err := db.Exec("DROP TABLE workflow_transitions").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PublishRevision(db, template, revision, false, "bob", ""); err == nil {
+		t.Fatal("expected publishing to fail")
+	}
+
+	revisions, _ := TemplateRevisions(db, template.ID)
+	if len(revisions) != 2 || revisions[0].Status != RevisionApproved || revisions[1].Status != RevisionPublished {
+		t.Errorf("revisions changed by a failed publish: %+v", revisions)
+	}
+	var stored models.Template
+	db.First(&stored, "id = ?", template.ID)
+	if stored.FileName != "T-1" {
+		t.Errorf("template serves %q after a failed publish", stored.FileName)
+	}
+}
+
+func TestSaveTemplateCreatesFirstRevision(t *testing.T) {
+	db := useTestDB(t)
+	template := models.Template{ID: "T-1", RefNumber: "TPL-1", FileName: "T-1", Tags: []string{"billing"}, CreatedAt: time.Now()}
+
+	if err := SaveTemplate(db, &template, []string{"letterhead"}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	revision, err := CurrentRevision(db, template)
+	if err != nil || revision.Revision != 1 || revision.Status != RevisionDraft || revision.CreatedBy != "alice" {
+		t.Errorf("first revision %+v, %v", revision, err)
+	}
+	var tags, dependencies int64
+	db.Model(&models.TemplateTag{}).Count(&tags)
+	db.Model(&models.PartialDependency{}).Count(&dependencies)
+	if tags != 1 || dependencies != 1 {
+		t.Errorf("%d tags and %d dependencies saved, want 1 each", tags, dependencies)
+	}
+}
+
+func TestSaveTemplateIsAtomic(t *testing.T) {
+	db := useTestDB(t)
+	// the template and its tags are saved before its first revision fails
+	if err := db.Exec("DROP TABLE template_revisions").Error; err != nil {
+		t.Fatal(err)
+	}
+	template := models.Template{ID: "T-1", RefNumber: "TPL-1", FileName: "T-1", Tags: []string{"billing"}, CreatedAt: time.Now()}
+
+	if err := SaveTemplate(db, &template, nil, "alice"); err == nil {
+		t.Fatal("expected an error without a template_revisions table")
+	}
+	for _, model := range []interface{}{&models.Template{}, &models.TemplateTag{}} {
+		var count int64
+		db.Unscoped().Model(model).Count(&count)
+		if count != 0 {
+			t.Errorf("%T rows left by a failed save", model)
+		}
+	}
+}
+
+func TestCurrentRevisionDoesNotCreateRevisions(t *testing.T) {
+	db := useTestDB(t)
+	template := createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", FileName: "T-1"})
+
+	if _, err := CurrentRevision(db, template); err == nil {
+		t.Error("expected an error for a template without revisions")
+	}
+	var count int64
+	db.Model(&models.TemplateRevision{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d revisions created by a read", count)
+	}
+}
+
+func TestWorkflowMigrationMapsLegacyRevisions(t *testing.T) {
+	db := useTestDB(t)
+	created := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	createTestTemplate(t, db, models.Template{ID: "T-1", RefNumber: "TPL-1", FileName: "T-1", CreatedAt: created})
+	createTestTemplate(t, db, models.Template{ID: "T-2", RefNumber: "TPL-2", FileName: "revisions/b", CreatedAt: created})
+	// back to before the workflow migration, and the migrations that came after it
+	applied, err := initializers.AppliedMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := 0
+	for version := range applied {
+		if version >= 4 {
+			steps++
+		}
+	}
+	if _, err := initializers.MigrateDown(steps); err != nil {
+		t.Fatal(err)
+	}
+	for _, revision := range []models.TemplateRevision{
+		{ID: "a", TemplateId: "T-2", Revision: 1, FileName: "T-2", Status: "failed"},
+		{ID: "b", TemplateId: "T-2", Revision: 2, FileName: "revisions/b", Status: "active"},
+		{ID: "c", TemplateId: "T-2", Revision: 3, FileName: "revisions/c", Status: "passed"},
+	} {
+		if err := db.Omit("Changes").Create(&revision).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := initializers.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	var revisions []models.TemplateRevision
+	db.Order("template_id, revision").Find(&revisions)
+	var got []string
+	for _, revision := range revisions {
+		got = append(got, revision.TemplateId+"/"+revision.FileName+":"+revision.Status+"/"+revision.Check)
+	}
+	want := "T-1/T-1:published/unchecked T-2/T-2:draft/failed T-2/revisions/b:published/unchecked T-2/revisions/c:draft/passed"
+	if strings.Join(got, " ") != want {
+		t.Errorf("revisions %v, want %s", got, want)
+	}
+
+	var transitions int64
+	db.Model(&models.WorkflowTransition{}).Count(&transitions)
+	if transitions != 4 {
+		t.Errorf("%d transitions recorded, want one per revision", transitions)
+	}
+}
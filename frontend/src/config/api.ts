@@ -5,7 +5,14 @@ const api = axios.create({
   baseURL: import.meta.env.VITE_APP_BASE_URL
 })
 
+// uploads and other recorded changes are refused without an API token, see API_TOKENS in the backend
+const apiToken = import.meta.env.VITE_APP_API_TOKEN
+
 api.interceptors.request.use((config) => {
+  if (apiToken) {
+    config.headers.Authorization = `Bearer ${apiToken}`
+  }
+
   //   const credentials = <IAuthCredentials>JSON.parse(sessionStorage.getItem("credentials")!)
   //
   // if (credentials !== null && credentials !== undefined) {
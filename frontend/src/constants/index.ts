@@ -1 +1,5 @@
 export const Themes: readonly ["primary", "success", "info", "warning", "danger"] = ["primary", "success", "info", "warning", "danger"] as const
+
+// rows per page of the dashboard lists, and the largest page the API returns for lookups
+export const PAGE_SIZE = 10
+export const MAX_PAGE_SIZE = 500
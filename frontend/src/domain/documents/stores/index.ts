@@ -1,21 +1,26 @@
 import {defineStore} from "pinia";
 import type {AxiosResponse} from "axios";
-import type {ApiResponse} from "@/types";
+import type {ApiResponse, ListResponse} from "@/types";
 import {ref, type Ref} from "vue";
 import type {Doc, GenerationRequest} from "@/domain/documents/types";
 import api from "@/config/api";
+import {PAGE_SIZE} from "@/constants";
 
 export const useDocumentStore = defineStore("documents", () => {
 
     const documents: Ref<Doc[] | undefined> = ref()
+    const total: Ref<number> = ref(0)
     const fileBase64: Ref<string | undefined> = ref()
     const generationResponse: Ref<object | undefined> = ref()
     const failedGenerations: Ref<Doc[] | undefined> = ref()
+    const failedTotal: Ref<number> = ref(0)
 
-    const fetchDocuments = async () => {
-        return api.get("/documents")
-            .then((response: AxiosResponse<ApiResponse<Doc[]>>) => {
+    // lists come back one page at a time, total counts every matching row
+    const fetchDocuments = async (page = 1, perPage = PAGE_SIZE) => {
+        return api.get("/documents", {params: {limit: perPage, offset: (page - 1) * perPage}})
+            .then((response: AxiosResponse<ListResponse<Doc[]>>) => {
                 documents.value = response.data.data
+                total.value = response.data.pagination.total
             })
     }
 
@@ -47,16 +52,18 @@ export const useDocumentStore = defineStore("documents", () => {
             })
     }
 
-    const fetchFailedDocuments = async () => {
-        return api.get("/failed-generations")
-            .then((response: AxiosResponse<ApiResponse<Doc[]>>) => {
-                console.log("Failed Generations Response:", response.data.data); // Add this line
+    const fetchFailedDocuments = async (page = 1, perPage = PAGE_SIZE) => {
+        return api.get("/failed-generations", {params: {limit: perPage, offset: (page - 1) * perPage}})
+            .then((response: AxiosResponse<ListResponse<Doc[]>>) => {
                 failedGenerations.value = response.data.data
+                failedTotal.value = response.data.pagination.total
             })
     }
 
     return {
         documents,
+        total,
+        failedTotal,
         generationResponse,
         fileBase64,
         failedGenerations,
@@ -1,31 +1,27 @@
 import {defineStore} from "pinia";
 import type {AxiosResponse} from "axios";
-import type {ApiResponse} from "@/types";
+import type {ListResponse} from "@/types";
 import type {Log} from "@/domain/requests/types";
 import {ref, type Ref} from "vue";
 import api from "@/config/api";
+import {PAGE_SIZE} from "@/constants";
 
 export const useLogStore = defineStore("logs", () => {
 
     const logs: Ref<Log[] | undefined> = ref()
+    const total: Ref<number> = ref(0)
 
-    const fetchLogs = async () => {
-        return api.get("/logs")
-            .then((response: AxiosResponse<ApiResponse<Log[]>>) => {
-                logs.value = response.data.data
-            })
-    }
-
-    const clearLogs = async () => {
-        return api.delete("/clear-logs")
-            .then((response: AxiosResponse<ApiResponse<any>>) => {
+    const fetchLogs = async (page = 1, perPage = PAGE_SIZE) => {
+        return api.get("/logs", {params: {limit: perPage, offset: (page - 1) * perPage}})
+            .then((response: AxiosResponse<ListResponse<Log[]>>) => {
                 logs.value = response.data.data
+                total.value = response.data.pagination.total
             })
     }
 
     return {
         logs,
+        total,
         fetchLogs,
-        clearLogs,
     }
 })
@@ -1,20 +1,24 @@
 import {defineStore} from "pinia";
 import type {AxiosResponse} from "axios";
-import type {ApiResponse} from "@/types";
+import type {ApiResponse, ListResponse} from "@/types";
 import {ref, type Ref} from "vue";
 import api from "@/config/api";
 import type {Template} from "@/domain/templates/types";
+import {MAX_PAGE_SIZE} from "@/constants";
 
 export const useTemplateStore = defineStore("templates", () => {
 
     const templates: Ref<Template[] | undefined> = ref()
+    const total: Ref<number> = ref(0)
     const fileBase64: Ref<string | undefined> = ref()
     const uploadResponse: Ref<object | undefined> = ref()
 
-    const fetchTemplates = async () => {
-        return api.get("/templates")
-            .then((response: AxiosResponse<ApiResponse<Template[]>>) => {
+    // without a page, as many templates as one request returns, for name lookups and pickers
+    const fetchTemplates = async (page = 1, perPage = MAX_PAGE_SIZE) => {
+        return api.get("/templates", {params: {limit: perPage, offset: (page - 1) * perPage}})
+            .then((response: AxiosResponse<ListResponse<Template[]>>) => {
                 templates.value = response.data.data
+                total.value = response.data.pagination.total
             })
     }
 
@@ -45,6 +49,7 @@ export const useTemplateStore = defineStore("templates", () => {
         fileBase64,
         fetchTemplateFile,
         fetchTemplates,
+        total,
         deleteTemplate,
         uploadTemplate,
     }
@@ -16,3 +16,16 @@ export interface ApiErrorResponse {
     error:string
     status:number
 }
+
+export interface Pagination {
+    total: number
+    limit: number
+    offset: number
+    sort: string
+    next?: string
+    previous?: string
+}
+
+export interface ListResponse<T> extends ApiResponse<T> {
+    pagination: Pagination
+}
@@ -6,7 +6,7 @@ if [ -f /usr/local/bin/.env ]; then
 fi
 
 # Start the backend application
-/usr/local/bin/main &
+(/usr/local/bin/main migrate up && exec /usr/local/bin/main) &
 # Start nginx
 # nginx -g 'daemon off;'
 # Serve frontend using serve